@@ -0,0 +1,219 @@
+package grove
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The header `APIKeyMiddleware` reads the key from by default.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// The prefix of keys generated by `GenerateAPIKey` when none is provided.
+const DefaultAPIKeyPrefix = "grove"
+
+const (
+	apiKeyIDSize     = 8
+	apiKeySecretSize = 32
+)
+
+var (
+	ErrAPIKeyMissing  = errors.New("API key is missing")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrAPIKeyInvalid  = errors.New("API key is invalid")
+	ErrAPIKeyExpired  = errors.New("API key is expired")
+)
+
+// APIKey is the record a store keeps for an API key.
+// Only the SHA-256 hash of the key is stored. Keys are long random values, so unlike passwords
+// they do not need a slow hash.
+type APIKey struct {
+	// The public identifier embedded in the key, used to look it up.
+	ID string `json:"id"`
+	// Hex encoded SHA-256 hash of the whole key.
+	Hash string `json:"hash"`
+	// The subject of the principal the key authenticates, such as the name of the integration.
+	Subject string `json:"subject"`
+	// The scopes granted to the key.
+	Scopes []string `json:"scopes,omitempty"`
+	// The time the key stops working. The key never expires if it is zero.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IAPIKeyStore looks up API keys by their ID.
+type IAPIKeyStore interface {
+	// GetAPIKey returns the key with the provided ID or ErrAPIKeyNotFound.
+	GetAPIKey(ctx context.Context, id string) (APIKey, error)
+}
+
+// MemoryAPIKeyStore is an in-memory `IAPIKeyStore`.
+// It is safe for concurrent use and is useful for tests and for keys loaded from configuration.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+// Initializes the MemoryAPIKeyStore with the provided keys.
+func NewMemoryAPIKeyStore(keys ...APIKey) *MemoryAPIKeyStore {
+	store := &MemoryAPIKeyStore{keys: make(map[string]APIKey, len(keys))}
+	for _, key := range keys {
+		store.keys[key.ID] = key
+	}
+	return store
+}
+
+// GetAPIKey returns the key with the provided ID.
+func (s *MemoryAPIKeyStore) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// SaveAPIKey adds the key or replaces the key with the same ID.
+func (s *MemoryAPIKeyStore) SaveAPIKey(key APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = key
+}
+
+// DeleteAPIKey removes the key with the provided ID.
+func (s *MemoryAPIKeyStore) DeleteAPIKey(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, id)
+}
+
+// Returns the hex encoded SHA-256 hash an API key is stored under.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey creates a new API key in the form `<prefix>_<id>_<secret>`.
+// It returns the key, which must be handed to the client and is not stored anywhere, and the
+// record to save in the store. The Subject, Scopes and ExpiresAt of the record can be filled in
+// before saving it. If the prefix is empty DefaultAPIKeyPrefix is used.
+func GenerateAPIKey(prefix string) (string, APIKey, error) {
+	if prefix == "" {
+		prefix = DefaultAPIKeyPrefix
+	}
+
+	random := make([]byte, apiKeyIDSize+apiKeySecretSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", APIKey{}, fmt.Errorf("an error occurred while generating API key: %v", err)
+	}
+	id := hex.EncodeToString(random[:apiKeyIDSize])
+	key := prefix + "_" + id + "_" + hex.EncodeToString(random[apiKeyIDSize:])
+
+	return key, APIKey{ID: id, Hash: hashAPIKey(key)}, nil
+}
+
+// Returns the ID embedded in a key generated by `GenerateAPIKey`.
+func apiKeyID(key string) (string, bool) {
+	rest, secret, ok := cutLast(key, "_")
+	if !ok || len(secret) != hex.EncodedLen(apiKeySecretSize) {
+		return "", false
+	}
+	_, id, ok := cutLast(rest, "_")
+	if !ok || len(id) != hex.EncodedLen(apiKeyIDSize) {
+		return "", false
+	}
+	return id, true
+}
+
+func cutLast(s string, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// VerifyAPIKey looks up the key in the store and checks it.
+// The hash of the key is compared in constant time. It returns ErrAPIKeyInvalid for unknown or
+// wrong keys and ErrAPIKeyExpired for expired keys.
+func VerifyAPIKey(ctx context.Context, store IAPIKeyStore, key string) (APIKey, error) {
+	id, ok := apiKeyID(key)
+	if !ok {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+
+	stored, err := store.GetAPIKey(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("an error occurred while loading API key: %v", err)
+	}
+
+	want, err := hex.DecodeString(stored.Hash)
+	if err != nil {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	got := sha256.Sum256([]byte(key))
+	if subtle.ConstantTimeCompare(got[:], want) != 1 {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	if !stored.ExpiresAt.IsZero() && !time.Now().Before(stored.ExpiresAt) {
+		return APIKey{}, ErrAPIKeyExpired
+	}
+	return stored, nil
+}
+
+// APIKeyMiddleware is a middleware that authenticates requests with API keys.
+// The key is read from the DefaultAPIKeyHeader header unless other extractors are provided with
+// WithTokenExtractors, for example `QueryTokenExtractor("api_key")`. It is verified against the
+// store using `VerifyAPIKey` and a `*Principal` with the subject and scopes of the key is stored
+// in the request context under PrincipalKey.
+//
+// It accepts the same options as `DefaultAuthMiddleware`. Rejected requests get a 401 response
+// with a JSON body in the shape of `WriteErrorToResponse`.
+func APIKeyMiddleware(store IAPIKeyStore, logger ILogger, opts ...AuthMiddlewareOption) Middleware {
+	extractors := []TokenExtractor{HeaderTokenExtractor(DefaultAPIKeyHeader)}
+	options := newAuthMiddlewareOptions(extractors, opts, func(w http.ResponseWriter, realm string, err error) {
+		writeUnauthorized(w, "APIKey", realm, err)
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := extractToken(r, options.extractors)
+			if key == "" {
+				if options.allowAnonymous {
+					next.ServeHTTP(w, r)
+					return
+				}
+				options.unauthorized(w, r, ErrAPIKeyMissing)
+				return
+			}
+
+			apiKey, err := VerifyAPIKey(r.Context(), store, key)
+			if err != nil {
+				logger.Errorf("Invalid API key: %v", err)
+				options.unauthorized(w, r, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), PrincipalKey, &Principal{
+				Subject: apiKey.Subject,
+				Method:  AuthMethodAPIKey,
+				Scopes:  apiKey.Scopes,
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
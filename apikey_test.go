@@ -0,0 +1,183 @@
+package grove_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func testAPIKey(t *testing.T, subject string, scopes []string, expiresAt time.Time) (string, grove.APIKey) {
+	t.Helper()
+
+	key, record, err := grove.GenerateAPIKey("test")
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v; want nil", err)
+	}
+	record.Subject = subject
+	record.Scopes = scopes
+	record.ExpiresAt = expiresAt
+	return key, record
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, record, err := grove.GenerateAPIKey("")
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v; want nil", err)
+	}
+	if !strings.HasPrefix(key, grove.DefaultAPIKeyPrefix+"_"+record.ID+"_") {
+		t.Fatalf("key = %q; want prefix %s_%s_", key, grove.DefaultAPIKeyPrefix, record.ID)
+	}
+	if strings.Contains(record.Hash, key) || record.Hash == "" {
+		t.Fatalf("Hash = %q; want a hash of the key", record.Hash)
+	}
+
+	other, _, err := grove.GenerateAPIKey("")
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v; want nil", err)
+	}
+	if other == key {
+		t.Fatalf("GenerateAPIKey() returned the same key twice")
+	}
+}
+
+func TestVerifyAPIKey(t *testing.T) {
+	valid, validRecord := testAPIKey(t, "billing", nil, time.Time{})
+	expired, expiredRecord := testAPIKey(t, "billing", nil, time.Now().Add(-time.Minute))
+	unknown, _ := testAPIKey(t, "billing", nil, time.Time{})
+	store := grove.NewMemoryAPIKeyStore(validRecord, expiredRecord)
+
+	// Same ID as a stored key but a different secret.
+	forged := valid[:strings.LastIndex(valid, "_")+1] + strings.Repeat("0", 64)
+
+	tests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{name: "valid", key: valid},
+		{name: "expired", key: expired, want: grove.ErrAPIKeyExpired},
+		{name: "unknown", key: unknown, want: grove.ErrAPIKeyInvalid},
+		{name: "wrong secret", key: forged, want: grove.ErrAPIKeyInvalid},
+		{name: "malformed", key: "not-an-api-key", want: grove.ErrAPIKeyInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := grove.VerifyAPIKey(context.Background(), store, tt.key)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyAPIKey() error = %v; want %v", err, tt.want)
+			}
+			if tt.want == nil && record.Subject != "billing" {
+				t.Fatalf("Subject = %q; want billing", record.Subject)
+			}
+		})
+	}
+
+	store.DeleteAPIKey(validRecord.ID)
+	if _, err := grove.VerifyAPIKey(context.Background(), store, valid); !errors.Is(err, grove.ErrAPIKeyInvalid) {
+		t.Fatalf("VerifyAPIKey() with deleted key error = %v; want %v", err, grove.ErrAPIKeyInvalid)
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	key, record := testAPIKey(t, "billing", []string{"orders:read"}, time.Time{})
+	store := grove.NewMemoryAPIKeyStore(record)
+
+	scope := grove.NewScope("test").
+		WithMiddleware(grove.APIKeyMiddleware(store, &testLogger{})).
+		WithRoute("GET /orders", grove.RequireScopes("orders:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := grove.PrincipalFromContext(r.Context())
+			if !ok {
+				t.Errorf("PrincipalFromContext() ok = false; want true")
+				return
+			}
+			_, _ = w.Write([]byte(principal.Subject + " " + string(principal.Method)))
+		}))).
+		WithRoute("POST /orders", grove.RequireScopes("orders:write")(http.NotFoundHandler()))
+
+	tests := []struct {
+		name     string
+		method   string
+		key      string
+		want     int
+		wantBody string
+	}{
+		{name: "valid key", method: http.MethodGet, key: key, want: http.StatusOK, wantBody: "billing api_key"},
+		{name: "missing scope", method: http.MethodPost, key: key, want: http.StatusForbidden},
+		{name: "missing key", method: http.MethodGet, want: http.StatusUnauthorized},
+		{name: "invalid key", method: http.MethodGet, key: "test_invalid", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/orders", nil)
+			if tt.key != "" {
+				req.Header.Set(grove.DefaultAPIKeyHeader, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			scope.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Fatalf("body = %q; want %q", rec.Body.String(), tt.wantBody)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); tt.want == http.StatusUnauthorized && (!strings.HasPrefix(challenge, "APIKey") || strings.Contains(challenge, "error=")) {
+				t.Fatalf("WWW-Authenticate = %q; want an APIKey challenge without a Bearer error code", challenge)
+			}
+			if tt.want == http.StatusForbidden && rec.Header().Get("WWW-Authenticate") != "" {
+				t.Fatalf("WWW-Authenticate = %q; want no Bearer challenge for an API key", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddlewareWithQueryParameter(t *testing.T) {
+	key, record := testAPIKey(t, "billing", nil, time.Time{})
+	handler := grove.APIKeyMiddleware(
+		grove.NewMemoryAPIKeyStore(record),
+		&testLogger{},
+		grove.WithTokenExtractors(grove.QueryTokenExtractor("api_key")),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/?api_key="+key, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestDefaultAuthMiddlewareStoresPrincipal(t *testing.T) {
+	auth := testAuthenticator(t)
+	claims := validClaims()
+	claims.Subject = "user-1"
+	token, err := auth.GenerateToken(claims)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	var principal *grove.Principal
+	handler := grove.DefaultAuthMiddleware(auth, &testLogger{}, func() *TestClaims { return &TestClaims{} })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ = grove.PrincipalFromContext(r.Context())
+		}),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if principal == nil || principal.Subject != "user-1" || principal.Method != grove.AuthMethodJWT {
+		t.Fatalf("principal = %+v; want subject user-1 authenticated with jwt", principal)
+	}
+}
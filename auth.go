@@ -1,11 +1,12 @@
 package grove
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"errors"
 	"fmt"
-	"os"
 	"slices"
 	"strconv"
 	"strings"
@@ -25,12 +26,117 @@ type AuthenticatorConfig struct {
 	JWEPrivateKey *rsa.PrivateKey
 	// Used to calculate the expiration date of the JWT
 	Lifetime time.Duration
-	// Issuer field for the generated JWT
+	// Issuer field for the generated JWT, it is also the issuer required by VerifyToken
 	Issuer string
-	// Audience field for the generated JWT
+	// Audience field for the generated JWT, it is also the audience required by VerifyToken
 	Audience []string
-	// The key used to sign the JWT
+	// How the audiences of a token are compared to Audience when verifying it.
+	// The default, AudienceMatchAny, accepts tokens that contain at least one of them.
+	AudienceMatch AudienceMatch
+	// The key used to sign the JWT when an HMAC SigningAlgorithm is used.
 	Key string
+	// The algorithm used to sign the JWT. Supported values are HS256, HS384, HS512,
+	// RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512 and EdDSA.
+	// If it is empty HS256 is used. VerifyToken only accepts tokens signed with the algorithm
+	// of the key selected by their `kid` header.
+	SigningAlgorithm string
+	// The private key used to sign the JWT when an asymmetric SigningAlgorithm is used.
+	// It must be an *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey that matches
+	// the algorithm. Its public key is used to verify tokens.
+	SigningKey crypto.Signer
+	// Identifier of the signing key. It is written to the `kid` header of generated tokens.
+	KeyID string
+	// Keys that are only used to verify tokens, such as keys that were rotated out.
+	// The key is selected using the `kid` header of the token.
+	VerificationKeys []JWTKey
+	// Identifier of JWEPrivateKey. It is written to the `kid` header of generated JWEs.
+	JWEKeyID string
+	// Keys that are only used to decrypt JWEs, such as keys that were rotated out.
+	// The key is selected using the `kid` header of the JWE.
+	JWEDecryptionKeys []JWEKey
+	// The key management algorithm used to encrypt the JWT. Defaults to RSA-OAEP.
+	// RSA-OAEP and RSA-OAEP-256 use JWEPrivateKey, ECDH-ES and its key wrapping variants use
+	// JWEECDHKey, and dir, A128KW, A192KW and A256KW use JWESharedKey.
+	JWEKeyAlgorithm jose.KeyAlgorithm
+	// The content encryption algorithm used to encrypt the JWT. Defaults to A128GCM.
+	JWEContentEncryption jose.ContentEncryption
+	// The private key used for the ECDH-ES key management algorithms.
+	JWEECDHKey *ecdsa.PrivateKey
+	// The symmetric key used for dir and AES key wrapping. For dir its size must match
+	// the content encryption, e.g. 32 bytes for A256GCM.
+	JWESharedKey []byte
+	// The key management algorithms accepted when decrypting.
+	// If empty only the algorithms of the configured JWE keys are accepted.
+	JWEAllowedKeyAlgorithms []jose.KeyAlgorithm
+	// The content encryption algorithms accepted when decrypting.
+	// If empty only JWEContentEncryption is accepted.
+	JWEAllowedContentEncryptions []jose.ContentEncryption
+	// The amount of clock skew tolerated when validating the exp, nbf and iat claims.
+	Leeway time.Duration
+	// Requires tokens to have an nbf claim. The claim is always validated when it is present.
+	RequireNotBefore bool
+	// Requires tokens to have an iat claim that is not in the future.
+	RequireIssuedAt bool
+	// The maximum age of a token measured from its iat claim, regardless of its expiration.
+	// Setting it requires tokens to have an iat claim. Zero disables the check.
+	MaxTokenAge time.Duration
+	// Returns the current time. It is used for every time based check and defaults to time.Now.
+	// It is mostly useful to test expiration deterministically.
+	Clock func() time.Time
+	// Stores the refresh tokens issued by IssueRefreshToken. Refresh tokens are disabled when it is nil.
+	RefreshTokenStore IRefreshTokenStore
+	// How long a refresh token can be used. If it is zero DefaultRefreshTokenLifetime is used.
+	RefreshTokenLifetime time.Duration
+	// Consulted by VerifyToken to reject tokens that were revoked before they expired.
+	// Revocation is disabled when it is nil.
+	RevocationStore IRevocationStore
+	// Settings of the session cookie written by SetSessionCookie and read by DefaultAuthMiddleware.
+	SessionCookie SessionCookieConfig
+	// How long clients may cache the JWKS document served by JWKSHandler.
+	// If it is zero DefaultJWKSCacheMaxAge is used.
+	JWKSCacheMaxAge time.Duration
+	// How long the token issued between the password and the second factor can be used.
+	// If it is zero DefaultMFAPendingTokenLifetime is used.
+	MFAPendingTokenLifetime time.Duration
+}
+
+// AudienceMatch controls how the `aud` claim of a token is compared to the configured audiences.
+type AudienceMatch int
+
+const (
+	// The token must contain at least one of the configured audiences.
+	AudienceMatchAny AudienceMatch = iota
+	// The token must contain every configured audience.
+	AudienceMatchAll
+)
+
+// Parses "any" or "all" into an AudienceMatch.
+func ParseAudienceMatch(value string) (AudienceMatch, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "any":
+		return AudienceMatchAny, nil
+	case "all":
+		return AudienceMatchAll, nil
+	}
+	return AudienceMatchAny, fmt.Errorf("unknown audience match: %q", value)
+}
+
+func (match AudienceMatch) String() string {
+	switch match {
+	case AudienceMatchAny:
+		return "any"
+	case AudienceMatchAll:
+		return "all"
+	}
+	return "AudienceMatch(" + strconv.Itoa(int(match)) + ")"
+}
+
+// Returns the parser option that enforces the audiences with this match mode.
+func (match AudienceMatch) parserOption(audience []string) jwt.ParserOption {
+	if match == AudienceMatchAll {
+		return jwt.WithAllAudiences(audience...)
+	}
+	return jwt.WithAudience(audience...)
 }
 
 // Initializes the `AuthenticatorConfig`.
@@ -49,8 +155,10 @@ func NewAuthenticatorConfig(canEncrypt bool, jwePrivateKey *rsa.PrivateKey, life
 // If any values are missing it will return an error.
 // If it is valid it will return nil.
 func (config *AuthenticatorConfig) Validate() error {
-	if config.CanEncrypt && config.JWEPrivateKey == nil {
-		return fmt.Errorf("JWEPrivateKey is required")
+	if config.CanEncrypt {
+		if err := config.validateJWE(); err != nil {
+			return err
+		}
 	}
 	if config.Lifetime <= 0 {
 		return fmt.Errorf("lifetime must be greater than zero")
@@ -61,83 +169,330 @@ func (config *AuthenticatorConfig) Validate() error {
 	if len(config.Audience) == 0 {
 		return fmt.Errorf("audience must contain at least one value")
 	}
-	if config.Key == "" {
-		return fmt.Errorf("key is required")
+	if slices.Contains(config.Audience, config.mfaPendingAudience()) {
+		return fmt.Errorf("audience %q is reserved for MFA pending tokens", config.mfaPendingAudience())
+	}
+	if slices.Contains(config.Audience, config.oidcStateAudience()) {
+		return fmt.Errorf("audience %q is reserved for the OIDC state", config.oidcStateAudience())
+	}
+	if config.AudienceMatch != AudienceMatchAny && config.AudienceMatch != AudienceMatchAll {
+		return fmt.Errorf("unknown audience match: %s", config.AudienceMatch)
+	}
+	if config.Leeway < 0 {
+		return fmt.Errorf("leeway cannot be negative")
+	}
+	if config.MaxTokenAge < 0 {
+		return fmt.Errorf("max token age cannot be negative")
+	}
+	if config.RefreshTokenLifetime < 0 {
+		return fmt.Errorf("refresh token lifetime cannot be negative")
+	}
+	if config.MFAPendingTokenLifetime < 0 {
+		return fmt.Errorf("MFA pending token lifetime cannot be negative")
+	}
+	if err := config.SessionCookie.Validate(); err != nil {
+		return err
+	}
+	method, err := config.signingMethod()
+	if err != nil {
+		return err
+	}
+	if isHMACSigningMethod(method) {
+		if config.Key == "" {
+			return fmt.Errorf("key is required")
+		}
+	} else if err := validateSigningKey(method, config.SigningKey); err != nil {
+		return err
+	}
+	for i, key := range config.VerificationKeys {
+		if key.ID == "" {
+			return fmt.Errorf("verification keys require an ID")
+		}
+		if key.ID == config.KeyID {
+			return fmt.Errorf("verification key %q has the same ID as the signing key", key.ID)
+		}
+		if slices.ContainsFunc(config.VerificationKeys[:i], func(other JWTKey) bool { return other.ID == key.ID }) {
+			return fmt.Errorf("verification key ID %q is used more than once", key.ID)
+		}
+		if _, err := key.resolve(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Validates the JWE keys and algorithms.
+func (config *AuthenticatorConfig) validateJWE() error {
+	key := config.jweKey()
+	if key.Key == nil {
+		switch key.Algorithm {
+		case jose.RSA_OAEP, jose.RSA_OAEP_256:
+			return fmt.Errorf("JWEPrivateKey is required")
+		case jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW:
+			return fmt.Errorf("JWEECDHKey is required")
+		case jose.DIRECT, jose.A128KW, jose.A192KW, jose.A256KW:
+			return fmt.Errorf("JWESharedKey is required")
+		}
+	}
+
+	contentEncryption := config.jweContentEncryption()
+	if jweSymmetricKeySize(jose.DIRECT, contentEncryption) == 0 {
+		return fmt.Errorf("unsupported content encryption: %s", contentEncryption)
+	}
+	if err := key.validate(contentEncryption); err != nil {
+		return err
+	}
+	for _, key := range config.JWEDecryptionKeys {
+		if err := config.withDefaultJWEAlgorithm(key).validate(contentEncryption); err != nil {
+			return err
+		}
+	}
+	for _, enc := range config.JWEAllowedContentEncryptions {
+		if jweSymmetricKeySize(jose.DIRECT, enc) == 0 {
+			return fmt.Errorf("unsupported content encryption: %s", enc)
+		}
+	}
+	return nil
+}
+
+// Returns the current time using the configured Clock.
+func (config *AuthenticatorConfig) now() time.Time {
+	if config.Clock == nil {
+		return time.Now()
+	}
+	return config.Clock()
+}
+
+func (config *AuthenticatorConfig) jweKeyAlgorithm() jose.KeyAlgorithm {
+	if config.JWEKeyAlgorithm == "" {
+		return jose.RSA_OAEP
+	}
+	return config.JWEKeyAlgorithm
+}
+
+func (config *AuthenticatorConfig) jweContentEncryption() jose.ContentEncryption {
+	if config.JWEContentEncryption == "" {
+		return jose.A128GCM
+	}
+	return config.JWEContentEncryption
+}
+
+func (config *AuthenticatorConfig) withDefaultJWEAlgorithm(key JWEKey) JWEKey {
+	if key.Algorithm == "" {
+		key.Algorithm = config.jweKeyAlgorithm()
+	}
+	return key
+}
+
+// Returns the configured JWE key, picking the key field that matches JWEKeyAlgorithm.
+func (config *AuthenticatorConfig) jweKey() JWEKey {
+	key := JWEKey{ID: config.JWEKeyID, Algorithm: config.jweKeyAlgorithm()}
+	switch key.Algorithm {
+	case jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW:
+		if config.JWEECDHKey != nil {
+			key.Key = config.JWEECDHKey
+		}
+	case jose.DIRECT, jose.A128KW, jose.A192KW, jose.A256KW:
+		if config.JWESharedKey != nil {
+			key.Key = config.JWESharedKey
+		}
+	default:
+		if config.JWEPrivateKey != nil {
+			key.Key = config.JWEPrivateKey
+		}
+	}
+	return key
+}
+
+// Returns the jwt signing method for the configured SigningAlgorithm.
+// An empty algorithm defaults to HS256.
+func (config *AuthenticatorConfig) signingMethod() (jwt.SigningMethod, error) {
+	return signingMethodFor(config.SigningAlgorithm)
+}
+
+func signingMethodFor(algorithm string) (jwt.SigningMethod, error) {
+	if algorithm == "" {
+		return jwt.SigningMethodHS256, nil
+	}
+	if algorithm == "none" {
+		return nil, fmt.Errorf("signing algorithm none is not allowed")
+	}
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	return method, nil
+}
+
+func isHMACSigningMethod(method jwt.SigningMethod) bool {
+	_, ok := method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// Checks that the private key is usable with the provided asymmetric signing method.
+func validateSigningKey(method jwt.SigningMethod, key crypto.Signer) error {
+	if key == nil {
+		return fmt.Errorf("signing key is required for %s", method.Alg())
+	}
+	return validateVerificationKey(method, key.Public())
+}
+
 // Loads the AuthenticatorConfig values from ENV variables.
 //
 // The list of ENV variables that need to be set are as follows:
 //
-//   - JWT_PRIVATE_KEY_PATH
-//     Path to the PEM file.
-//   - JWT_LIFETIME
-//     The integer value in terms of minutes.
 //   - JWT_ISSUER
 //   - JWT_AUDIENCE
+//     A comma separated list of audiences. Empty entries are ignored.
 //   - JWT_SECRET
-//     This is just a string value.
-func LoadAuthenticatorConfigFromEnv() (*AuthenticatorConfig, error) {
-	canEncrypt, err := strconv.ParseBool(os.Getenv("JWT_CAN_ENCRYPT"))
+//     This is just a string value. It is only required for HMAC signing algorithms.
+//
+// The following ENV variables are optional:
+//
+//   - JWT_CAN_ENCRYPT
+//     Whether tokens are encrypted. Defaults to true when a JWE private key is configured.
+//   - JWT_PRIVATE_KEY or JWT_PRIVATE_KEY_PATH
+//     The PEM encoded JWE private key, or the path to the PEM file. Required for encryption.
+//     An RSA key is used with RSA-OAEP and an EC key with ECDH-ES.
+//   - JWT_LIFETIME
+//     A duration such as `15m` or `1h`. A plain integer is a number of minutes. Defaults to 2 minutes.
+//   - JWT_SIGNING_ALGORITHM
+//     The algorithm used to sign the JWT. Defaults to HS256.
+//   - JWT_SIGNING_KEY or JWT_SIGNING_KEY_PATH
+//     The PEM encoded signing key, or the path to the PEM file. Required for asymmetric algorithms.
+//   - JWT_AUDIENCE_MATCH
+//     Either "any" (default) or "all". See AudienceMatch.
+//   - JWT_JWE_KEY_ALGORITHM
+//     The JWE key management algorithm used with the JWE key, such as RSA-OAEP-256 or ECDH-ES+A256KW.
+//   - JWT_JWE_CONTENT_ENCRYPTION
+//     The JWE content encryption algorithm. Defaults to A128GCM.
+//
+// Private keys can be PKCS#8, PKCS#1 or SEC 1 PEM blocks, see `ParsePrivateKeyPEM`.
+// Every variable can also be read from a file by setting the variable with a `_FILE` suffix to
+// its path, e.g. `JWT_SECRET_FILE=/run/secrets/jwt_secret`. The options add a prefix to the
+// names or a directory of secret files, see WithEnvPrefix and WithSecretsDirectory.
+func LoadAuthenticatorConfigFromEnv(opts ...EnvOption) (*AuthenticatorConfig, error) {
+	env := newEnvOptions(opts)
+
+	jweKey, err := env.privateKey("JWT_PRIVATE_KEY", "JWT_PRIVATE_KEY_PATH")
 	if err != nil {
-		return nil, fmt.Errorf("an error occurred while parsing JWT can encrypt")
+		return nil, err
 	}
 
-	var rsaKey *rsa.PrivateKey
-	if canEncrypt {
-		jwePem, err := os.ReadFile(os.Getenv("JWT_PRIVATE_KEY_PATH"))
-		if err != nil {
-			return nil, fmt.Errorf("an error occurred while reading JWE private key: %v", err)
-		}
-		block, _ := pem.Decode(jwePem)
-		if block == nil {
-			return nil, fmt.Errorf("an error occurred while decoding JWE private key")
+	canEncrypt := jweKey != nil
+	canEncryptSetting, ok, err := env.lookup("JWT_CAN_ENCRYPT")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if canEncrypt, err = strconv.ParseBool(canEncryptSetting); err != nil {
+			return nil, fmt.Errorf("an error occurred while parsing %s: %v", env.name("JWT_CAN_ENCRYPT"), err)
 		}
+	}
+	if canEncrypt && jweKey == nil {
+		return nil, fmt.Errorf("%s or %s was not set", env.name("JWT_PRIVATE_KEY"), env.name("JWT_PRIVATE_KEY_PATH"))
+	}
 
-		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	lifetime := 2 * time.Minute
+	lifetimeSetting, ok, err := env.lookup("JWT_LIFETIME")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		lifetime, err = parseEnvDuration(lifetimeSetting, time.Minute)
 		if err != nil {
-			return nil, fmt.Errorf("an error occurred while parsing JWE private key: %v", err)
+			return nil, fmt.Errorf("an error occurred while loading jwt lifetime: %v", err)
+		}
+		if lifetime < 0 {
+			return nil, fmt.Errorf("%s cannot be negative", env.name("JWT_LIFETIME"))
 		}
-		if r, ok := privateKey.(*rsa.PrivateKey); !ok {
-			return nil, fmt.Errorf("an error occurred while converting JWE private key to RSA: %v", err)
-		} else {
-			rsaKey = r
+		if lifetime == 0 {
+			lifetime = 2 * time.Minute
 		}
 	}
 
-	lifetimeSetting := os.Getenv("JWT_LIFETIME")
-	var lifetime time.Duration
-	if lifetimeSetting != "" {
-		l, err := strconv.ParseInt(lifetimeSetting, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("an error occurred while loading jwt lifetime: %v", err)
+	issuer, ok, err := env.lookup("JWT_ISSUER")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s was not set", env.name("JWT_ISSUER"))
+	}
+
+	audienceSetting, ok, err := env.lookup("JWT_AUDIENCE")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s was not set", env.name("JWT_AUDIENCE"))
+	}
+	audience := make([]string, 0)
+	for _, value := range strings.Split(audienceSetting, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			audience = append(audience, value)
 		}
-		lifetime = time.Duration(time.Duration(l) * time.Minute)
 	}
-	if lifetime == 0 {
-		lifetime = time.Duration(2 * time.Minute)
+	slices.Sort(audience)
+
+	settings := make(map[string]string)
+	for _, name := range []string{"JWT_SECRET", "JWT_AUDIENCE_MATCH", "JWT_SIGNING_ALGORITHM", "JWT_JWE_KEY_ALGORITHM", "JWT_JWE_CONTENT_ENCRYPTION"} {
+		value, _, err := env.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		settings[name] = value
 	}
 
-	issuer := os.Getenv("JWT_ISSUER")
-	if issuer == "" {
-		return nil, fmt.Errorf("JWT_ISSUER was not set")
+	audienceMatch := AudienceMatchAny
+	if settings["JWT_AUDIENCE_MATCH"] != "" {
+		audienceMatch, err = ParseAudienceMatch(settings["JWT_AUDIENCE_MATCH"])
+		if err != nil {
+			return nil, fmt.Errorf("an error occurred while loading JWT audience match: %v", err)
+		}
 	}
 
-	audienceSetting := os.Getenv("JWT_AUDIENCE")
-	if audienceSetting == "" {
-		return nil, fmt.Errorf("JWT_AUDIENCE was not set")
+	jwtConfig := NewAuthenticatorConfig(canEncrypt, nil, lifetime, issuer, audience, settings["JWT_SECRET"])
+	jwtConfig.AudienceMatch = audienceMatch
+	jwtConfig.SigningAlgorithm = settings["JWT_SIGNING_ALGORITHM"]
+	jwtConfig.JWEKeyAlgorithm = jose.KeyAlgorithm(settings["JWT_JWE_KEY_ALGORITHM"])
+	jwtConfig.JWEContentEncryption = jose.ContentEncryption(settings["JWT_JWE_CONTENT_ENCRYPTION"])
+	switch key := jweKey.(type) {
+	case nil:
+	case *rsa.PrivateKey:
+		jwtConfig.JWEPrivateKey = key
+	case *ecdsa.PrivateKey:
+		jwtConfig.JWEECDHKey = key
+		if jwtConfig.JWEKeyAlgorithm == "" {
+			jwtConfig.JWEKeyAlgorithm = jose.ECDH_ES
+		}
+	default:
+		return nil, fmt.Errorf("JWE private key of type %T is not supported", jweKey)
+	}
+	if canEncrypt {
+		if err := jwtConfig.validateJWE(); err != nil {
+			return nil, fmt.Errorf("an error occurred while loading JWE configuration: %v", err)
+		}
 	}
-	audience := strings.Split(audienceSetting, ",")
-	slices.Sort(audience)
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return nil, fmt.Errorf("JWT_SECRET was not set")
+	method, err := jwtConfig.signingMethod()
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while loading JWT signing algorithm: %v", err)
+	}
+	if isHMACSigningMethod(method) {
+		if jwtConfig.Key == "" {
+			return nil, fmt.Errorf("%s was not set", env.name("JWT_SECRET"))
+		}
+		return jwtConfig, nil
 	}
 
-	jwtConfig := NewAuthenticatorConfig(canEncrypt, rsaKey, lifetime, issuer, audience, jwtSecret)
+	signingKey, err := env.privateKey("JWT_SIGNING_KEY", "JWT_SIGNING_KEY_PATH")
+	if err != nil {
+		return nil, err
+	}
+	if signingKey == nil {
+		return nil, fmt.Errorf("%s or %s was not set", env.name("JWT_SIGNING_KEY"), env.name("JWT_SIGNING_KEY_PATH"))
+	}
+	jwtConfig.SigningKey = signingKey
 
 	return jwtConfig, nil
 }
@@ -145,13 +500,20 @@ func LoadAuthenticatorConfigFromEnv() (*AuthenticatorConfig, error) {
 // Initializes the Authenticator.
 // It takes a type argument that implements `jwt.Claims` in order to know how to parse and
 // create JWTs.
-// If the provided configuration is nil it will return an error.
+// If the provided configuration is nil, or its keys cannot be used, it will return an error.
+// The keys in the configuration are copied into the Authenticator, use the Rotate functions to
+// change them at runtime.
 func NewAuthenticator[T jwt.Claims](config *AuthenticatorConfig) (*Authenticator[T], error) {
 	if config == nil {
 		return nil, fmt.Errorf("Tried to initialize Authenticator with nil configuration.")
 	}
+	keys, err := newKeyring(config)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while loading Authenticator keys: %v", err)
+	}
 	return &Authenticator[T]{
 		AuthenticatorConfig: config,
+		keys:                keys,
 	}, nil
 }
 
@@ -159,10 +521,16 @@ func NewAuthenticator[T jwt.Claims](config *AuthenticatorConfig) (*Authenticator
 // To initialize it you have to provide the AuthenticatorConfig.
 type Authenticator[T jwt.Claims] struct {
 	*AuthenticatorConfig
+	keys *keyring
 }
 
 func (a *Authenticator[T]) encryptToken(token string) (string, error) {
-	encryptor, err := jose.NewEncrypter(jose.A128GCM, jose.Recipient{Algorithm: jose.RSA_OAEP, Key: &a.JWEPrivateKey.PublicKey}, nil)
+	key := a.keys.encryptionKey()
+	if key.Key == nil {
+		return "", fmt.Errorf("no JWE key is configured")
+	}
+	recipient := jose.Recipient{Algorithm: key.Algorithm, Key: key.encryptionKey(), KeyID: key.ID}
+	encryptor, err := jose.NewEncrypter(a.jweContentEncryption(), recipient, nil)
 	if err != nil {
 		return "", fmt.Errorf("an error occurred while creating encrypter: %v", err)
 	}
@@ -181,12 +549,29 @@ func (a *Authenticator[T]) encryptToken(token string) (string, error) {
 }
 
 func (a *Authenticator[T]) decryptToken(encrypted string) (string, error) {
-	parsedCompact, err := jose.ParseEncrypted(encrypted, []jose.KeyAlgorithm{jose.RSA_OAEP}, []jose.ContentEncryption{jose.A128GCM})
+	keyAlgorithms := a.JWEAllowedKeyAlgorithms
+	if len(keyAlgorithms) == 0 {
+		keyAlgorithms = a.keys.jweAlgorithms()
+	}
+	contentEncryptions := a.JWEAllowedContentEncryptions
+	if len(contentEncryptions) == 0 {
+		contentEncryptions = []jose.ContentEncryption{a.jweContentEncryption()}
+	}
+
+	parsedCompact, err := jose.ParseEncrypted(encrypted, keyAlgorithms, contentEncryptions)
 	if err != nil {
 		return "", fmt.Errorf("an error occurred while parsing JWE: %v", err)
 	}
 
-	tokenBytes, err := parsedCompact.Decrypt(a.JWEPrivateKey)
+	key, ok := a.keys.decryptionKey(parsedCompact.Header.KeyID)
+	if !ok {
+		return "", fmt.Errorf("unknown JWE key: %q", parsedCompact.Header.KeyID)
+	}
+	if !jweKeyFitsAlgorithm(key.Key, jose.KeyAlgorithm(parsedCompact.Header.Algorithm)) {
+		return "", fmt.Errorf("JWE key %q cannot be used with %s", key.ID, parsedCompact.Header.Algorithm)
+	}
+
+	tokenBytes, err := parsedCompact.Decrypt(key.Key)
 	if err != nil {
 		return "", fmt.Errorf("an error occurred while decrypting JWE: %v", err)
 	}
@@ -194,13 +579,46 @@ func (a *Authenticator[T]) decryptToken(encrypted string) (string, error) {
 	return string(tokenBytes), nil
 }
 
+// Returns the key used to verify the signature of a token.
+// The key is selected with the `kid` header and the token must be signed with the algorithm
+// that belongs to that key.
+func (a *Authenticator[T]) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := a.keys.verificationKey(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+	if token.Method == nil || token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing algorithm: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
 // GenerateToken creates a new JWT token with the provided claims, signs it, and encrypts it.
-// The token is signed using the configured key and encrypted using JWE with RSA-OAEP
-// and A128GCM.
+// Registered claims that are not set are filled in from the configuration before signing:
+// iss and aud from Issuer and Audience, exp from Lifetime, iat and nbf from the current time,
+// and a random jti. Claims that are already set are kept, so any of them can be overridden.
+// The claims are updated in place, letting the caller read the generated values.
+// The token is signed using the active signing key and encrypted using JWE with the configured
+// JWEKeyAlgorithm and JWEContentEncryption. The IDs of the keys are written to the `kid` headers.
 // The generated token is suitable for use in authentication and authorization processes.
 func (a *Authenticator[T]) GenerateToken(claims T) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedString, err := token.SignedString([]byte(a.Key))
+	return a.generateToken(claims, "")
+}
+
+// Stamps, signs and encrypts the claims. A non-empty tokenType is written to the `typ` header.
+func (a *Authenticator[T]) generateToken(claims jwt.Claims, tokenType string) (string, error) {
+	a.stampRegisteredClaims(claims)
+	key := a.keys.signingKey()
+
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.id != "" {
+		token.Header["kid"] = key.id
+	}
+	if tokenType != "" {
+		token.Header["typ"] = tokenType
+	}
+	signedString, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", fmt.Errorf("an error occurred while signing jwt: %v", err)
 	}
@@ -229,9 +647,7 @@ func (a *Authenticator[T]) ParseToken(token string, claims T) (*jwt.Token, error
 	parsedToken, err := jwt.ParseWithClaims(
 		token,
 		claims,
-		func(token *jwt.Token) (any, error) {
-			return []byte(a.Key), nil
-		},
+		a.keyFunc,
 		jwt.WithoutClaimsValidation(),
 	)
 	if err != nil {
@@ -242,39 +658,120 @@ func (a *Authenticator[T]) ParseToken(token string, claims T) (*jwt.Token, error
 }
 
 // VerifyToken decrypts the token, parses it, and validates the claims.
-// It checks the audience and issuer against the configured values.
+// It checks the audience and issuer against the configured values. Whether the token needs
+// one or all of the configured audiences is decided by AudienceMatch.
+// When a RevocationStore is configured, revoked tokens are rejected with ErrTokenRevoked.
+// MFA pending tokens created by GenerateMFAPendingToken are rejected with ErrTokenMFAPending.
+// The returned error wraps one of the ErrToken errors, such as ErrTokenExpired, so callers can
+// tell why the token was rejected using errors.Is.
 // If the token is valid, it returns the claims; otherwise, it returns an error.
 // This method is used to ensure that the token is valid and can be trusted for authentication.
 func (a *Authenticator[T]) VerifyToken(token string, claims T) (T, error) {
+	return a.VerifyTokenContext(context.Background(), token, claims)
+}
+
+// VerifyTokenContext is `VerifyToken` with a context that is passed on to the RevocationStore,
+// so a request that is canceled or past its deadline stops waiting for the store.
+// `DefaultAuthMiddleware` calls it with the context of the request.
+func (a *Authenticator[T]) VerifyTokenContext(ctx context.Context, token string, claims T) (T, error) {
+	parsedToken, err := a.verifyToken(ctx, token, claims, a.Audience)
+	// Tokens of other types fail the audience check, report them by their type instead.
+	if parsedToken != nil {
+		if err := checkAccessTokenType(parsedToken); err != nil {
+			return claims, err
+		}
+	}
+	if err != nil {
+		return claims, err
+	}
+	return parsedToken.Claims.(T), nil
+}
+
+// Returns the `typ` header of the token.
+func tokenTypeOf(token *jwt.Token) string {
+	tokenType, _ := token.Header["typ"].(string)
+	return tokenType
+}
+
+// Rejects the tokens Grove signs for purposes other than access, such as MFA pending tokens.
+// They share the signing keys with access tokens and are told apart by their `typ` header.
+func checkAccessTokenType(token *jwt.Token) error {
+	tokenType := tokenTypeOf(token)
+	switch {
+	case strings.EqualFold(tokenType, MFAPendingTokenType):
+		return ErrTokenMFAPending
+	case strings.EqualFold(tokenType, oidcStateTokenType):
+		return fmt.Errorf("%w: unexpected token type %q", ErrTokenInvalidClaims, tokenType)
+	}
+	return nil
+}
+
+// Decrypts, parses and validates the token regardless of its type, requiring one of the audiences.
+// When only the claims are invalid the token is returned together with the error, its signature
+// has been verified so its header can be trusted.
+func (a *Authenticator[T]) verifyToken(ctx context.Context, token string, claims jwt.Claims, audience []string) (*jwt.Token, error) {
 	if a.CanEncrypt {
 		decryptedToken, err := a.decryptToken(token)
 		if err != nil {
-			return claims, fmt.Errorf("an error occurred while decrypting token while verifying: %v", err)
+			return nil, fmt.Errorf("%w: %w", ErrTokenUndecryptable, err)
 		}
 		token = decryptedToken
 	}
 
 	parserOptions := make([]jwt.ParserOption, 0)
-	for i := range a.Audience {
-		parserOptions = append(parserOptions, jwt.WithAudience(a.Audience[i]))
-	}
+	parserOptions = append(parserOptions, a.AudienceMatch.parserOption(audience))
 	parserOptions = append(parserOptions, jwt.WithIssuer(a.Issuer))
-	parserOptions = append(parserOptions, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	parserOptions = append(parserOptions, jwt.WithValidMethods(a.keys.algorithms()))
 	parserOptions = append(parserOptions, jwt.WithExpirationRequired())
+	parserOptions = append(parserOptions, jwt.WithLeeway(a.Leeway))
+	parserOptions = append(parserOptions, jwt.WithTimeFunc(a.now))
+	if a.RequireIssuedAt || a.MaxTokenAge > 0 {
+		parserOptions = append(parserOptions, jwt.WithIssuedAt())
+	}
 
 	parsedToken, err := jwt.ParseWithClaims(
 		token,
 		claims,
-		func(token *jwt.Token) (any, error) {
-			return []byte(a.Key), nil
-		},
+		a.keyFunc,
 		parserOptions...,
 	)
+	if errors.Is(err, jwt.ErrTokenInvalidClaims) {
+		return parsedToken, classifyJWTError(err)
+	}
 	if err != nil {
-		return claims, fmt.Errorf("an error occurred while parsing JWT: %v", err)
+		return nil, classifyJWTError(err)
 	}
 	if !parsedToken.Valid {
-		return claims, fmt.Errorf("token is not valid")
+		return nil, ErrTokenInvalidClaims
 	}
-	return parsedToken.Claims.(T), nil
+	if err := a.verifyTimeClaims(parsedToken.Claims); err != nil {
+		return nil, err
+	}
+	if err := checkRevocation(ctx, a.RevocationStore, parsedToken.Claims, a.now()); err != nil {
+		return nil, err
+	}
+	return parsedToken, nil
+}
+
+// Checks the time based requirements the jwt parser does not cover: the presence of nbf and iat
+// and the maximum token age.
+func (a *Authenticator[T]) verifyTimeClaims(claims jwt.Claims) error {
+	if a.RequireNotBefore {
+		notBefore, err := claims.GetNotBefore()
+		if err != nil || notBefore == nil {
+			return fmt.Errorf("%w: token is missing the nbf claim", ErrTokenInvalidClaims)
+		}
+	}
+
+	if !a.RequireIssuedAt && a.MaxTokenAge <= 0 {
+		return nil
+	}
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return fmt.Errorf("%w: token is missing the iat claim", ErrTokenInvalidClaims)
+	}
+	if a.MaxTokenAge > 0 && a.now().Sub(issuedAt.Time) > a.MaxTokenAge+a.Leeway {
+		return fmt.Errorf("%w: token is older than the maximum age of %s", ErrTokenExpired, a.MaxTokenAge)
+	}
+	return nil
 }
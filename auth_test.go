@@ -1,18 +1,25 @@
 package grove_test
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/go-jose/go-jose/v4"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -32,7 +39,29 @@ func testRSAKey(t *testing.T) *rsa.PrivateKey {
 	return key
 }
 
-func writePrivateKeyPEM(t *testing.T, key *rsa.PrivateKey) string {
+func testECDSAKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %v", err)
+	}
+
+	return key
+}
+
+func testEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+
+	return key
+}
+
+func writePrivateKeyPEM(t *testing.T, key crypto.PrivateKey) string {
 	t.Helper()
 
 	der, err := x509.MarshalPKCS8PrivateKey(key)
@@ -71,6 +100,18 @@ func validConfig(t *testing.T, canEncrypt bool) grove.AuthenticatorConfig {
 	}
 }
 
+// Signs the claims with the HMAC key from validConfig without letting the Authenticator fill in
+// missing registered claims.
+func signTestToken(t *testing.T, claims jwt.Claims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
 func validClaims() *TestClaims {
 	return &TestClaims{
 		Email: "testing@example.com",
@@ -228,6 +269,22 @@ func TestLoadAuthenticatorConfigFromEnvWithoutEncryption(t *testing.T) {
 	}
 }
 
+func TestLoadAuthenticatorConfigFromEnvSkipsEmptyAudiences(t *testing.T) {
+	t.Setenv("JWT_CAN_ENCRYPT", "false")
+	t.Setenv("JWT_LIFETIME", "30")
+	t.Setenv("JWT_ISSUER", "Testing")
+	t.Setenv("JWT_AUDIENCE", "testing, ,admin,")
+	t.Setenv("JWT_SECRET", "secret")
+
+	got, err := grove.LoadAuthenticatorConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = %v; want nil", err)
+	}
+	if slices.Compare(got.Audience, []string{"admin", "testing"}) != 0 {
+		t.Fatalf("Audience = %q; want [admin testing]", got.Audience)
+	}
+}
+
 func TestLoadAuthenticatorConfigFromEnvWithEncryption(t *testing.T) {
 	key := testRSAKey(t)
 	keyPath := writePrivateKeyPEM(t, key)
@@ -493,10 +550,7 @@ func TestVerifyTokenWithoutExpirationShouldFail(t *testing.T) {
 	claims := validClaims()
 	claims.ExpiresAt = nil
 
-	token, err := auth.GenerateToken(claims)
-	if err != nil {
-		t.Fatalf("GenerateToken() error = %v; want nil", err)
-	}
+	token := signTestToken(t, claims)
 
 	_, err = auth.VerifyToken(token, &TestClaims{
 		RegisteredClaims: &jwt.RegisteredClaims{},
@@ -575,3 +629,804 @@ func TestLoadAuthenticatorConfigFromEnvMissingPrivateKeyPathShouldFail(t *testin
 		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = nil; want error")
 	}
 }
+
+func TestGenerateAndVerifyAsymmetricTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		key       crypto.Signer
+	}{
+		{name: "RS256", algorithm: "RS256", key: testRSAKey(t)},
+		{name: "PS256", algorithm: "PS256", key: testRSAKey(t)},
+		{name: "ES256", algorithm: "ES256", key: testECDSAKey(t, elliptic.P256())},
+		{name: "ES384", algorithm: "ES384", key: testECDSAKey(t, elliptic.P384())},
+		{name: "EdDSA", algorithm: "EdDSA", key: testEd25519Key(t)},
+	}
+
+	for _, tt := range tests {
+		for _, canEncrypt := range []bool{false, true} {
+			t.Run(tt.name+"/encrypt="+strconv.FormatBool(canEncrypt), func(t *testing.T) {
+				config := validConfig(t, canEncrypt)
+				config.Key = ""
+				config.SigningAlgorithm = tt.algorithm
+				config.SigningKey = tt.key
+
+				if err := config.Validate(); err != nil {
+					t.Fatalf("Validate() error = %v; want nil", err)
+				}
+
+				auth, err := grove.NewAuthenticator[*TestClaims](&config)
+				if err != nil {
+					t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+				}
+
+				token, err := auth.GenerateToken(validClaims())
+				if err != nil {
+					t.Fatalf("GenerateToken() error = %v; want nil", err)
+				}
+
+				parsed, err := auth.ParseToken(token, &TestClaims{})
+				if err != nil {
+					t.Fatalf("ParseToken() error = %v; want nil", err)
+				}
+				if parsed.Method.Alg() != tt.algorithm {
+					t.Fatalf("alg = %s; want %s", parsed.Method.Alg(), tt.algorithm)
+				}
+
+				got, err := auth.VerifyToken(token, &TestClaims{})
+				if err != nil {
+					t.Fatalf("VerifyToken() error = %v; want nil", err)
+				}
+				if got.Email != "testing@example.com" {
+					t.Fatalf("Email = %s; want testing@example.com", got.Email)
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyTokenWithDifferentAlgorithmShouldFail(t *testing.T) {
+	hmacConfig := validConfig(t, false)
+	hmacAuth, err := grove.NewAuthenticator[*TestClaims](&hmacConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	token, err := hmacAuth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	rsaConfig := validConfig(t, false)
+	rsaConfig.SigningAlgorithm = "RS256"
+	rsaConfig.SigningKey = testRSAKey(t)
+	rsaAuth, err := grove.NewAuthenticator[*TestClaims](&rsaConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	if _, err := rsaAuth.VerifyToken(token, &TestClaims{}); err == nil {
+		t.Fatalf("VerifyToken() error = nil; want algorithm error")
+	}
+}
+
+func TestVerifyTokenWithDifferentSigningKeyShouldFail(t *testing.T) {
+	config := validConfig(t, false)
+	config.SigningAlgorithm = "ES256"
+	config.SigningKey = testECDSAKey(t, elliptic.P256())
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	otherConfig := config
+	otherConfig.SigningKey = testECDSAKey(t, elliptic.P256())
+	other, err := grove.NewAuthenticator[*TestClaims](&otherConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	if _, err := other.VerifyToken(token, &TestClaims{}); err == nil {
+		t.Fatalf("VerifyToken() error = nil; want signature error")
+	}
+}
+
+func TestAuthenticatorConfigValidateSigningKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		key       crypto.Signer
+	}{
+		{name: "unknown algorithm", algorithm: "XX256", key: testRSAKey(t)},
+		{name: "none algorithm", algorithm: "none"},
+		{name: "missing key", algorithm: "RS256"},
+		{name: "RSA algorithm with EC key", algorithm: "RS256", key: testECDSAKey(t, elliptic.P256())},
+		{name: "ES256 with P-384 key", algorithm: "ES256", key: testECDSAKey(t, elliptic.P384())},
+		{name: "EdDSA with RSA key", algorithm: "EdDSA", key: testRSAKey(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t, false)
+			config.SigningAlgorithm = tt.algorithm
+			config.SigningKey = tt.key
+
+			if err := config.Validate(); err == nil {
+				t.Fatalf("Validate() error = nil; want error")
+			}
+		})
+	}
+}
+
+func TestLoadAuthenticatorConfigFromEnvWithAsymmetricAlgorithm(t *testing.T) {
+	keyPath := writePrivateKeyPEM(t, testECDSAKey(t, elliptic.P256()))
+
+	t.Setenv("JWT_CAN_ENCRYPT", "false")
+	t.Setenv("JWT_ISSUER", "Testing")
+	t.Setenv("JWT_AUDIENCE", "testing")
+	t.Setenv("JWT_SIGNING_ALGORITHM", "ES256")
+	t.Setenv("JWT_SIGNING_KEY_PATH", keyPath)
+
+	got, err := grove.LoadAuthenticatorConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = %v; want nil", err)
+	}
+
+	if _, ok := got.SigningKey.(*ecdsa.PrivateKey); !ok {
+		t.Fatalf("SigningKey = %T; want *ecdsa.PrivateKey", got.SigningKey)
+	}
+	if err := got.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v; want nil", err)
+	}
+}
+
+func TestLoadAuthenticatorConfigFromEnvMissingSigningKeyPathShouldFail(t *testing.T) {
+	t.Setenv("JWT_CAN_ENCRYPT", "false")
+	t.Setenv("JWT_ISSUER", "Testing")
+	t.Setenv("JWT_AUDIENCE", "testing")
+	t.Setenv("JWT_SIGNING_ALGORITHM", "RS256")
+
+	_, err := grove.LoadAuthenticatorConfigFromEnv()
+	if err == nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = nil; want error")
+	}
+}
+
+func TestGenerateAndVerifyTokenWithJWEAlgorithms(t *testing.T) {
+	tests := []struct {
+		name              string
+		keyAlgorithm      jose.KeyAlgorithm
+		contentEncryption jose.ContentEncryption
+		configure         func(config *grove.AuthenticatorConfig)
+	}{
+		{
+			name:              "RSA-OAEP-256 with A256GCM",
+			keyAlgorithm:      jose.RSA_OAEP_256,
+			contentEncryption: jose.A256GCM,
+			configure:         func(config *grove.AuthenticatorConfig) {},
+		},
+		{
+			name:              "dir with A256GCM",
+			keyAlgorithm:      jose.DIRECT,
+			contentEncryption: jose.A256GCM,
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEPrivateKey = nil
+				config.JWESharedKey = []byte("0123456789abcdef0123456789abcdef")
+			},
+		},
+		{
+			name:              "A256KW with A128CBC-HS256",
+			keyAlgorithm:      jose.A256KW,
+			contentEncryption: jose.A128CBC_HS256,
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEPrivateKey = nil
+				config.JWESharedKey = []byte("0123456789abcdef0123456789abcdef")
+			},
+		},
+		{
+			name:              "ECDH-ES with A256GCM",
+			keyAlgorithm:      jose.ECDH_ES,
+			contentEncryption: jose.A256GCM,
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEPrivateKey = nil
+				config.JWEECDHKey = testECDSAKey(t, elliptic.P256())
+			},
+		},
+		{
+			name:              "ECDH-ES+A256KW with A256GCM",
+			keyAlgorithm:      jose.ECDH_ES_A256KW,
+			contentEncryption: jose.A256GCM,
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEPrivateKey = nil
+				config.JWEECDHKey = testECDSAKey(t, elliptic.P384())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t, true)
+			config.JWEKeyAlgorithm = tt.keyAlgorithm
+			config.JWEContentEncryption = tt.contentEncryption
+			tt.configure(&config)
+
+			if err := config.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v; want nil", err)
+			}
+
+			auth, err := grove.NewAuthenticator[*TestClaims](&config)
+			if err != nil {
+				t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+			}
+
+			token, err := auth.GenerateToken(validClaims())
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v; want nil", err)
+			}
+
+			jwe, err := jose.ParseEncrypted(token, []jose.KeyAlgorithm{tt.keyAlgorithm}, []jose.ContentEncryption{tt.contentEncryption})
+			if err != nil {
+				t.Fatalf("token is not a JWE using %s and %s: %v", tt.keyAlgorithm, tt.contentEncryption, err)
+			}
+			if jwe.Header.Algorithm != string(tt.keyAlgorithm) {
+				t.Fatalf("alg = %s; want %s", jwe.Header.Algorithm, tt.keyAlgorithm)
+			}
+
+			if _, err := auth.VerifyToken(token, &TestClaims{}); err != nil {
+				t.Fatalf("VerifyToken() error = %v; want nil", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenWithDisallowedJWEAlgorithmShouldFail(t *testing.T) {
+	legacyConfig := validConfig(t, true)
+	legacy, err := grove.NewAuthenticator[*TestClaims](&legacyConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	token, err := legacy.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	strictConfig := legacyConfig
+	strictConfig.JWEKeyAlgorithm = jose.RSA_OAEP_256
+	strictConfig.JWEContentEncryption = jose.A256GCM
+	strict, err := grove.NewAuthenticator[*TestClaims](&strictConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	if _, err := strict.VerifyToken(token, &TestClaims{}); err == nil {
+		t.Fatalf("VerifyToken() error = nil; want disallowed algorithm error")
+	}
+
+	strictConfig.JWEAllowedKeyAlgorithms = []jose.KeyAlgorithm{jose.RSA_OAEP, jose.RSA_OAEP_256}
+	strictConfig.JWEAllowedContentEncryptions = []jose.ContentEncryption{jose.A128GCM, jose.A256GCM}
+	migrating, err := grove.NewAuthenticator[*TestClaims](&strictConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	if _, err := migrating.VerifyToken(token, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+}
+
+func TestAuthenticatorConfigValidateJWE(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(config *grove.AuthenticatorConfig)
+	}{
+		{
+			name: "dir without shared key",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEKeyAlgorithm = jose.DIRECT
+			},
+		},
+		{
+			name: "dir with wrong key size",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEKeyAlgorithm = jose.DIRECT
+				config.JWEContentEncryption = jose.A256GCM
+				config.JWESharedKey = []byte("too-short")
+			},
+		},
+		{
+			name: "ECDH-ES without EC key",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEKeyAlgorithm = jose.ECDH_ES
+			},
+		},
+		{
+			name: "unsupported key algorithm",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEKeyAlgorithm = jose.RSA1_5
+			},
+		},
+		{
+			name: "unsupported content encryption",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.JWEContentEncryption = "A1GCM"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t, true)
+			tt.configure(&config)
+
+			if err := config.Validate(); err == nil {
+				t.Fatalf("Validate() error = nil; want error")
+			}
+		})
+	}
+}
+
+func TestLoadAuthenticatorConfigFromEnvWithJWEAlgorithms(t *testing.T) {
+	keyPath := writePrivateKeyPEM(t, testRSAKey(t))
+
+	t.Setenv("JWT_CAN_ENCRYPT", "true")
+	t.Setenv("JWT_PRIVATE_KEY_PATH", keyPath)
+	t.Setenv("JWT_ISSUER", "Testing")
+	t.Setenv("JWT_AUDIENCE", "testing")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("JWT_JWE_KEY_ALGORITHM", "RSA-OAEP-256")
+	t.Setenv("JWT_JWE_CONTENT_ENCRYPTION", "A256GCM")
+
+	got, err := grove.LoadAuthenticatorConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = %v; want nil", err)
+	}
+	if got.JWEKeyAlgorithm != jose.RSA_OAEP_256 || got.JWEContentEncryption != jose.A256GCM {
+		t.Fatalf("JWE algorithms = %s, %s; want RSA-OAEP-256, A256GCM", got.JWEKeyAlgorithm, got.JWEContentEncryption)
+	}
+}
+
+func fixedClock(now time.Time) func() time.Time {
+	return func() time.Time { return now }
+}
+
+func TestVerifyTokenTimeValidation(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		configure func(config *grove.AuthenticatorConfig)
+		claims    func(claims *TestClaims)
+		wantErr   bool
+	}{
+		{
+			name: "expired without leeway",
+			claims: func(claims *TestClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Second))
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired within leeway",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.Leeway = 5 * time.Second
+			},
+			claims: func(claims *TestClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(now.Add(-3 * time.Second))
+			},
+			wantErr: false,
+		},
+		{
+			name: "expired beyond leeway",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.Leeway = 5 * time.Second
+			},
+			claims: func(claims *TestClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second))
+			},
+			wantErr: true,
+		},
+		{
+			name: "not before in the future",
+			claims: func(claims *TestClaims) {
+				claims.NotBefore = jwt.NewNumericDate(now.Add(time.Minute))
+			},
+			wantErr: true,
+		},
+		{
+			name: "not before within leeway",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.Leeway = 5 * time.Second
+			},
+			claims: func(claims *TestClaims) {
+				claims.NotBefore = jwt.NewNumericDate(now.Add(3 * time.Second))
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing required not before",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.RequireNotBefore = true
+			},
+			wantErr: true,
+		},
+		{
+			name: "present required not before",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.RequireNotBefore = true
+			},
+			claims: func(claims *TestClaims) {
+				claims.NotBefore = jwt.NewNumericDate(now)
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing required issued at",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.RequireIssuedAt = true
+			},
+			claims: func(claims *TestClaims) {
+				claims.IssuedAt = nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "issued in the future",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.RequireIssuedAt = true
+			},
+			claims: func(claims *TestClaims) {
+				claims.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute))
+			},
+			wantErr: true,
+		},
+		{
+			name: "older than max token age",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.MaxTokenAge = 10 * time.Minute
+			},
+			claims: func(claims *TestClaims) {
+				claims.IssuedAt = jwt.NewNumericDate(now.Add(-11 * time.Minute))
+			},
+			wantErr: true,
+		},
+		{
+			name: "younger than max token age",
+			configure: func(config *grove.AuthenticatorConfig) {
+				config.MaxTokenAge = 10 * time.Minute
+			},
+			claims: func(claims *TestClaims) {
+				claims.IssuedAt = jwt.NewNumericDate(now.Add(-9 * time.Minute))
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t, false)
+			config.Clock = fixedClock(now)
+			if tt.configure != nil {
+				tt.configure(&config)
+			}
+
+			auth, err := grove.NewAuthenticator[*TestClaims](&config)
+			if err != nil {
+				t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+			}
+
+			claims := validClaims()
+			claims.ExpiresAt = jwt.NewNumericDate(now.Add(time.Hour))
+			claims.IssuedAt = jwt.NewNumericDate(now)
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+
+			token := signTestToken(t, claims)
+
+			_, err = auth.VerifyToken(token, &TestClaims{})
+			if tt.wantErr && err == nil {
+				t.Fatalf("VerifyToken() error = nil; want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("VerifyToken() error = %v; want nil", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorConfigValidateNegativeDurationsShouldFail(t *testing.T) {
+	config := validConfig(t, false)
+	config.Leeway = -time.Second
+	if err := config.Validate(); err == nil {
+		t.Fatalf("Validate() error = nil; want leeway error")
+	}
+
+	config = validConfig(t, false)
+	config.MaxTokenAge = -time.Second
+	if err := config.Validate(); err == nil {
+		t.Fatalf("Validate() error = nil; want max token age error")
+	}
+}
+
+func TestVerifyTokenAudienceMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		match          grove.AudienceMatch
+		configured     []string
+		tokenAudiences []string
+		wantErr        bool
+	}{
+		{name: "any single configured single token", match: grove.AudienceMatchAny, configured: []string{"api"}, tokenAudiences: []string{"api"}},
+		{name: "any multiple configured single token", match: grove.AudienceMatchAny, configured: []string{"admin", "api"}, tokenAudiences: []string{"api"}},
+		{name: "any multiple configured multiple token", match: grove.AudienceMatchAny, configured: []string{"admin", "api"}, tokenAudiences: []string{"other", "admin"}},
+		{name: "any no overlap", match: grove.AudienceMatchAny, configured: []string{"admin", "api"}, tokenAudiences: []string{"other"}, wantErr: true},
+		{name: "any empty token audience", match: grove.AudienceMatchAny, configured: []string{"api"}, tokenAudiences: nil, wantErr: true},
+		{name: "all single configured multiple token", match: grove.AudienceMatchAll, configured: []string{"api"}, tokenAudiences: []string{"api", "other"}},
+		{name: "all multiple configured all present", match: grove.AudienceMatchAll, configured: []string{"admin", "api"}, tokenAudiences: []string{"api", "admin"}},
+		{name: "all multiple configured one missing", match: grove.AudienceMatchAll, configured: []string{"admin", "api"}, tokenAudiences: []string{"api"}, wantErr: true},
+		{name: "all empty token audience", match: grove.AudienceMatchAll, configured: []string{"api"}, tokenAudiences: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t, false)
+			config.Audience = tt.configured
+			config.AudienceMatch = tt.match
+
+			auth, err := grove.NewAuthenticator[*TestClaims](&config)
+			if err != nil {
+				t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+			}
+
+			claims := validClaims()
+			claims.Audience = tt.tokenAudiences
+			token := signTestToken(t, claims)
+
+			_, err = auth.VerifyToken(token, &TestClaims{})
+			if tt.wantErr && err == nil {
+				t.Fatalf("VerifyToken() error = nil; want audience error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("VerifyToken() error = %v; want nil", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorConfigValidateUnknownAudienceMatchShouldFail(t *testing.T) {
+	config := validConfig(t, false)
+	config.AudienceMatch = grove.AudienceMatch(42)
+
+	if err := config.Validate(); err == nil {
+		t.Fatalf("Validate() error = nil; want error")
+	}
+}
+
+func TestLoadAuthenticatorConfigFromEnvWithAudienceMatch(t *testing.T) {
+	t.Setenv("JWT_CAN_ENCRYPT", "false")
+	t.Setenv("JWT_ISSUER", "Testing")
+	t.Setenv("JWT_AUDIENCE", "testing, admin")
+	t.Setenv("JWT_AUDIENCE_MATCH", "all")
+	t.Setenv("JWT_SECRET", "secret")
+
+	got, err := grove.LoadAuthenticatorConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = %v; want nil", err)
+	}
+	if got.AudienceMatch != grove.AudienceMatchAll {
+		t.Fatalf("AudienceMatch = %s; want all", got.AudienceMatch)
+	}
+	if slices.Compare(got.Audience, []string{"admin", "testing"}) != 0 {
+		t.Fatalf("Audience = %v; want [admin testing]", got.Audience)
+	}
+
+	t.Setenv("JWT_AUDIENCE_MATCH", "some")
+	if _, err := grove.LoadAuthenticatorConfigFromEnv(); err == nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = nil; want audience match error")
+	}
+}
+
+func TestGenerateTokenPopulatesRegisteredClaims(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	config := validConfig(t, false)
+	config.Clock = fixedClock(now)
+	config.Audience = []string{"testing", "admin"}
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	claims := &TestClaims{Email: "testing@example.com"}
+	token, err := auth.GenerateToken(claims)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	got, err := auth.VerifyToken(token, &TestClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+
+	if got.Issuer != "Testing" {
+		t.Fatalf("Issuer = %s; want Testing", got.Issuer)
+	}
+	if slices.Compare(got.Audience, config.Audience) != 0 {
+		t.Fatalf("Audience = %v; want %v", got.Audience, config.Audience)
+	}
+	if !got.ExpiresAt.Equal(now.Add(config.Lifetime)) {
+		t.Fatalf("ExpiresAt = %s; want %s", got.ExpiresAt, now.Add(config.Lifetime))
+	}
+	if !got.IssuedAt.Equal(now) || !got.NotBefore.Equal(now) {
+		t.Fatalf("IssuedAt = %s, NotBefore = %s; want %s", got.IssuedAt, got.NotBefore, now)
+	}
+	if got.ID == "" {
+		t.Fatalf("ID is empty; want random jti")
+	}
+	if claims.ID != got.ID {
+		t.Fatalf("claims were not updated in place: ID = %q; want %q", claims.ID, got.ID)
+	}
+
+	other, err := auth.GenerateToken(&TestClaims{})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+	otherClaims, err := auth.VerifyToken(other, &TestClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if otherClaims.ID == got.ID {
+		t.Fatalf("two tokens share the jti %q", got.ID)
+	}
+}
+
+func TestGenerateTokenKeepsExplicitRegisteredClaims(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	config := validConfig(t, false)
+	config.Clock = fixedClock(now)
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	expiresAt := now.Add(5 * time.Minute)
+	claims := &TestClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        "custom-id",
+		},
+	}
+	token, err := auth.GenerateToken(claims)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	got, err := auth.VerifyToken(token, &TestClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if got.Subject != "user-1" || got.ID != "custom-id" {
+		t.Fatalf("Subject = %s, ID = %s; want user-1, custom-id", got.Subject, got.ID)
+	}
+	if !got.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("ExpiresAt = %s; want %s", got.ExpiresAt, expiresAt)
+	}
+}
+
+func TestGenerateTokenPopulatesClaimsTypes(t *testing.T) {
+	config := validConfig(t, false)
+
+	type valueClaims struct {
+		Role string `json:"role"`
+		jwt.RegisteredClaims
+	}
+
+	t.Run("registered claims", func(t *testing.T) {
+		auth, err := grove.NewAuthenticator[*jwt.RegisteredClaims](&config)
+		if err != nil {
+			t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+		}
+		token, err := auth.GenerateToken(&jwt.RegisteredClaims{Subject: "user-1"})
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v; want nil", err)
+		}
+		if _, err := auth.VerifyToken(token, &jwt.RegisteredClaims{}); err != nil {
+			t.Fatalf("VerifyToken() error = %v; want nil", err)
+		}
+	})
+
+	t.Run("embedded value", func(t *testing.T) {
+		auth, err := grove.NewAuthenticator[*valueClaims](&config)
+		if err != nil {
+			t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+		}
+		token, err := auth.GenerateToken(&valueClaims{Role: "admin"})
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v; want nil", err)
+		}
+		if _, err := auth.VerifyToken(token, &valueClaims{}); err != nil {
+			t.Fatalf("VerifyToken() error = %v; want nil", err)
+		}
+	})
+
+	t.Run("map claims", func(t *testing.T) {
+		auth, err := grove.NewAuthenticator[jwt.MapClaims](&config)
+		if err != nil {
+			t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+		}
+		token, err := auth.GenerateToken(jwt.MapClaims{"sub": "user-1"})
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v; want nil", err)
+		}
+		got, err := auth.VerifyToken(token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatalf("VerifyToken() error = %v; want nil", err)
+		}
+		if got["jti"] == "" || got["iss"] != "Testing" {
+			t.Fatalf("claims = %v; want generated jti and iss", got)
+		}
+	})
+}
+
+func TestVerifyTokenReturnsTypedErrors(t *testing.T) {
+	config := validConfig(t, false)
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	notYetValid := validClaims()
+	notYetValid.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	wrongAudience := validClaims()
+	wrongAudience.Audience = []string{"other"}
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "Other"
+
+	otherKey, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("other-secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{name: "malformed", token: "not-a-token", want: grove.ErrTokenMalformed},
+		{name: "bad signature", token: otherKey, want: grove.ErrTokenSignatureInvalid},
+		{name: "expired", token: signTestToken(t, expired), want: grove.ErrTokenExpired},
+		{name: "not valid yet", token: signTestToken(t, notYetValid), want: grove.ErrTokenNotValidYet},
+		{name: "bad audience", token: signTestToken(t, wrongAudience), want: grove.ErrTokenInvalidAudience},
+		{name: "bad issuer", token: signTestToken(t, wrongIssuer), want: grove.ErrTokenInvalidIssuer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.VerifyToken(tt.token, &TestClaims{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyToken() error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+
+	encryptedConfig := validConfig(t, true)
+	encryptedAuth, err := grove.NewAuthenticator[*TestClaims](&encryptedConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+	if _, err := encryptedAuth.VerifyToken(signTestToken(t, validClaims()), &TestClaims{}); !errors.Is(err, grove.ErrTokenUndecryptable) {
+		t.Fatalf("VerifyToken() error = %v; want %v", err, grove.ErrTokenUndecryptable)
+	}
+}
@@ -0,0 +1,150 @@
+package grove
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IRolesClaims is implemented by claims that carry roles. It is used by `RequireRoles`.
+type IRolesClaims interface {
+	GetRoles() []string
+}
+
+// IScopesClaims is implemented by claims that carry OAuth 2.0 scopes. It is used by `RequireScopes`.
+type IScopesClaims interface {
+	GetScopes() []string
+}
+
+// ClaimsFromContext returns the claims `DefaultAuthMiddleware` stored under AuthTokenKey.
+// The boolean is false if the request was not authenticated or the claims are not of type T.
+func ClaimsFromContext[T jwt.Claims](ctx context.Context) (T, bool) {
+	claims, ok := ctx.Value(AuthTokenKey).(T)
+	return claims, ok
+}
+
+// Returns the roles of the claims. jwt.MapClaims are read from the `roles` claim.
+func rolesOf(claims any) []string {
+	switch claims := claims.(type) {
+	case IRolesClaims:
+		return claims.GetRoles()
+	case jwt.MapClaims:
+		return stringsOf(claims["roles"])
+	}
+	return nil
+}
+
+// Returns the scopes of the claims. jwt.MapClaims are read from the space separated `scope`
+// claim of RFC 8693 or from a `scp` array.
+func scopesOf(claims any) []string {
+	switch claims := claims.(type) {
+	case IScopesClaims:
+		return claims.GetScopes()
+	case jwt.MapClaims:
+		if scope, ok := claims["scope"].(string); ok {
+			return strings.Fields(scope)
+		}
+		return stringsOf(claims["scp"])
+	}
+	return nil
+}
+
+// Converts a claim decoded from JSON into a list of strings.
+func stringsOf(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Returns a middleware that only calls the next handler if the claims in the request context
+// satisfy the check. Requests authenticated without a JWT, such as with an API key, are checked
+// using their `*Principal` instead. Requests without claims get 401 and requests whose claims fail the check
+// get 403, both in the shape written by `WriteErrorToResponse`. For requests authenticated with a
+// JWT the 403 carries the `insufficient_scope` error code of RFC 6750, with the scope when it is
+// not empty.
+func requireClaims(scope string, check func(claims any, r *http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := r.Context().Value(AuthTokenKey)
+			method := AuthMethodJWT
+			if principal, ok := PrincipalFromContext(r.Context()); ok {
+				method = principal.Method
+				if claims == nil {
+					claims = principal
+				}
+			}
+			if claims == nil {
+				writeUnauthorized(w, "Bearer", "", ErrTokenMissing)
+				return
+			}
+			if !check(claims, r) {
+				writeForbidden(w, method, scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles returns a middleware that requires the caller to have at least one of the roles.
+// It must run after `DefaultAuthMiddleware` or another middleware that stores a `*Principal`.
+// The claims must implement `IRolesClaims` or be jwt.MapClaims with a `roles` claim.
+func RequireRoles(roles ...string) Middleware {
+	return requireClaims("", func(claims any, r *http.Request) bool {
+		granted := rolesOf(claims)
+		return slices.ContainsFunc(roles, func(role string) bool {
+			return slices.Contains(granted, role)
+		})
+	})
+}
+
+// RequireScopes returns a middleware that requires the caller to have been granted every scope.
+// It must run after `DefaultAuthMiddleware` or another middleware that stores a `*Principal`.
+// The claims must implement `IScopesClaims` or be jwt.MapClaims with a `scope` or `scp` claim.
+func RequireScopes(scopes ...string) Middleware {
+	return requireClaims(strings.Join(scopes, " "), func(claims any, r *http.Request) bool {
+		granted := scopesOf(claims)
+		for _, scope := range scopes {
+			if !slices.Contains(granted, scope) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequirePolicy returns a middleware that only lets requests through when the policy returns
+// true for the claims of the request.
+// It must run after `DefaultAuthMiddleware` and claims that are not of type T are rejected.
+// Use `RequirePrincipalPolicy` to write policies for requests authenticated by any middleware.
+func RequirePolicy[T jwt.Claims](policy func(claims T, r *http.Request) bool) Middleware {
+	return requireClaims("", func(claims any, r *http.Request) bool {
+		typed, ok := claims.(T)
+		return ok && policy(typed, r)
+	})
+}
+
+// RequirePrincipalPolicy returns a middleware that only lets requests through when the policy
+// returns true for the `*Principal` of the request.
+// It must run after `DefaultAuthMiddleware` or another middleware that stores a `*Principal`.
+func RequirePrincipalPolicy(policy func(principal *Principal, r *http.Request) bool) Middleware {
+	return requireClaims("", func(claims any, r *http.Request) bool {
+		principal, ok := PrincipalFromContext(r.Context())
+		return ok && policy(principal, r)
+	})
+}
@@ -0,0 +1,191 @@
+package grove_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type RoleClaims struct {
+	Roles []string `json:"roles"`
+	Scope string   `json:"scope"`
+	*jwt.RegisteredClaims
+}
+
+func (c *RoleClaims) GetRoles() []string {
+	return c.Roles
+}
+
+func (c *RoleClaims) GetScopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Serves a request carrying the claims through DefaultAuthMiddleware followed by the middleware.
+// If claims is nil the request has no token.
+func serveWithClaims[T jwt.Claims](t *testing.T, claims jwt.Claims, factory func() T, middleware grove.Middleware) int {
+	t.Helper()
+
+	config := validConfig(t, false)
+	auth, err := grove.NewAuthenticator[T](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	handler := grove.NewScope("test").
+		WithMiddleware(grove.DefaultAuthMiddleware(auth, &testLogger{}, factory, grove.WithAnonymousAccess())).
+		WithMiddleware(middleware).
+		WithRoute("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if claims != nil {
+		req.Header.Set("Authorization", "Bearer "+signTestToken(t, claims))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK && rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type = %q; want application/json", rec.Header().Get("Content-Type"))
+	}
+	return rec.Code
+}
+
+func roleClaims(roles []string, scope string) *RoleClaims {
+	return &RoleClaims{Roles: roles, Scope: scope, RegisteredClaims: validClaims().RegisteredClaims}
+}
+
+func TestRequireRoles(t *testing.T) {
+	factory := func() *RoleClaims { return &RoleClaims{} }
+
+	tests := []struct {
+		name   string
+		claims jwt.Claims
+		want   int
+	}{
+		{name: "has one of the roles", claims: roleClaims([]string{"editor"}, ""), want: http.StatusOK},
+		{name: "has none of the roles", claims: roleClaims([]string{"viewer"}, ""), want: http.StatusForbidden},
+		{name: "anonymous", claims: nil, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveWithClaims(t, tt.claims, factory, grove.RequireRoles("admin", "editor")); got != tt.want {
+				t.Fatalf("status = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	factory := func() *RoleClaims { return &RoleClaims{} }
+
+	tests := []struct {
+		name   string
+		claims jwt.Claims
+		want   int
+	}{
+		{name: "has every scope", claims: roleClaims(nil, "orders:read orders:write profile"), want: http.StatusOK},
+		{name: "misses a scope", claims: roleClaims(nil, "orders:read"), want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveWithClaims(t, tt.claims, factory, grove.RequireScopes("orders:read", "orders:write")); got != tt.want {
+				t.Fatalf("status = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireRolesAndScopesWithMapClaims(t *testing.T) {
+	factory := func() jwt.MapClaims { return jwt.MapClaims{} }
+	claims := jwt.MapClaims{
+		"iss":   "Testing",
+		"aud":   []string{"testing"},
+		"exp":   validClaims().ExpiresAt,
+		"roles": []string{"admin"},
+		"scope": "orders:read",
+	}
+
+	if got := serveWithClaims(t, claims, factory, grove.RequireRoles("admin")); got != http.StatusOK {
+		t.Fatalf("RequireRoles() status = %d; want %d", got, http.StatusOK)
+	}
+	if got := serveWithClaims(t, claims, factory, grove.RequireScopes("orders:read")); got != http.StatusOK {
+		t.Fatalf("RequireScopes() status = %d; want %d", got, http.StatusOK)
+	}
+	if got := serveWithClaims(t, claims, factory, grove.RequireScopes("orders:write")); got != http.StatusForbidden {
+		t.Fatalf("RequireScopes() with missing scope status = %d; want %d", got, http.StatusForbidden)
+	}
+}
+
+func TestRequirePolicy(t *testing.T) {
+	factory := func() *TestClaims { return &TestClaims{} }
+	policy := grove.RequirePolicy(func(claims *TestClaims, r *http.Request) bool {
+		return strings.HasSuffix(claims.Email, "@example.com")
+	})
+
+	allowed := validClaims()
+	denied := validClaims()
+	denied.Email = "testing@other.com"
+
+	if got := serveWithClaims(t, allowed, factory, policy); got != http.StatusOK {
+		t.Fatalf("status = %d; want %d", got, http.StatusOK)
+	}
+	if got := serveWithClaims(t, denied, factory, policy); got != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d", got, http.StatusForbidden)
+	}
+}
+
+func TestRequirePrincipalPolicy(t *testing.T) {
+	factory := func() *RoleClaims { return &RoleClaims{} }
+	policy := grove.RequirePrincipalPolicy(func(principal *grove.Principal, r *http.Request) bool {
+		return principal.Method == grove.AuthMethodJWT && slices.Contains(principal.Roles, "admin")
+	})
+
+	if got := serveWithClaims(t, roleClaims([]string{"admin"}, ""), factory, policy); got != http.StatusOK {
+		t.Fatalf("status = %d; want %d", got, http.StatusOK)
+	}
+	if got := serveWithClaims(t, roleClaims([]string{"viewer"}, ""), factory, policy); got != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d", got, http.StatusForbidden)
+	}
+	if got := serveWithClaims(t, nil, factory, policy); got != http.StatusUnauthorized {
+		t.Fatalf("anonymous status = %d; want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestClaimsFromContext(t *testing.T) {
+	auth := testAuthenticator(t)
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	var found bool
+	var email string
+	handler := grove.DefaultAuthMiddleware(auth, &testLogger{}, func() *TestClaims { return &TestClaims{} })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var claims *TestClaims
+			claims, found = grove.ClaimsFromContext[*TestClaims](r.Context())
+			if found {
+				email = claims.Email
+			}
+			if _, ok := grove.ClaimsFromContext[*RoleClaims](r.Context()); ok {
+				t.Errorf("ClaimsFromContext[*RoleClaims]() ok = true; want false")
+			}
+		}),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !found || email != "testing@example.com" {
+		t.Fatalf("ClaimsFromContext() = %q, %v; want testing@example.com, true", email, found)
+	}
+}
@@ -0,0 +1,106 @@
+package grove
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrCredentialsMissing = errors.New("credentials are missing")
+	ErrCredentialsInvalid = errors.New("credentials are invalid")
+)
+
+// IBasicAuthVerifier checks the username and password of a request using HTTP Basic auth.
+type IBasicAuthVerifier interface {
+	// VerifyBasicAuth returns the principal for the credentials or ErrCredentialsInvalid.
+	VerifyBasicAuth(ctx context.Context, username string, password string) (*Principal, error)
+}
+
+// BasicAuthVerifierFunc adapts a function to an `IBasicAuthVerifier`.
+type BasicAuthVerifierFunc func(ctx context.Context, username string, password string) (*Principal, error)
+
+// VerifyBasicAuth calls the function.
+func (f BasicAuthVerifierFunc) VerifyBasicAuth(ctx context.Context, username string, password string) (*Principal, error) {
+	return f(ctx, username, password)
+}
+
+// StaticBasicAuthVerifier is an `IBasicAuthVerifier` backed by a fixed map of usernames to
+// passwords, meant for internal tools with a handful of accounts.
+// The credentials are compared in constant time, so the time a request takes does not reveal
+// how much of a password was right or whether the username exists.
+type StaticBasicAuthVerifier struct {
+	credentials map[string][sha256.Size]byte
+}
+
+// Initializes the StaticBasicAuthVerifier with a map of usernames to passwords.
+func NewStaticBasicAuthVerifier(credentials map[string]string) *StaticBasicAuthVerifier {
+	hashed := make(map[string][sha256.Size]byte, len(credentials))
+	for username, password := range credentials {
+		hashed[username] = sha256.Sum256([]byte(password))
+	}
+	return &StaticBasicAuthVerifier{credentials: hashed}
+}
+
+// VerifyBasicAuth checks the password of the user.
+func (v *StaticBasicAuthVerifier) VerifyBasicAuth(ctx context.Context, username string, password string) (*Principal, error) {
+	// Hashing both sides makes the comparison independent of the password length, and unknown
+	// users are compared against an empty hash so they take as long as known ones.
+	want, found := v.credentials[username]
+	got := sha256.Sum256([]byte(password))
+	if subtle.ConstantTimeCompare(got[:], want[:]) != 1 || !found {
+		return nil, ErrCredentialsInvalid
+	}
+	return &Principal{Subject: username, Method: AuthMethodBasic}, nil
+}
+
+// Writes the 401 response of `BasicAuthMiddleware` with the challenge described in RFC 7617.
+func writeBasicUnauthorized(w http.ResponseWriter, realm string, err error) {
+	if realm == "" {
+		realm = "Restricted"
+	}
+	realm = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(realm)
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+	WriteErrorToResponse(w, http.StatusUnauthorized, authErrorDescription(err))
+}
+
+// BasicAuthMiddleware is a middleware that authenticates requests using HTTP Basic auth.
+// The credentials are checked by the verifier and the principal it returns is stored in the
+// request context under PrincipalKey. If the principal has no Method it is set to AuthMethodBasic.
+//
+// It accepts WithRealm, WithAnonymousAccess and WithUnauthorizedHandler. Rejected requests get a
+// 401 response with a `WWW-Authenticate: Basic` challenge, which makes browsers prompt for
+// credentials. Basic auth sends the password with every request, so it must only be used over TLS.
+func BasicAuthMiddleware(verifier IBasicAuthVerifier, logger ILogger, opts ...AuthMiddlewareOption) Middleware {
+	options := newAuthMiddlewareOptions(nil, opts, writeBasicUnauthorized)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				if options.allowAnonymous {
+					next.ServeHTTP(w, r)
+					return
+				}
+				options.unauthorized(w, r, ErrCredentialsMissing)
+				return
+			}
+
+			principal, err := verifier.VerifyBasicAuth(r.Context(), username, password)
+			if err != nil || principal == nil {
+				logger.Errorf("Invalid Basic auth credentials for %q: %v", username, err)
+				options.unauthorized(w, r, ErrCredentialsInvalid)
+				return
+			}
+			if principal.Method == "" {
+				principal.Method = AuthMethodBasic
+			}
+
+			ctx := context.WithValue(r.Context(), PrincipalKey, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package grove_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	verifier := grove.NewStaticBasicAuthVerifier(map[string]string{"admin": "correct horse"})
+	handler := grove.BasicAuthMiddleware(verifier, &testLogger{}, grove.WithRealm("admin tools"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := grove.PrincipalFromContext(r.Context())
+			_, _ = w.Write([]byte(principal.Subject + " " + string(principal.Method)))
+		}),
+	)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		noAuth   bool
+		want     int
+	}{
+		{name: "valid credentials", username: "admin", password: "correct horse", want: http.StatusOK},
+		{name: "wrong password", username: "admin", password: "correct", want: http.StatusUnauthorized},
+		{name: "unknown user", username: "guest", password: "correct horse", want: http.StatusUnauthorized},
+		{name: "missing credentials", noAuth: true, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if !tt.noAuth {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && rec.Body.String() != "admin basic" {
+				t.Fatalf("body = %q; want admin basic", rec.Body.String())
+			}
+			if tt.want == http.StatusUnauthorized {
+				want := `Basic realm="admin tools", charset="UTF-8"`
+				if got := rec.Header().Get("WWW-Authenticate"); got != want {
+					t.Fatalf("WWW-Authenticate = %q; want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBasicAuthMiddlewareWithCustomVerifier(t *testing.T) {
+	verifier := grove.BasicAuthVerifierFunc(func(ctx context.Context, username string, password string) (*grove.Principal, error) {
+		if username != "ops" || password != "secret" {
+			return nil, grove.ErrCredentialsInvalid
+		}
+		return &grove.Principal{Subject: username, Roles: []string{"admin"}}, nil
+	})
+
+	scope := grove.NewScope("test").
+		WithMiddleware(grove.BasicAuthMiddleware(verifier, &testLogger{})).
+		WithMiddleware(grove.RequireRoles("admin")).
+		WithRoute("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("ops", "secret")
+	rec := httptest.NewRecorder()
+	scope.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+}
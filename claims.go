@@ -0,0 +1,103 @@
+package grove
+
+import (
+	"reflect"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var registeredClaimsType = reflect.TypeFor[jwt.RegisteredClaims]()
+
+// Returns the registered claims held by the provided claims value.
+// It supports `*jwt.RegisteredClaims` itself and pointers to structs that have a
+// `jwt.RegisteredClaims` or `*jwt.RegisteredClaims` field, which is usually embedded.
+// A nil `*jwt.RegisteredClaims` field is allocated so it can be filled in.
+// If no registered claims are found it returns nil.
+func registeredClaimsOf(claims any) *jwt.RegisteredClaims {
+	if registered, ok := claims.(*jwt.RegisteredClaims); ok {
+		return registered
+	}
+
+	value := reflect.ValueOf(claims)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	value = value.Elem()
+	for i := range value.NumField() {
+		field := value.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch {
+		case field.Type() == registeredClaimsType:
+			return field.Addr().Interface().(*jwt.RegisteredClaims)
+		case field.Type() == reflect.PointerTo(registeredClaimsType):
+			if field.IsNil() {
+				field.Set(reflect.New(registeredClaimsType))
+			}
+			return field.Interface().(*jwt.RegisteredClaims)
+		}
+	}
+	return nil
+}
+
+// Fills in the registered claims that have not been set using the configuration.
+// The issuer and audience come from the configuration, the expiration is derived from Lifetime,
+// iat and nbf are set to the current time and the jti is a random UUID.
+// Values that are already set are left untouched so callers can override any of them.
+func (config *AuthenticatorConfig) stampRegisteredClaims(claims any) {
+	now := config.now()
+
+	if mapClaims, ok := claims.(jwt.MapClaims); ok {
+		setIfMissing := func(key string, value any) {
+			if _, ok := mapClaims[key]; !ok {
+				mapClaims[key] = value
+			}
+		}
+		setIfMissing("iss", config.Issuer)
+		setIfMissing("aud", slices.Clone(config.Audience))
+		setIfMissing("exp", jwt.NewNumericDate(now.Add(config.Lifetime)))
+		setIfMissing("iat", jwt.NewNumericDate(now))
+		setIfMissing("nbf", jwt.NewNumericDate(now))
+		setIfMissing("jti", uuid.NewString())
+		return
+	}
+
+	registered := registeredClaimsOf(claims)
+	if registered == nil {
+		return
+	}
+	if registered.Issuer == "" {
+		registered.Issuer = config.Issuer
+	}
+	if len(registered.Audience) == 0 {
+		registered.Audience = slices.Clone(config.Audience)
+	}
+	if registered.ExpiresAt == nil {
+		registered.ExpiresAt = jwt.NewNumericDate(now.Add(config.Lifetime))
+	}
+	if registered.IssuedAt == nil {
+		registered.IssuedAt = jwt.NewNumericDate(now)
+	}
+	if registered.NotBefore == nil {
+		registered.NotBefore = jwt.NewNumericDate(now)
+	}
+	if registered.ID == "" {
+		registered.ID = uuid.NewString()
+	}
+}
+
+// Returns the `jti` claim of the provided claims or an empty string if it has none.
+func tokenIDOf(claims any) string {
+	if mapClaims, ok := claims.(jwt.MapClaims); ok {
+		id, _ := mapClaims["jti"].(string)
+		return id
+	}
+	if registered := registeredClaimsOf(claims); registered != nil {
+		return registered.ID
+	}
+	return ""
+}
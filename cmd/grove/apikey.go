@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func apiKeyHelp() {
+	fmt.Println("API key command help:")
+	fmt.Println("Usage: grove apikey [-prefix <prefix>] [-subject <subject>] [-scopes <scope1,scope2>] [-expires <duration>]")
+	fmt.Println("This command generates a new API key for APIKeyMiddleware.")
+	fmt.Println("The key is printed once and must be handed to the client, store the printed record instead of the key.")
+}
+
+func handleAPIKeyCommand(args []string) error {
+	if len(args) > 0 && (args[0] == "help" || args[0] == "--help") {
+		apiKeyHelp()
+		return nil
+	}
+
+	flags := flag.NewFlagSet("apikey", flag.ContinueOnError)
+	flags.Usage = apiKeyHelp
+	prefix := flags.String("prefix", grove.DefaultAPIKeyPrefix, "Prefix of the key, useful to tell keys of different services apart")
+	subject := flags.String("subject", "", "Subject of the principal the key authenticates")
+	scopes := flags.String("scopes", "", "Comma separated scopes granted to the key")
+	expires := flags.Duration("expires", 0, "How long the key is valid, e.g. 720h. The key never expires if it is zero")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *expires < 0 {
+		return fmt.Errorf("expires cannot be negative")
+	}
+
+	key, record, err := grove.GenerateAPIKey(*prefix)
+	if err != nil {
+		return err
+	}
+	record.Subject = *subject
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			record.Scopes = append(record.Scopes, scope)
+		}
+	}
+	if *expires > 0 {
+		record.ExpiresAt = time.Now().Add(*expires).UTC().Truncate(time.Second)
+	}
+
+	encoded, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("API key (it is only shown once):")
+	fmt.Println(key)
+	fmt.Println()
+	fmt.Println("Record to save in your API key store:")
+	fmt.Println(string(encoded))
+	return nil
+}
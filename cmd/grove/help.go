@@ -12,6 +12,8 @@ func writeHelpMenu() {
 	builder.WriteString("  create <controller|resource> <name> [<field_name:go_type> ...] - Generates a new controller or resource with the fields specified.\n")
 	builder.WriteString("  init <project-name> - Initialize a new Grove project\n")
 	builder.WriteString("    - <project-name> is the name of the project and will be used as the go mod name if go mod doesn't already exists.\n")
+	builder.WriteString("  apikey [-prefix <prefix>] [-subject <subject>] [-scopes <scope1,scope2>] [-expires <duration>] - Generates a new API key\n")
+	builder.WriteString("    - Prints the key, which is only shown once, and the hashed record to save in the API key store.\n")
 	builder.WriteString("  help - Show this help menu\n")
 	fmt.Println(builder.String())
 }
@@ -50,6 +50,11 @@ func main() {
 		}
 	case "init":
 		handleInitCommand(os.Args[2:])
+	case "apikey":
+		if err := handleAPIKeyCommand(os.Args[2:]); err != nil {
+			fmt.Println("Error generating API key:", err.Error())
+			return
+		}
 	case "help":
 		writeHelpMenu()
 	default:
@@ -0,0 +1,105 @@
+package grove
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The name of the session cookie when SessionCookieConfig.Name is not set.
+const DefaultSessionCookieName = "session_token"
+
+// Settings of the cookie `SetSessionCookie` writes the token to and `DefaultAuthMiddleware`
+// reads it from.
+// The zero value is the hardened default: a host-only, HttpOnly, Secure cookie named
+// DefaultSessionCookieName with the path "/" and SameSite=Lax.
+type SessionCookieConfig struct {
+	// The name of the cookie. Defaults to DefaultSessionCookieName.
+	// Names starting with `__Host-` or `__Secure-` must meet the requirements of the prefix.
+	Name string
+	// The domain the cookie is sent to. If empty the cookie is only sent to the host that set it.
+	Domain string
+	// The path the cookie is sent to. Defaults to "/".
+	Path string
+	// Disables the Secure flag so the cookie is sent over plain HTTP.
+	// It should only be used for local development.
+	Insecure bool
+	// The SameSite attribute of the cookie. Defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+func (config SessionCookieConfig) name() string {
+	if config.Name == "" {
+		return DefaultSessionCookieName
+	}
+	return config.Name
+}
+
+func (config SessionCookieConfig) path() string {
+	if config.Path == "" {
+		return "/"
+	}
+	return config.Path
+}
+
+func (config SessionCookieConfig) sameSite() http.SameSite {
+	if config.SameSite == http.SameSiteDefaultMode || config.SameSite == 0 {
+		return http.SameSiteLaxMode
+	}
+	return config.SameSite
+}
+
+// Function that validates the SessionCookieConfig.
+// It rejects combinations browsers silently refuse, such as SameSite=None without Secure.
+func (config SessionCookieConfig) Validate() error {
+	name := config.name()
+	if strings.ContainsAny(name, " \t\r\n\"(),/:;<=>?@[\\]{}") {
+		return fmt.Errorf("invalid session cookie name: %q", name)
+	}
+	if !strings.HasPrefix(config.path(), "/") {
+		return fmt.Errorf("session cookie path must start with /")
+	}
+	if config.sameSite() == http.SameSiteNoneMode && config.Insecure {
+		return fmt.Errorf("session cookie with SameSite=None must be secure")
+	}
+	if strings.HasPrefix(name, "__Secure-") && config.Insecure {
+		return fmt.Errorf("session cookie %q must be secure", name)
+	}
+	if strings.HasPrefix(name, "__Host-") && (config.Insecure || config.Domain != "" || config.path() != "/") {
+		return fmt.Errorf("session cookie %q must be secure, have no domain and use the path /", name)
+	}
+	return nil
+}
+
+// Builds the session cookie with the provided value and maximum age.
+func (config SessionCookieConfig) cookie(value string, maxAge int, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     config.name(),
+		Value:    value,
+		Domain:   config.Domain,
+		Path:     config.path(),
+		MaxAge:   maxAge,
+		Expires:  expires,
+		Secure:   !config.Insecure,
+		HttpOnly: true,
+		SameSite: config.sameSite(),
+	}
+}
+
+// SessionCookieName returns the name of the session cookie.
+// `DefaultAuthMiddleware` uses it to read the token when the request has no `Authorization` header.
+func (a *Authenticator[T]) SessionCookieName() string {
+	return a.SessionCookie.name()
+}
+
+// SetSessionCookie writes the token to the session cookie.
+// The cookie expires together with the token, after Lifetime.
+func (a *Authenticator[T]) SetSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, a.SessionCookie.cookie(token, int(a.Lifetime.Seconds()), a.now().Add(a.Lifetime)))
+}
+
+// ClearSessionCookie expires the session cookie.
+func (a *Authenticator[T]) ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, a.SessionCookie.cookie("", -1, time.Unix(0, 0)))
+}
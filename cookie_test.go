@@ -0,0 +1,131 @@
+package grove_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func TestSetSessionCookieUsesHardenedDefaults(t *testing.T) {
+	now := time.Now()
+	config := validConfig(t, false)
+	config.Clock = fixedClock(now)
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	rec := httptest.NewRecorder()
+	auth.SetSessionCookie(rec, "token")
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies; want 1", len(cookies))
+	}
+	cookie := cookies[0]
+	if cookie.Name != grove.DefaultSessionCookieName || cookie.Value != "token" || cookie.Path != "/" {
+		t.Fatalf("cookie = %v; want %s=token with path /", cookie, grove.DefaultSessionCookieName)
+	}
+	if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("cookie = %v; want Secure, HttpOnly and SameSite=Lax", cookie)
+	}
+	if cookie.MaxAge != int(time.Hour.Seconds()) {
+		t.Fatalf("MaxAge = %d; want %d", cookie.MaxAge, int(time.Hour.Seconds()))
+	}
+	if want := now.Add(time.Hour).Truncate(time.Second); !cookie.Expires.Equal(want) {
+		t.Fatalf("Expires = %v; want %v", cookie.Expires, want)
+	}
+}
+
+func TestSessionCookieConfigIsUsedByMiddleware(t *testing.T) {
+	config := validConfig(t, false)
+	config.SessionCookie = grove.SessionCookieConfig{
+		Name:     "__Host-auth",
+		SameSite: http.SameSiteStrictMode,
+	}
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+	rec := httptest.NewRecorder()
+	auth.SetSessionCookie(rec, token)
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Name != "__Host-auth" || cookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("cookie = %v; want __Host-auth with SameSite=Strict", cookie)
+	}
+
+	handler := grove.DefaultAuthMiddleware(auth, &testLogger{}, func() *TestClaims { return &TestClaims{} })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	for name, want := range map[string]int{"__Host-auth": http.StatusOK, grove.DefaultSessionCookieName: http.StatusUnauthorized} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: name, Value: token})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != want {
+				t.Fatalf("status = %d; want %d", rec.Code, want)
+			}
+		})
+	}
+}
+
+func TestClearSessionCookie(t *testing.T) {
+	config := validConfig(t, false)
+	config.SessionCookie = grove.SessionCookieConfig{Name: "auth", Domain: "example.com", Path: "/app"}
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	rec := httptest.NewRecorder()
+	auth.ClearSessionCookie(rec)
+
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Name != "auth" || cookie.Domain != "example.com" || cookie.Path != "/app" {
+		t.Fatalf("cookie = %v; want auth with the configured domain and path", cookie)
+	}
+	if cookie.Value != "" || cookie.MaxAge >= 0 {
+		t.Fatalf("cookie = %v; want an empty expired cookie", cookie)
+	}
+}
+
+func TestSessionCookieConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  grove.SessionCookieConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: grove.SessionCookieConfig{}},
+		{name: "insecure for development", config: grove.SessionCookieConfig{Insecure: true}},
+		{name: "invalid name", config: grove.SessionCookieConfig{Name: "session token"}, wantErr: true},
+		{name: "relative path", config: grove.SessionCookieConfig{Path: "app"}, wantErr: true},
+		{name: "SameSite none without secure", config: grove.SessionCookieConfig{Insecure: true, SameSite: http.SameSiteNoneMode}, wantErr: true},
+		{name: "secure prefix without secure", config: grove.SessionCookieConfig{Name: "__Secure-auth", Insecure: true}, wantErr: true},
+		{name: "host prefix with domain", config: grove.SessionCookieConfig{Name: "__Host-auth", Domain: "example.com"}, wantErr: true},
+		{name: "host prefix with path", config: grove.SessionCookieConfig{Name: "__Host-auth", Path: "/app"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr && err == nil {
+				t.Fatalf("Validate() error = nil; want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Validate() error = %v; want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package grove
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of `CORSConfig`.
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	DefaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", DefaultCSRFHeaderName}
+)
+
+// How long browsers cache preflight responses when MaxAge is not set.
+const DefaultCORSMaxAge = 10 * time.Minute
+
+// Config used by `CORSMiddleware`.
+type CORSConfig struct {
+	// Origins allowed to send requests. An entry is either an exact origin such as
+	// `https://app.example.com`, an origin with a wildcard subdomain such as
+	// `https://*.example.com`, which does not match `https://example.com` itself, or `*` for any
+	// origin.
+	AllowedOrigins []string
+	// Decides whether an origin that is not in AllowedOrigins is allowed. Optional.
+	AllowOriginFunc func(r *http.Request, origin string) bool
+	// Methods allowed in cross-origin requests. Defaults to DefaultCORSMethods.
+	AllowedMethods []string
+	// Request headers allowed in cross-origin requests, compared case-insensitively. `*` allows
+	// any header. Defaults to DefaultCORSHeaders.
+	AllowedHeaders []string
+	// Response headers scripts on the other origin may read besides the CORS-safelisted ones.
+	ExposedHeaders []string
+	// Lets the browser send cookies and the `Authorization` header and expose the response.
+	// It cannot be combined with the `*` origin.
+	AllowCredentials bool
+	// How long browsers may cache the preflight response. Defaults to DefaultCORSMaxAge, a
+	// negative value disables caching.
+	MaxAge time.Duration
+}
+
+// Function that validates the CORSConfig.
+// If any values are missing it will return an error.
+// If it is valid it will return nil.
+func (config *CORSConfig) Validate() error {
+	if len(config.AllowedOrigins) == 0 && config.AllowOriginFunc == nil {
+		return fmt.Errorf("CORS requires allowed origins or an origin function")
+	}
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			if config.AllowCredentials {
+				return fmt.Errorf("CORS credentials cannot be allowed for any origin")
+			}
+			continue
+		}
+		u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || strings.Contains(u.Host, "*") {
+			return fmt.Errorf("invalid CORS origin: %q", origin)
+		}
+	}
+	return nil
+}
+
+type cors struct {
+	config      CORSConfig
+	anyOrigin   bool
+	origins     map[string]struct{}
+	wildcards   []string
+	methods     map[string]struct{}
+	anyHeader   bool
+	headers     map[string]struct{}
+	methodsList string
+	maxAge      string
+}
+
+func (c *cors) originAllowed(r *http.Request, origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if _, ok := c.origins[lower]; ok {
+		return true
+	}
+	for _, wildcard := range c.wildcards {
+		prefix, suffix, _ := strings.Cut(wildcard, "*")
+		if strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) && len(lower) > len(prefix)+len(suffix) {
+			return true
+		}
+	}
+	return c.config.AllowOriginFunc != nil && c.config.AllowOriginFunc(r, origin)
+}
+
+// Reports whether every header of an Access-Control-Request-Headers value is allowed.
+func (c *cors) headersAllowed(requested string) bool {
+	if c.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+		if _, ok := c.headers[header]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cors) writeOrigin(w http.ResponseWriter, origin string) {
+	if c.anyOrigin && !c.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+	_, methodAllowed := c.methods[method]
+	if !c.originAllowed(r, origin) || !methodAllowed || !c.headersAllowed(requestedHeaders) {
+		WriteErrorToResponse(w, http.StatusForbidden, "CORS request not allowed")
+		return
+	}
+
+	c.writeOrigin(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", c.methodsList)
+	if requestedHeaders != "" {
+		w.Header().Set("Access-Control-Allow-Headers", requestedHeaders)
+	}
+	w.Header().Set("Access-Control-Max-Age", c.maxAge)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CORSMiddleware lets browser apps on other origins call the routes it wraps.
+// Preflight requests, `OPTIONS` requests with an Access-Control-Request-Method header, are
+// answered by the middleware with 204 No Content and never reach the routes, so no `OPTIONS`
+// route has to be registered on the `App` or `Scope`. Preflights for a disallowed origin, method
+// or header get 403 Forbidden. Other requests from allowed origins get the CORS headers and are
+// passed on, requests from other origins are passed on without them so the browser hides the
+// response.
+//
+// The middleware must be registered before authentication middleware, such as
+// `DefaultAuthMiddleware`, because browsers send preflights without credentials.
+func CORSMiddleware(config CORSConfig) (Middleware, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if len(config.AllowedMethods) == 0 {
+		config.AllowedMethods = DefaultCORSMethods
+	}
+	if len(config.AllowedHeaders) == 0 {
+		config.AllowedHeaders = DefaultCORSHeaders
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = DefaultCORSMaxAge
+	}
+
+	c := &cors{
+		config:  config,
+		origins: make(map[string]struct{}),
+		methods: make(map[string]struct{}),
+		headers: make(map[string]struct{}),
+		maxAge:  strconv.Itoa(int(config.MaxAge.Seconds())),
+	}
+	if config.MaxAge < 0 {
+		c.maxAge = "0"
+	}
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			c.wildcards = append(c.wildcards, origin)
+		default:
+			c.origins[origin] = struct{}{}
+		}
+	}
+	methods := make([]string, 0, len(config.AllowedMethods))
+	for _, method := range config.AllowedMethods {
+		method = strings.ToUpper(method)
+		c.methods[method] = struct{}{}
+		methods = append(methods, method)
+	}
+	c.methodsList = strings.Join(methods, ", ")
+	for _, header := range config.AllowedHeaders {
+		if header == "*" {
+			c.anyHeader = true
+		}
+		c.headers[strings.ToLower(header)] = struct{}{}
+	}
+	exposed := strings.Join(config.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, r, origin)
+				return
+			}
+
+			if c.originAllowed(r, origin) {
+				c.writeOrigin(w, origin)
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
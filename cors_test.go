@@ -0,0 +1,168 @@
+package grove_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func corsScope(t *testing.T, config grove.CORSConfig) http.Handler {
+	t.Helper()
+
+	middleware, err := grove.CORSMiddleware(config)
+	if err != nil {
+		t.Fatalf("CORSMiddleware() error = %v; want nil", err)
+	}
+	return grove.NewScope("cors").
+		WithMiddleware(middleware).
+		WithRoute("POST /items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+}
+
+func preflight(handler http.Handler, origin string, method string, headers string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodOptions, "/items", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSMiddlewareValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config grove.CORSConfig
+	}{
+		{name: "no origins", config: grove.CORSConfig{}},
+		{name: "credentials with any origin", config: grove.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}},
+		{name: "origin without scheme", config: grove.CORSConfig{AllowedOrigins: []string{"example.com"}}},
+		{name: "origin with path", config: grove.CORSConfig{AllowedOrigins: []string{"https://example.com/app"}}},
+		{name: "wildcard in the middle", config: grove.CORSConfig{AllowedOrigins: []string{"https://app.*.example.com"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := grove.CORSMiddleware(tt.config); err == nil {
+				t.Fatalf("CORSMiddleware() error = nil; want error")
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewarePreflightWithoutOptionsRoute(t *testing.T) {
+	handler := corsScope(t, grove.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowOriginFunc:  func(r *http.Request, origin string) bool { return origin == "http://localhost:3000" },
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	})
+
+	tests := []struct {
+		name       string
+		origin     string
+		method     string
+		headers    string
+		wantStatus int
+	}{
+		{name: "exact origin", origin: "https://app.example.com", method: http.MethodPost, headers: "content-type, authorization", wantStatus: http.StatusNoContent},
+		{name: "wildcard subdomain", origin: "https://tenant.example.org", method: http.MethodPost, wantStatus: http.StatusNoContent},
+		{name: "origin function", origin: "http://localhost:3000", method: http.MethodPost, wantStatus: http.StatusNoContent},
+		{name: "wildcard does not match the bare domain", origin: "https://example.org", method: http.MethodPost, wantStatus: http.StatusForbidden},
+		{name: "wildcard does not match another scheme", origin: "http://tenant.example.org", method: http.MethodPost, wantStatus: http.StatusForbidden},
+		{name: "unknown origin", origin: "https://evil.example", method: http.MethodPost, wantStatus: http.StatusForbidden},
+		{name: "disallowed method", origin: "https://app.example.com", method: "PROPFIND", wantStatus: http.StatusForbidden},
+		{name: "disallowed header", origin: "https://app.example.com", method: http.MethodPost, headers: "X-Debug", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := preflight(handler, tt.origin, tt.method, tt.headers)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusNoContent {
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+					t.Fatalf("Access-Control-Allow-Origin = %q; want none", got)
+				}
+				return
+			}
+
+			want := map[string]string{
+				"Access-Control-Allow-Origin":      tt.origin,
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers":     tt.headers,
+				"Access-Control-Max-Age":           "3600",
+			}
+			for header, value := range want {
+				if got := rec.Header().Get(header); got != value {
+					t.Errorf("%s = %q; want %q", header, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewareActualRequest(t *testing.T) {
+	handler := corsScope(t, grove.CORSConfig{
+		AllowedOrigins: []string{"*"},
+		ExposedHeaders: []string{"X-Request-Id"},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusCreated)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Access-Control-Allow-Origin = %q; want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-Id" {
+		t.Fatalf("Access-Control-Expose-Headers = %q; want X-Request-Id", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Fatalf("Access-Control-Allow-Credentials = %q; want none", got)
+	}
+	if got := rec.Header().Values("Vary"); len(got) == 0 || got[0] != "Origin" {
+		t.Fatalf("Vary = %v; want Origin", got)
+	}
+}
+
+func TestCORSMiddlewareIgnoresSameOriginAndDisallowedRequests(t *testing.T) {
+	handler := corsScope(t, grove.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}})
+
+	for _, origin := range []string{"", "https://evil.example"} {
+		req := httptest.NewRequest(http.MethodPost, "/items", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("origin %q: status = %d; want %d", origin, rec.Code, http.StatusCreated)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Fatalf("origin %q: Access-Control-Allow-Origin = %q; want none", origin, got)
+		}
+	}
+
+	// A plain OPTIONS request is not a preflight and still reaches the mux.
+	req := httptest.NewRequest(http.MethodOptions, "/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("OPTIONS status = %d; want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
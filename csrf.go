@@ -0,0 +1,310 @@
+package grove
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Defaults of `CSRFConfig`.
+const (
+	DefaultCSRFCookieName = "csrf_token"
+	DefaultCSRFHeaderName = "X-CSRF-Token"
+	DefaultCSRFFieldName  = "csrf_token"
+)
+
+// The session value holding the token in CSRFSynchronizer mode.
+const csrfSessionKey = "grove.csrf_token"
+
+var (
+	ErrCSRFTokenInvalid  = errors.New("CSRF token missing or invalid")
+	ErrCSRFOriginInvalid = errors.New("request origin not allowed")
+)
+
+// CSRFMode selects where `CSRFMiddleware` keeps the expected token.
+type CSRFMode int
+
+const (
+	// The token is kept in a cookie readable by JavaScript, signed together with the session
+	// cookies, and every request has to echo it in a header or form field. No server-side state
+	// is required.
+	CSRFDoubleSubmit CSRFMode = iota
+	// The token is kept in the server-side `Session`, so `Sessions.Middleware` must run before
+	// `CSRFMiddleware`. The token is not written to a cookie.
+	CSRFSynchronizer
+)
+
+type csrfTokenKeyType struct{}
+
+// Key that should be used to pull the CSRF token of the request from the request context.
+// Prefer `CSRFToken` and `CSRFTemplateField`.
+var CSRFTokenKey = csrfTokenKeyType{}
+
+type csrfFieldKeyType struct{}
+
+var csrfFieldKey = csrfFieldKeyType{}
+
+// CSRFToken returns the token that has to be sent back with unsafe requests, either in the
+// header configured in `CSRFConfig` or in a form field. It is empty if `CSRFMiddleware` did not run.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(CSRFTokenKey).(string)
+	return token
+}
+
+// CSRFTemplateField returns a hidden input holding the token, to be embedded in HTML forms:
+//
+//	<form method="post">{{ .CSRFField }}</form>
+func CSRFTemplateField(r *http.Request) template.HTML {
+	field, _ := r.Context().Value(csrfFieldKey).(string)
+	if field == "" {
+		field = DefaultCSRFFieldName
+	}
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(field), template.HTMLEscapeString(CSRFToken(r))))
+}
+
+// Config used by `CSRFMiddleware`.
+type CSRFConfig struct {
+	// Where the expected token is kept. Defaults to CSRFDoubleSubmit.
+	Mode CSRFMode
+	// The key used to sign the token cookie with HMAC-SHA256. It must be at least 32 bytes.
+	// Required in CSRFDoubleSubmit mode.
+	Secret []byte
+	// The cookies identifying the user that tokens are bound to in CSRFDoubleSubmit mode.
+	// Defaults to DefaultSessionCookieName and DefaultSessionIDCookieName.
+	// The signature covers their values, so a token cookie planted by a sibling subdomain is
+	// only accepted together with the session it was issued for. Requests carrying none of
+	// these cookies get tokens bound to no session, which a sibling subdomain can plant, and are
+	// only protected by the Origin check. Tokens are replaced when the user logs in.
+	SessionCookieNames []string
+	// Settings of the token cookie in CSRFDoubleSubmit mode. The name defaults to
+	// DefaultCSRFCookieName. The cookie is never HttpOnly so single page apps can read it.
+	Cookie SessionCookieConfig
+	// The header the token is read from. Defaults to DefaultCSRFHeaderName.
+	HeaderName string
+	// The form field the token is read from. Defaults to DefaultCSRFFieldName.
+	FieldName string
+	// Origins, such as `https://app.example.com`, that may send requests besides the host the
+	// request was sent to.
+	TrustedOrigins []string
+	// Writes the response of rejected requests. The error is ErrCSRFOriginInvalid or
+	// ErrCSRFTokenInvalid. Defaults to a 403 response in the shape of `WriteErrorToResponse`.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Function that validates the CSRFConfig.
+// If any values are missing it will return an error.
+// If it is valid it will return nil.
+func (config *CSRFConfig) Validate() error {
+	switch config.Mode {
+	case CSRFDoubleSubmit:
+		if len(config.Secret) < 32 {
+			return fmt.Errorf("CSRF secret must be at least 32 bytes")
+		}
+	case CSRFSynchronizer:
+	default:
+		return fmt.Errorf("unknown CSRF mode: %d", config.Mode)
+	}
+	for _, origin := range config.TrustedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("invalid trusted origin: %q", origin)
+		}
+	}
+	return config.cookie().Validate()
+}
+
+func (config *CSRFConfig) cookie() SessionCookieConfig {
+	cookie := config.Cookie
+	if cookie.Name == "" {
+		cookie.Name = DefaultCSRFCookieName
+	}
+	return cookie
+}
+
+type csrf struct {
+	config         CSRFConfig
+	cookie         SessionCookieConfig
+	trustedOrigins map[string]struct{}
+}
+
+// Returns the token with its HMAC, as written to the cookie in CSRFDoubleSubmit mode.
+// The HMAC covers the session cookies of the request, binding the token to the session.
+func (c *csrf) sign(r *http.Request, nonce string) string {
+	mac := hmac.New(sha256.New, c.config.Secret)
+	mac.Write([]byte(nonce))
+	for _, name := range c.config.SessionCookieNames {
+		value := ""
+		if cookie, err := r.Cookie(name); err == nil {
+			value = cookie.Value
+		}
+		// Every part is length prefixed so values cannot be shifted between cookies.
+		fmt.Fprintf(mac, "\x00%d:%s%d:%s", len(name), name, len(value), value)
+	}
+	return nonce + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *csrf) validSignature(r *http.Request, token string) bool {
+	nonce, _, ok := strings.Cut(token, ".")
+	return ok && nonce != "" && hmac.Equal([]byte(c.sign(r, nonce)), []byte(token))
+}
+
+// Returns the token of the request, creating and storing a new one if it has none.
+func (c *csrf) token(w http.ResponseWriter, r *http.Request) (string, error) {
+	if c.config.Mode == CSRFSynchronizer {
+		session, ok := SessionFromContext(r.Context())
+		if !ok {
+			return "", fmt.Errorf("CSRF synchronizer mode requires Sessions.Middleware")
+		}
+		if token := session.GetString(csrfSessionKey); token != "" {
+			return token, nil
+		}
+		token, err := randomURLSafe()
+		if err != nil {
+			return "", err
+		}
+		session.Set(csrfSessionKey, token)
+		return token, nil
+	}
+
+	if cookie, err := r.Cookie(c.cookie.name()); err == nil && c.validSignature(r, cookie.Value) {
+		return cookie.Value, nil
+	}
+	nonce, err := randomURLSafe()
+	if err != nil {
+		return "", err
+	}
+	token := c.sign(r, nonce)
+	cookie := c.cookie.cookie(token, 0, time.Time{})
+	cookie.HttpOnly = false
+	http.SetCookie(w, cookie)
+	return token, nil
+}
+
+// Checks the Origin header, or the Referer header when there is none, against the host of the
+// request and the trusted origins. Requests without either header are left to the token check,
+// some privacy tools strip both.
+func (c *csrf) checkOrigin(r *http.Request) error {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return nil
+	}
+
+	u, err := url.Parse(source)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ErrCSRFOriginInvalid
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	if _, ok := c.trustedOrigins[origin]; ok {
+		return nil
+	}
+	if r.TLS != nil && !strings.EqualFold(u.Scheme, "https") {
+		return ErrCSRFOriginInvalid
+	}
+	if !strings.EqualFold(u.Host, r.Host) {
+		return ErrCSRFOriginInvalid
+	}
+	return nil
+}
+
+// Returns the token sent with the request in the header or the form field.
+func (c *csrf) submittedToken(r *http.Request) string {
+	if token := r.Header.Get(c.config.HeaderName); token != "" {
+		return token
+	}
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") || strings.HasPrefix(contentType, "multipart/form-data") {
+		return r.PostFormValue(c.config.FieldName)
+	}
+	return ""
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// CSRFMiddleware protects cookie-authenticated routes against cross-site request forgery.
+// Every request gets a token, available through `CSRFToken` and `CSRFTemplateField` and sent to
+// single page apps in the response header named by HeaderName. In CSRFDoubleSubmit mode the token
+// is also in the cookie, which JavaScript can read.
+//
+// Requests with a safe method (GET, HEAD, OPTIONS and TRACE) and requests carrying an
+// `Authorization: Bearer` header, which browsers never attach on their own, are not checked.
+// Other requests must come from the host they were sent to or from one of the TrustedOrigins,
+// according to their Origin or Referer header, and must echo the token in the header or the form
+// field. Rejected requests get 403 Forbidden.
+func CSRFMiddleware(config CSRFConfig, logger ILogger) (Middleware, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = DefaultCSRFHeaderName
+	}
+	if config.FieldName == "" {
+		config.FieldName = DefaultCSRFFieldName
+	}
+	if len(config.SessionCookieNames) == 0 {
+		config.SessionCookieNames = []string{DefaultSessionCookieName, DefaultSessionIDCookieName}
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			WriteErrorToResponse(w, http.StatusForbidden, err.Error())
+		}
+	}
+
+	c := &csrf{config: config, cookie: config.cookie(), trustedOrigins: make(map[string]struct{})}
+	for _, origin := range config.TrustedOrigins {
+		c.trustedOrigins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = struct{}{}
+	}
+	bearer := BearerTokenExtractor()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isSafeMethod(r.Method) && bearer(r) != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := c.token(w, r)
+			if err != nil {
+				logger.Errorf("Failed to create CSRF token: %v", err)
+				WriteErrorToResponse(w, http.StatusInternalServerError, "failed to create CSRF token")
+				return
+			}
+
+			if !isSafeMethod(r.Method) {
+				if err := c.checkOrigin(r); err != nil {
+					c.config.ErrorHandler(w, r, err)
+					return
+				}
+				submitted := c.submittedToken(r)
+				if submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+					c.config.ErrorHandler(w, r, ErrCSRFTokenInvalid)
+					return
+				}
+			}
+
+			w.Header().Set(c.config.HeaderName, token)
+			w.Header().Add("Vary", "Cookie")
+			ctx := context.WithValue(r.Context(), CSRFTokenKey, token)
+			ctx = context.WithValue(ctx, csrfFieldKey, c.config.FieldName)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
@@ -0,0 +1,220 @@
+package grove_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+var csrfSecret = []byte("abcdef0123456789abcdef0123456789")
+
+func csrfHandler(t *testing.T, config grove.CSRFConfig) http.Handler {
+	t.Helper()
+
+	middleware, err := grove.CSRFMiddleware(config, grove.NewDefaultLogger("test"))
+	if err != nil {
+		t.Fatalf("CSRFMiddleware() error = %v; want nil", err)
+	}
+	return middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(grove.CSRFTemplateField(r)))
+	}))
+}
+
+// Fetches a page and returns the token and the cookie of the double submit mode.
+func fetchCSRFToken(t *testing.T, handler http.Handler) (string, *http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/form", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	token := rec.Header().Get(grove.DefaultCSRFHeaderName)
+	if token == "" {
+		t.Fatalf("response has no %s header", grove.DefaultCSRFHeaderName)
+	}
+	if !strings.Contains(rec.Body.String(), `name="csrf_token" value="`+token+`"`) {
+		t.Fatalf("CSRFTemplateField() = %s; want a hidden input with the token", rec.Body.String())
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == grove.DefaultCSRFCookieName {
+			return token, cookie
+		}
+	}
+	return token, nil
+}
+
+func TestCSRFMiddlewareValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config grove.CSRFConfig
+	}{
+		{name: "double submit without secret", config: grove.CSRFConfig{}},
+		{name: "unknown mode", config: grove.CSRFConfig{Mode: 5, Secret: csrfSecret}},
+		{name: "invalid trusted origin", config: grove.CSRFConfig{Secret: csrfSecret, TrustedOrigins: []string{"example.com"}}},
+		{name: "invalid cookie", config: grove.CSRFConfig{Secret: csrfSecret, Cookie: grove.SessionCookieConfig{Name: "bad name"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := grove.CSRFMiddleware(tt.config, grove.NewDefaultLogger("test")); err == nil {
+				t.Fatalf("CSRFMiddleware() error = nil; want error")
+			}
+		})
+	}
+}
+
+func TestCSRFMiddlewareDoubleSubmit(t *testing.T) {
+	handler := csrfHandler(t, grove.CSRFConfig{Secret: csrfSecret, TrustedOrigins: []string{"https://app.example.com"}})
+	token, cookie := fetchCSRFToken(t, handler)
+	if cookie == nil || cookie.HttpOnly || cookie.Value != token {
+		t.Fatalf("cookie = %+v; want a cookie readable by JavaScript holding the token", cookie)
+	}
+
+	form := url.Values{"csrf_token": {token}}.Encode()
+	tests := []struct {
+		name       string
+		header     map[string]string
+		body       string
+		cookie     *http.Cookie
+		wantStatus int
+	}{
+		{name: "header", header: map[string]string{grove.DefaultCSRFHeaderName: token}, cookie: cookie, wantStatus: http.StatusOK},
+		{name: "form field", header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, body: form, cookie: cookie, wantStatus: http.StatusOK},
+		{name: "same origin", header: map[string]string{grove.DefaultCSRFHeaderName: token, "Origin": "http://example.com"}, cookie: cookie, wantStatus: http.StatusOK},
+		{name: "trusted origin", header: map[string]string{grove.DefaultCSRFHeaderName: token, "Origin": "https://app.example.com"}, cookie: cookie, wantStatus: http.StatusOK},
+		{name: "bearer request", header: map[string]string{"Authorization": "Bearer token"}, wantStatus: http.StatusOK},
+		{name: "missing token", cookie: cookie, wantStatus: http.StatusForbidden},
+		{name: "missing cookie", header: map[string]string{grove.DefaultCSRFHeaderName: token}, wantStatus: http.StatusForbidden},
+		{name: "forged cookie", header: map[string]string{grove.DefaultCSRFHeaderName: "forged.token"}, cookie: &http.Cookie{Name: cookie.Name, Value: "forged.token"}, wantStatus: http.StatusForbidden},
+		{name: "cross origin", header: map[string]string{grove.DefaultCSRFHeaderName: token, "Origin": "https://evil.example"}, cookie: cookie, wantStatus: http.StatusForbidden},
+		{name: "cross origin referer", header: map[string]string{grove.DefaultCSRFHeaderName: token, "Referer": "https://evil.example/page"}, cookie: cookie, wantStatus: http.StatusForbidden},
+		{name: "null origin", header: map[string]string{grove.DefaultCSRFHeaderName: token, "Origin": "null"}, cookie: cookie, wantStatus: http.StatusForbidden},
+		{name: "basic auth is not skipped", header: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, cookie: cookie, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://example.com/form", strings.NewReader(tt.body))
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCSRFMiddlewareDoubleSubmitIsBoundToSession(t *testing.T) {
+	handler := csrfHandler(t, grove.CSRFConfig{Secret: csrfSecret})
+	attacker := &http.Cookie{Name: grove.DefaultSessionCookieName, Value: "attacker-session"}
+	victim := &http.Cookie{Name: grove.DefaultSessionCookieName, Value: "victim-session"}
+
+	// The attacker fetches a validly signed token with their own session.
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/form", nil)
+	req.AddCookie(attacker)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	token := rec.Header().Get(grove.DefaultCSRFHeaderName)
+
+	post := func(session *http.Cookie) int {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/form", nil)
+		req.Header.Set(grove.DefaultCSRFHeaderName, token)
+		req.AddCookie(session)
+		req.AddCookie(&http.Cookie{Name: grove.DefaultCSRFCookieName, Value: token})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if status := post(attacker); status != http.StatusOK {
+		t.Fatalf("status with the session of the token = %d; want %d", status, http.StatusOK)
+	}
+	if status := post(victim); status != http.StatusForbidden {
+		t.Fatalf("status with a planted token of another session = %d; want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestCSRFMiddlewareSynchronizer(t *testing.T) {
+	sessions, err := grove.NewSessions(&grove.SessionConfig{Store: grove.NewMemorySessionStore(), Secret: sessionSecret})
+	if err != nil {
+		t.Fatalf("NewSessions() error = %v; want nil", err)
+	}
+	handler := sessions.Middleware(grove.NewDefaultLogger("test"))(csrfHandler(t, grove.CSRFConfig{Mode: grove.CSRFSynchronizer}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/form", nil))
+	token := rec.Header().Get(grove.DefaultCSRFHeaderName)
+	var session *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == grove.DefaultCSRFCookieName {
+			t.Fatalf("synchronizer mode wrote the %s cookie", cookie.Name)
+		}
+		if cookie.Name == grove.DefaultSessionIDCookieName {
+			session = cookie
+		}
+	}
+	if token == "" || session == nil {
+		t.Fatalf("GET returned token %q and session cookie %v; want both", token, session)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "valid", token: token, wantStatus: http.StatusOK},
+		{name: "invalid", token: token + "x", wantStatus: http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://example.com/form", nil)
+			req.Header.Set(grove.DefaultCSRFHeaderName, tt.token)
+			req.AddCookie(session)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCSRFMiddlewareSynchronizerRequiresSessions(t *testing.T) {
+	handler := csrfHandler(t, grove.CSRFConfig{Mode: grove.CSRFSynchronizer})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestCSRFMiddlewareWithErrorHandler(t *testing.T) {
+	var got error
+	handler := csrfHandler(t, grove.CSRFConfig{
+		Secret: csrfSecret,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			got = err
+			w.WriteHeader(http.StatusTeapot)
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "http://example.com/item", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTeapot || !errors.Is(got, grove.ErrCSRFOriginInvalid) {
+		t.Fatalf("ErrorHandler got status %d and error %v; want %d and ErrCSRFOriginInvalid", rec.Code, got, http.StatusTeapot)
+	}
+}
@@ -0,0 +1,307 @@
+package grove
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvOption changes how configuration is read from the environment by
+// `LoadAuthenticatorConfigFromEnv` and `LoadConfigFromEnv`.
+type EnvOption func(*envOptions)
+
+type envOptions struct {
+	prefix     string
+	secretsDir string
+}
+
+// WithEnvPrefix prepends the prefix to the name of every variable, so that with the prefix
+// `BILLING` the secret is read from `BILLING_JWT_SECRET`. An underscore is added when the prefix
+// does not end with one.
+func WithEnvPrefix(prefix string) EnvOption {
+	return func(o *envOptions) {
+		if prefix != "" && !strings.HasSuffix(prefix, "_") {
+			prefix += "_"
+		}
+		o.prefix = prefix
+	}
+}
+
+// WithSecretsDirectory also reads variables from files in the directory, named after the
+// variable, such as `/run/secrets/JWT_SECRET`. This is how Docker and Kubernetes mount secrets.
+// Lowercase file names are accepted as well. Variables set in the environment take precedence.
+func WithSecretsDirectory(dir string) EnvOption {
+	return func(o *envOptions) {
+		o.secretsDir = dir
+	}
+}
+
+func newEnvOptions(opts []EnvOption) *envOptions {
+	options := &envOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// Reads a secret file, dropping the trailing newline most editors and `echo` add.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Looks up the variable with the prefix applied. The value is taken from, in order, the variable
+// itself, the file named by the variable with a `_FILE` suffix, and the secrets directory.
+// Empty values are treated as unset.
+func (o *envOptions) lookup(name string) (string, bool, error) {
+	name = o.prefix + name
+
+	if value := os.Getenv(name); value != "" {
+		return value, true, nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		value, err := readSecretFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("an error occurred while reading %s_FILE: %v", name, err)
+		}
+		return value, value != "", nil
+	}
+	if o.secretsDir == "" {
+		return "", false, nil
+	}
+	for _, fileName := range []string{name, strings.ToLower(name)} {
+		value, err := readSecretFile(filepath.Join(o.secretsDir, fileName))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("an error occurred while reading secret %s: %v", name, err)
+		}
+		return value, value != "", nil
+	}
+	return "", false, nil
+}
+
+// Returns the full name of the variable, for error messages.
+func (o *envOptions) name(name string) string {
+	return o.prefix + name
+}
+
+// Parses a duration such as `15m` or `1h30m`. A plain integer is interpreted in the provided
+// unit, which keeps older settings written as a number of minutes working.
+func parseEnvDuration(value string, unit time.Duration) (time.Duration, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(n) * unit, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded private key.
+// It supports PKCS#8 (`PRIVATE KEY`), PKCS#1 (`RSA PRIVATE KEY`) and SEC 1 (`EC PRIVATE KEY`)
+// blocks, skipping other blocks such as the `EC PARAMETERS` written by `openssl ecparam`.
+// Encrypted keys are not supported.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no private key found in PEM data")
+		}
+		if _, encrypted := block.Headers["Proc-Type"]; encrypted || block.Type == "ENCRYPTED PRIVATE KEY" {
+			return nil, fmt.Errorf("encrypted private keys are not supported")
+		}
+
+		var privateKey any
+		var err error
+		switch block.Type {
+		case "PRIVATE KEY":
+			privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("an error occurred while parsing %s: %v", strings.ToLower(block.Type), err)
+		}
+
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("private key of type %T is not supported", privateKey)
+		}
+		return signer, nil
+	}
+}
+
+// Loads a PEM encoded private key either from the variable holding the PEM itself or from the
+// variable holding the path to the PEM file. It returns nil if neither is set.
+func (o *envOptions) privateKey(pemName string, pathName string) (crypto.Signer, error) {
+	data, ok, err := o.lookup(pemName)
+	if err != nil {
+		return nil, err
+	}
+	source := o.name(pemName)
+	if !ok {
+		path, ok, err := o.lookup(pathName)
+		if err != nil || !ok {
+			return nil, err
+		}
+		file, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("an error occurred while reading %s: %v", o.name(pathName), err)
+		}
+		data, source = string(file), o.name(pathName)
+	}
+
+	key, err := ParsePrivateKeyPEM([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while loading %s: %v", source, err)
+	}
+	return key, nil
+}
+
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// LoadConfigFromEnv fills a struct of type T from the environment.
+// Fields are mapped to variables with the `env` tag, for example:
+//
+//	type Config struct {
+//		Port        int           `env:"PORT" envDefault:"8080"`
+//		DatabaseURL string        `env:"DATABASE_URL,required"`
+//		Timeout     time.Duration `env:"TIMEOUT" envDefault:"5s"`
+//		Origins     []string      `env:"ALLOWED_ORIGINS"`
+//	}
+//
+// Values are looked up like `LoadAuthenticatorConfigFromEnv` does, so the `_FILE` suffix, the
+// prefix of WithEnvPrefix and the directory of WithSecretsDirectory work for every field.
+// Supported field types are strings, booleans, integers, floats, time.Duration, comma separated
+// string slices and types implementing encoding.TextUnmarshaler. Struct fields without an `env`
+// tag are filled recursively.
+func LoadConfigFromEnv[T any](opts ...EnvOption) (T, error) {
+	var config T
+	value := reflect.ValueOf(&config).Elem()
+	if value.Kind() != reflect.Struct {
+		return config, fmt.Errorf("LoadConfigFromEnv requires a struct type, got %T", config)
+	}
+	if err := loadStructFromEnv(value, newEnvOptions(opts)); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func loadStructFromEnv(value reflect.Value, options *envOptions) error {
+	for i := range value.NumField() {
+		field := value.Field(i)
+		structField := value.Type().Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		tag, hasTag := structField.Tag.Lookup("env")
+		if !hasTag {
+			if field.Kind() == reflect.Struct && !reflect.PointerTo(field.Type()).Implements(textUnmarshalerType) {
+				if err := loadStructFromEnv(field, options); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		raw, ok, err := options.lookup(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			raw, ok = structField.Tag.Lookup("envDefault")
+		}
+		if !ok {
+			if flags == "required" {
+				return fmt.Errorf("%s was not set", options.name(name))
+			}
+			continue
+		}
+		if err := setFieldFromEnv(field, raw); err != nil {
+			return fmt.Errorf("an error occurred while loading %s: %v", options.name(name), err)
+		}
+	}
+	return nil
+}
+
+func setFieldFromEnv(field reflect.Value, raw string) error {
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(raw))
+	}
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		parts := strings.Split(raw, ",")
+		values := reflect.MakeSlice(field.Type(), 0, len(parts))
+		for _, part := range parts {
+			if part = strings.TrimSpace(part); part != "" {
+				values = reflect.Append(values, reflect.ValueOf(part).Convert(field.Type().Elem()))
+			}
+		}
+		field.Set(values)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package grove_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/go-jose/go-jose/v4"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	rsaKey := testRSAKey(t)
+	ecKey := testECDSAKey(t, elliptic.P256())
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal EC key: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(testEd25519Key(t))
+	if err != nil {
+		t.Fatalf("failed to marshal Ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		pem  []byte
+	}{
+		{name: "PKCS#1", pem: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})},
+		{
+			name: "SEC 1 with parameters",
+			pem: append(
+				pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}}),
+				pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})...,
+			),
+		},
+		{name: "PKCS#8", pem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := grove.ParsePrivateKeyPEM(tt.pem); err != nil {
+				t.Fatalf("ParsePrivateKeyPEM() error = %v; want nil", err)
+			}
+		})
+	}
+
+	invalid := [][]byte{
+		[]byte("not a pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}),
+		pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{1}}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte{1}}),
+	}
+	for _, data := range invalid {
+		if _, err := grove.ParsePrivateKeyPEM(data); err == nil {
+			t.Errorf("ParsePrivateKeyPEM(%q) error = nil; want error", data)
+		}
+	}
+}
+
+func TestLoadAuthenticatorConfigFromEnvWithoutCanEncrypt(t *testing.T) {
+	t.Setenv("JWT_ISSUER", "Testing")
+	t.Setenv("JWT_AUDIENCE", "testing")
+	t.Setenv("JWT_SECRET", "secret")
+
+	got, err := grove.LoadAuthenticatorConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() without key error = %v; want nil", err)
+	}
+	if got.CanEncrypt {
+		t.Fatalf("CanEncrypt = true; want false without a JWE key")
+	}
+
+	der := x509.MarshalPKCS1PrivateKey(testRSAKey(t))
+	t.Setenv("JWT_PRIVATE_KEY_PATH", writeFile(t, "jwe.pem", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})))
+	got, err = grove.LoadAuthenticatorConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() with PKCS#1 key error = %v; want nil", err)
+	}
+	if !got.CanEncrypt || got.JWEPrivateKey == nil {
+		t.Fatalf("CanEncrypt = %v, JWEPrivateKey = %v; want encryption with the RSA key", got.CanEncrypt, got.JWEPrivateKey)
+	}
+
+	t.Setenv("JWT_CAN_ENCRYPT", "false")
+	if got, err := grove.LoadAuthenticatorConfigFromEnv(); err != nil || got.CanEncrypt {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() with JWT_CAN_ENCRYPT=false = %v, %v; want no encryption", got, err)
+	}
+}
+
+func TestLoadAuthenticatorConfigFromEnvWithECKeys(t *testing.T) {
+	jweDER, _ := x509.MarshalECPrivateKey(testECDSAKey(t, elliptic.P256()))
+	signingDER, _ := x509.MarshalECPrivateKey(testECDSAKey(t, elliptic.P256()))
+
+	t.Setenv("JWT_ISSUER", "Testing")
+	t.Setenv("JWT_AUDIENCE", "testing")
+	t.Setenv("JWT_SIGNING_ALGORITHM", "ES256")
+	t.Setenv("JWT_PRIVATE_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: jweDER})))
+	t.Setenv("JWT_SIGNING_KEY_PATH", writeFile(t, "signing.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: signingDER})))
+
+	got, err := grove.LoadAuthenticatorConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = %v; want nil", err)
+	}
+	if got.JWEECDHKey == nil || got.JWEKeyAlgorithm != jose.ECDH_ES {
+		t.Fatalf("JWEECDHKey = %v, JWEKeyAlgorithm = %s; want EC key with ECDH-ES", got.JWEECDHKey, got.JWEKeyAlgorithm)
+	}
+	if _, ok := got.SigningKey.(*ecdsa.PrivateKey); !ok {
+		t.Fatalf("SigningKey = %T; want *ecdsa.PrivateKey", got.SigningKey)
+	}
+
+	if _, err := grove.NewAuthenticator[*TestClaims](got); err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+}
+
+func TestLoadAuthenticatorConfigFromEnvWithFilesAndPrefix(t *testing.T) {
+	secrets := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secrets, "billing_jwt_audience"), []byte("testing,admin\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	t.Setenv("JWT_ISSUER", "Unprefixed")
+	t.Setenv("BILLING_JWT_ISSUER", "Testing")
+	t.Setenv("BILLING_JWT_SECRET_FILE", writeFile(t, "secret", []byte("from-file\n")))
+	t.Setenv("BILLING_JWT_LIFETIME", "1h30m")
+
+	got, err := grove.LoadAuthenticatorConfigFromEnv(grove.WithEnvPrefix("BILLING"), grove.WithSecretsDirectory(secrets))
+	if err != nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() error = %v; want nil", err)
+	}
+	if got.Issuer != "Testing" || got.Key != "from-file" || got.Lifetime != 90*time.Minute {
+		t.Fatalf("config = %+v; want prefixed issuer, secret from file and 1h30m lifetime", got)
+	}
+	if slices.Compare(got.Audience, []string{"admin", "testing"}) != 0 {
+		t.Fatalf("Audience = %v; want [admin testing] from the secrets directory", got.Audience)
+	}
+
+	t.Setenv("BILLING_JWT_SECRET_FILE", filepath.Join(secrets, "missing"))
+	if _, err := grove.LoadAuthenticatorConfigFromEnv(grove.WithEnvPrefix("BILLING_"), grove.WithSecretsDirectory(secrets)); err == nil || !strings.Contains(err.Error(), "BILLING_JWT_SECRET_FILE") {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() with missing secret file error = %v; want error naming the variable", err)
+	}
+}
+
+func TestLoadAuthenticatorConfigFromEnvWithUnusableJWEKeyShouldFail(t *testing.T) {
+	t.Setenv("JWT_ISSUER", "Testing")
+	t.Setenv("JWT_AUDIENCE", "testing")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("JWT_CAN_ENCRYPT", "true")
+
+	if _, err := grove.LoadAuthenticatorConfigFromEnv(); err == nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() with encryption but no key error = nil; want error")
+	}
+
+	t.Setenv("JWT_PRIVATE_KEY_PATH", writePrivateKeyPEM(t, testEd25519Key(t)))
+	if _, err := grove.LoadAuthenticatorConfigFromEnv(); err == nil {
+		t.Fatalf("LoadAuthenticatorConfigFromEnv() with Ed25519 JWE key error = nil; want error")
+	}
+}
+
+type testServerConfig struct {
+	Port     int           `env:"PORT" envDefault:"8080"`
+	Database string        `env:"DATABASE_URL,required"`
+	Timeout  time.Duration `env:"TIMEOUT" envDefault:"5s"`
+	Origins  []string      `env:"ALLOWED_ORIGINS"`
+	Debug    bool          `env:"DEBUG"`
+	Limits   struct {
+		Burst uint `env:"BURST"`
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("APP_DATABASE_URL_FILE", writeFile(t, "db", []byte("postgres://db\n")))
+	t.Setenv("APP_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("APP_DEBUG", "true")
+	t.Setenv("APP_BURST", "10")
+
+	got, err := grove.LoadConfigFromEnv[testServerConfig](grove.WithEnvPrefix("APP"))
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv() error = %v; want nil", err)
+	}
+	if got.Port != 8080 || got.Database != "postgres://db" || got.Timeout != 5*time.Second || !got.Debug || got.Limits.Burst != 10 {
+		t.Fatalf("config = %+v; want values from the environment and defaults", got)
+	}
+	if slices.Compare(got.Origins, []string{"https://a.example.com", "https://b.example.com"}) != 0 {
+		t.Fatalf("Origins = %v; want both origins", got.Origins)
+	}
+
+	t.Setenv("APP_PORT", "not-a-port")
+	if _, err := grove.LoadConfigFromEnv[testServerConfig](grove.WithEnvPrefix("APP")); err == nil || !strings.Contains(err.Error(), "APP_PORT") {
+		t.Fatalf("LoadConfigFromEnv() with invalid port error = %v; want error naming APP_PORT", err)
+	}
+
+	if _, err := grove.LoadConfigFromEnv[testServerConfig](); err == nil || !strings.Contains(err.Error(), "DATABASE_URL") {
+		t.Fatalf("LoadConfigFromEnv() without required value error = %v; want error naming DATABASE_URL", err)
+	}
+	if _, err := grove.LoadConfigFromEnv[string](); err == nil {
+		t.Fatalf("LoadConfigFromEnv[string]() error = nil; want error")
+	}
+}
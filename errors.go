@@ -0,0 +1,123 @@
+package grove
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Errors returned by `VerifyToken` and passed to the unauthorized handler of
+// `DefaultAuthMiddleware`. They can be matched using errors.Is, the error returned by the
+// underlying jwt library stays in the chain as well.
+var (
+	ErrTokenMissing          = errors.New("token is missing")
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenUndecryptable    = errors.New("token could not be decrypted")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrTokenExpired          = errors.New("token is expired")
+	ErrTokenNotValidYet      = errors.New("token is not valid yet")
+	ErrTokenInvalidAudience  = errors.New("token has an invalid audience")
+	ErrTokenInvalidIssuer    = errors.New("token has an invalid issuer")
+	ErrTokenInvalidClaims    = errors.New("token has invalid claims")
+	ErrTokenMFAPending       = errors.New("token is pending multi-factor authentication")
+)
+
+// The errors that describe why a request was rejected, in the order they are matched.
+var authErrors = []error{
+	ErrTokenMissing,
+	ErrAPIKeyMissing,
+	ErrAPIKeyInvalid,
+	ErrAPIKeyExpired,
+	ErrCredentialsMissing,
+	ErrCredentialsInvalid,
+	ErrClientCertificateMissing,
+	ErrClientCertificateRejected,
+	ErrTokenRevoked,
+	ErrTokenMFAPending,
+	ErrTokenMalformed,
+	ErrTokenUndecryptable,
+	ErrTokenSignatureInvalid,
+	ErrTokenExpired,
+	ErrTokenNotValidYet,
+	ErrTokenInvalidAudience,
+	ErrTokenInvalidIssuer,
+	ErrTokenInvalidClaims,
+}
+
+// Wraps an error returned by jwt.ParseWithClaims with the matching Grove error.
+func classifyJWTError(err error) error {
+	var kind error
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		kind = ErrTokenMalformed
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		kind = ErrTokenSignatureInvalid
+	case errors.Is(err, jwt.ErrTokenExpired):
+		kind = ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		kind = ErrTokenNotValidYet
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		kind = ErrTokenInvalidAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		kind = ErrTokenInvalidIssuer
+	default:
+		kind = ErrTokenInvalidClaims
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// Returns a description of why the request was rejected that is safe to send to the client.
+func authErrorDescription(err error) string {
+	for _, authErr := range authErrors {
+		if errors.Is(err, authErr) {
+			return authErr.Error()
+		}
+	}
+	return "token is invalid"
+}
+
+// Writes a `WWW-Authenticate` challenge with the parameters described in RFC 6750 section 3.
+// Empty parameters are left out.
+func setChallenge(w http.ResponseWriter, scheme string, realm string, code string, description string, scope string) {
+	challenge := scheme
+	params := make([]string, 0, 4)
+	for _, param := range [][2]string{{"realm", realm}, {"error", code}, {"error_description", description}, {"scope", scope}} {
+		if param[1] != "" {
+			value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(param[1])
+			params = append(params, param[0]+`="`+value+`"`)
+		}
+	}
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+}
+
+// Writes the 401 response of the authentication middleware.
+// A request without credentials only gets the challenge while rejected bearer tokens get the
+// `invalid_token` error code, as required by RFC 6750. The error codes are only defined for
+// bearer tokens, so other schemes always get the plain challenge.
+func writeUnauthorized(w http.ResponseWriter, scheme string, realm string, err error) {
+	if scheme != "Bearer" || errors.Is(err, ErrTokenMissing) || errors.Is(err, ErrAPIKeyMissing) {
+		setChallenge(w, scheme, realm, "", "", "")
+		WriteErrorToResponse(w, http.StatusUnauthorized, authErrorDescription(err))
+		return
+	}
+
+	description := authErrorDescription(err)
+	setChallenge(w, scheme, realm, "invalid_token", description, "")
+	WriteErrorToResponse(w, http.StatusUnauthorized, description)
+}
+
+// Writes the 403 response used when the credentials are valid but do not grant access.
+// Only bearer tokens get the `insufficient_scope` challenge, the error code is defined by RFC 6750
+// and means nothing to clients of the other methods.
+func writeForbidden(w http.ResponseWriter, method AuthMethod, scope string) {
+	if method == AuthMethodJWT {
+		setChallenge(w, "Bearer", "", "insufficient_scope", "", scope)
+	}
+	WriteErrorToResponse(w, http.StatusForbidden, "forbidden")
+}
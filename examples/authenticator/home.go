@@ -2,7 +2,6 @@ package main
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/StevenAlexanderJohnson/grove"
 	"github.com/golang-jwt/jwt/v5"
@@ -30,16 +29,12 @@ func (c *HomeController) handleHome(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *HomeController) sampleLogin(w http.ResponseWriter, r *http.Request) {
+	// The issuer, audience, expiration, issued at, not before, and ID are filled in by the
+	// authenticator using its configuration.
 	token, err := c.authenticator.GenerateToken(&CustomClaims{
 		UserID: "steven",
 		RegisteredClaims: &jwt.RegisteredClaims{
-			Issuer:    "example.com",
-			Audience:  []string{"example.com"},
-			Subject:   "steven",
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			ID:        "unique-session-id",
+			Subject: "steven",
 		},
 	})
 	if err != nil {
@@ -47,11 +42,8 @@ func (c *HomeController) sampleLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:  "session_token",
-		Value: token,
-		Path:  "/",
-	})
+	// The cookie is HttpOnly, Secure and SameSite=Lax and expires together with the token.
+	c.authenticator.SetSessionCookie(w, token)
 	// This is a placeholder for a login handler.
 	// In a real application, you would handle user authentication here.
 	w.Write([]byte("Login successful! A token would be generated and returned."))
@@ -25,6 +25,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	authConfig.RevocationStore = grove.NewMemoryRevocationStore()
 	if err := authConfig.Validate(); err != nil {
 		panic("Invalid authenticator configuration")
 	}
@@ -42,7 +43,7 @@ func main() {
 			logger,
 			func() *CustomClaims { return &CustomClaims{} },
 		)).
-		WithController(&PrivateController{})
+		WithController(&PrivateController{authenticator: authenticator})
 
 	if err := grove.
 		NewApp("authenticator").
@@ -2,12 +2,13 @@ package main
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/StevenAlexanderJohnson/grove"
 )
 
-type PrivateController struct{}
+type PrivateController struct {
+	authenticator *grove.Authenticator[*CustomClaims]
+}
 
 func (c *PrivateController) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/", c.handlePrivate)
@@ -23,11 +24,10 @@ func (c *PrivateController) handlePrivate(w http.ResponseWriter, r *http.Request
 }
 
 func (c *PrivateController) logout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   "",
-		Path:    "/",
-		Expires: time.Now().Add(-24 * time.Hour), // Expire the cookie
-	})
+	// Revokes the token so it cannot be used again and expires the session cookie.
+	if err := c.authenticator.Logout(w, r); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 	w.Write([]byte("You have been logged out."))
 }
@@ -0,0 +1,55 @@
+package grove
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TokenExtractor reads a token from the request.
+// It returns an empty string when the request does not carry a token in the place it looks at.
+type TokenExtractor func(r *http.Request) string
+
+// BearerTokenExtractor reads the token from an `Authorization: Bearer <token>` header.
+// The scheme is compared case-insensitively as required by RFC 6750 and any other scheme,
+// such as Basic, is ignored.
+func BearerTokenExtractor() TokenExtractor {
+	return func(r *http.Request) string {
+		scheme, token, ok := strings.Cut(strings.TrimSpace(r.Header.Get("Authorization")), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+		token = strings.TrimSpace(token)
+		if strings.ContainsAny(token, " \t") {
+			return ""
+		}
+		return token
+	}
+}
+
+// CookieTokenExtractor reads the token from the cookie with the provided name.
+func CookieTokenExtractor(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// QueryTokenExtractor reads the token from the query parameter with the provided name.
+// Browsers cannot set headers on WebSocket upgrade requests, so this is how those usually
+// authenticate. Tokens in URLs end up in access logs and browser history, so it should be
+// limited to routes that need it and used with short-lived tokens.
+func QueryTokenExtractor(param string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(param)
+	}
+}
+
+// HeaderTokenExtractor reads the token from the value of a custom header, such as X-Auth-Token.
+func HeaderTokenExtractor(header string) TokenExtractor {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(header))
+	}
+}
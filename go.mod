@@ -11,6 +11,7 @@ require (
 	github.com/go-jose/go-jose/v4 v4.1.1
 	github.com/golang-jwt/jwt/v5 v5.2.3
 	github.com/google/uuid v1.6.0
+	golang.org/x/crypto v0.39.0
 )
 
-require golang.org/x/crypto v0.39.0 // indirect
+require golang.org/x/sys v0.33.0 // indirect
@@ -0,0 +1,200 @@
+package grove
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set a header of `SecurityHeadersConfig` to OmitHeader to not send it.
+const OmitHeader = "-"
+
+// The placeholder in ContentSecurityPolicy that is replaced with the nonce of the request.
+const CSPNoncePlaceholder = "{nonce}"
+
+// Defaults of `SecurityHeadersConfig`.
+const (
+	DefaultHSTSMaxAge            = 365 * 24 * time.Hour
+	DefaultFrameOptions          = "DENY"
+	DefaultReferrerPolicy        = "strict-origin-when-cross-origin"
+	DefaultPermissionsPolicy     = "camera=(), microphone=(), geolocation=(), payment=(), usb=()"
+	DefaultContentSecurityPolicy = "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; " +
+		"img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+)
+
+type cspNonceKeyType struct{}
+
+// Key that should be used to pull the CSP nonce of the request from the request context.
+// Prefer `CSPNonce`.
+var CSPNonceKey = cspNonceKeyType{}
+
+// CSPNonce returns the nonce the Content-Security-Policy of the response allows, for use in
+// templates:
+//
+//	<script nonce="{{ .Nonce }}">...</script>
+//
+// It is empty if `SecurityHeadersMiddleware` did not run or its policy has no CSPNoncePlaceholder.
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(CSPNonceKey).(string)
+	return nonce
+}
+
+// Config used by `SecurityHeadersMiddleware`.
+// The zero value sends every header with its default. Header values that are empty use the
+// default and OmitHeader leaves the header out.
+type SecurityHeadersConfig struct {
+	// The max-age of Strict-Transport-Security. Defaults to DefaultHSTSMaxAge, a negative value
+	// leaves the header out. Browsers ignore it on plain HTTP responses.
+	HSTSMaxAge time.Duration
+	// Adds includeSubDomains to Strict-Transport-Security.
+	HSTSIncludeSubdomains bool
+	// Adds preload to Strict-Transport-Security. It requires HSTSIncludeSubdomains and a max-age of
+	// at least a year.
+	HSTSPreload bool
+	// X-Frame-Options. Defaults to DefaultFrameOptions.
+	FrameOptions string
+	// Referrer-Policy. Defaults to DefaultReferrerPolicy.
+	ReferrerPolicy string
+	// Permissions-Policy. Defaults to DefaultPermissionsPolicy.
+	PermissionsPolicy string
+	// Content-Security-Policy. Defaults to DefaultContentSecurityPolicy. Every CSPNoncePlaceholder
+	// is replaced with a nonce generated for the request, see `CSPNonce`.
+	ContentSecurityPolicy string
+	// Sends the policy as Content-Security-Policy-Report-Only, to try it without enforcing it.
+	CSPReportOnly bool
+	// Leaves out `X-Content-Type-Options: nosniff`.
+	DisableContentTypeOptions bool
+}
+
+// Function that validates the SecurityHeadersConfig.
+// If any values are invalid it will return an error.
+// If it is valid it will return nil.
+func (config *SecurityHeadersConfig) Validate() error {
+	if config.HSTSPreload && (!config.HSTSIncludeSubdomains || config.HSTSMaxAge < 0 || (config.HSTSMaxAge > 0 && config.HSTSMaxAge < DefaultHSTSMaxAge)) {
+		return fmt.Errorf("HSTS preload requires includeSubDomains and a max-age of at least a year")
+	}
+	for name, value := range map[string]string{
+		"X-Frame-Options":         config.FrameOptions,
+		"Referrer-Policy":         config.ReferrerPolicy,
+		"Permissions-Policy":      config.PermissionsPolicy,
+		"Content-Security-Policy": config.ContentSecurityPolicy,
+	} {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s cannot contain line breaks", name)
+		}
+	}
+	return nil
+}
+
+// Returns the value, its default when it is empty or an empty string when it is OmitHeader.
+func headerValue(value string, defaultValue string) string {
+	switch value {
+	case "":
+		return defaultValue
+	case OmitHeader:
+		return ""
+	}
+	return value
+}
+
+// Returns the Strict-Transport-Security value or an empty string if it is disabled.
+func (config *SecurityHeadersConfig) hsts() string {
+	maxAge := config.HSTSMaxAge
+	if maxAge < 0 {
+		return ""
+	}
+	if maxAge == 0 {
+		maxAge = DefaultHSTSMaxAge
+	}
+	value := "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	if config.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if config.HSTSPreload {
+		value += "; preload"
+	}
+	return value
+}
+
+func newCSPNonce() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("an error occurred while generating CSP nonce: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(random), nil
+}
+
+// SecurityHeadersMiddleware sets Strict-Transport-Security, X-Content-Type-Options,
+// X-Frame-Options, Referrer-Policy, Permissions-Policy and Content-Security-Policy on every
+// response. When the policy contains CSPNoncePlaceholder a fresh nonce is generated for every
+// request and stored in the request context under CSPNonceKey.
+//
+// The headers are set before the next handler runs, so handlers and middleware registered
+// later can still change them. To override headers for a `Scope`, register another
+// SecurityHeadersMiddleware on it with a copy of the app config, its headers replace the ones
+// set by the app:
+//
+//	embed := config
+//	embed.FrameOptions = "SAMEORIGIN"
+//	middleware, err := grove.SecurityHeadersMiddleware(embed)
+//	if err != nil {
+//		return err
+//	}
+//	scope.WithMiddleware(middleware)
+func SecurityHeadersMiddleware(config SecurityHeadersConfig) (Middleware, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Empty values are removed, so a scope can drop headers set by the app.
+	headers := map[string]string{
+		"Strict-Transport-Security": config.hsts(),
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           headerValue(config.FrameOptions, DefaultFrameOptions),
+		"Referrer-Policy":           headerValue(config.ReferrerPolicy, DefaultReferrerPolicy),
+		"Permissions-Policy":        headerValue(config.PermissionsPolicy, DefaultPermissionsPolicy),
+	}
+	if config.DisableContentTypeOptions {
+		headers["X-Content-Type-Options"] = ""
+	}
+	cspHeader := "Content-Security-Policy"
+	if config.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	csp := headerValue(config.ContentSecurityPolicy, DefaultContentSecurityPolicy)
+	useNonce := strings.Contains(csp, CSPNoncePlaceholder)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, value := range headers {
+				if value == "" {
+					w.Header().Del(name)
+				} else {
+					w.Header().Set(name, value)
+				}
+			}
+			// A scope overriding the app may switch between enforcing and reporting.
+			w.Header().Del("Content-Security-Policy")
+			w.Header().Del("Content-Security-Policy-Report-Only")
+
+			nonce := ""
+			if useNonce {
+				var err error
+				if nonce, err = newCSPNonce(); err != nil {
+					WriteErrorToResponse(w, http.StatusInternalServerError, "failed to generate CSP nonce")
+					return
+				}
+			}
+			if csp != "" {
+				w.Header().Set(cspHeader, strings.ReplaceAll(csp, CSPNoncePlaceholder, nonce))
+			}
+			// The nonce of an outer middleware is replaced as well, it is not allowed by this policy.
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CSPNonceKey, nonce)))
+		})
+	}, nil
+}
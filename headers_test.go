@@ -0,0 +1,146 @@
+package grove_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func securityHeadersMiddleware(t *testing.T, config grove.SecurityHeadersConfig) grove.Middleware {
+	t.Helper()
+
+	middleware, err := grove.SecurityHeadersMiddleware(config)
+	if err != nil {
+		t.Fatalf("SecurityHeadersMiddleware() error = %v; want nil", err)
+	}
+	return middleware
+}
+
+// A handler that writes the CSP nonce of the request to the body.
+var nonceHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(grove.CSPNonce(r)))
+})
+
+func TestSecurityHeadersMiddlewareDefaults(t *testing.T) {
+	handler := securityHeadersMiddleware(t, grove.SecurityHeadersConfig{})(nonceHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := map[string]string{
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           grove.DefaultFrameOptions,
+		"Referrer-Policy":           grove.DefaultReferrerPolicy,
+		"Permissions-Policy":        grove.DefaultPermissionsPolicy,
+	}
+	for header, value := range want {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("%s = %q; want %q", header, got, value)
+		}
+	}
+
+	nonce := rec.Body.String()
+	if nonce == "" {
+		t.Fatalf("CSPNonce() = empty; want a nonce")
+	}
+	wantCSP := strings.ReplaceAll(grove.DefaultContentSecurityPolicy, grove.CSPNoncePlaceholder, nonce)
+	if got := rec.Header().Get("Content-Security-Policy"); got != wantCSP {
+		t.Fatalf("Content-Security-Policy = %q; want %q", got, wantCSP)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Body.String() == nonce {
+		t.Fatalf("CSPNonce() repeated %q; want a new nonce per request", nonce)
+	}
+}
+
+func TestSecurityHeadersMiddlewareWithConfig(t *testing.T) {
+	handler := securityHeadersMiddleware(t, grove.SecurityHeadersConfig{
+		HSTSMaxAge:                2 * grove.DefaultHSTSMaxAge,
+		HSTSIncludeSubdomains:     true,
+		HSTSPreload:               true,
+		FrameOptions:              grove.OmitHeader,
+		ContentSecurityPolicy:     "default-src 'self'",
+		CSPReportOnly:             true,
+		DisableContentTypeOptions: true,
+	})(nonceHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=63072000; includeSubDomains; preload" {
+		t.Errorf("Strict-Transport-Security = %q; want max-age=63072000; includeSubDomains; preload", got)
+	}
+	for _, header := range []string{"X-Frame-Options", "X-Content-Type-Options", "Content-Security-Policy"} {
+		if got := rec.Header().Get(header); got != "" {
+			t.Errorf("%s = %q; want none", header, got)
+		}
+	}
+	if got := rec.Header().Get("Content-Security-Policy-Report-Only"); got != "default-src 'self'" {
+		t.Errorf("Content-Security-Policy-Report-Only = %q; want default-src 'self'", got)
+	}
+	if rec.Body.String() != "" {
+		t.Errorf("CSPNonce() = %q; want empty for a policy without nonce", rec.Body.String())
+	}
+}
+
+func TestSecurityHeadersMiddlewareValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config grove.SecurityHeadersConfig
+	}{
+		{name: "preload without subdomains", config: grove.SecurityHeadersConfig{HSTSPreload: true}},
+		{name: "preload with short max-age", config: grove.SecurityHeadersConfig{HSTSPreload: true, HSTSIncludeSubdomains: true, HSTSMaxAge: time.Hour}},
+		{name: "header injection", config: grove.SecurityHeadersConfig{FrameOptions: "DENY\r\nSet-Cookie: a=b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := grove.SecurityHeadersMiddleware(tt.config); err == nil {
+				t.Fatalf("SecurityHeadersMiddleware() error = nil; want error")
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersMiddlewareScopeOverride(t *testing.T) {
+	config := grove.SecurityHeadersConfig{}
+	embed := config
+	embed.FrameOptions = "SAMEORIGIN"
+	embed.ContentSecurityPolicy = "frame-ancestors 'self'"
+
+	scope := grove.NewScope("embed").
+		WithMiddleware(securityHeadersMiddleware(t, embed)).
+		WithRoute("/widget", nonceHandler)
+	app := grove.NewApp("test").
+		WithMiddleware(securityHeadersMiddleware(t, config)).
+		WithScope("/embed", scope).
+		WithRoute("/page", nonceHandler)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/embed/widget", nil))
+	if got := rec.Header().Get("X-Frame-Options"); got != "SAMEORIGIN" {
+		t.Errorf("X-Frame-Options = %q; want SAMEORIGIN", got)
+	}
+	if got := rec.Header().Values("Content-Security-Policy"); len(got) != 1 || got[0] != "frame-ancestors 'self'" {
+		t.Errorf("Content-Security-Policy = %q; want only the scope policy", got)
+	}
+	if got := rec.Header().Get("Referrer-Policy"); got != grove.DefaultReferrerPolicy {
+		t.Errorf("Referrer-Policy = %q; want %q", got, grove.DefaultReferrerPolicy)
+	}
+	if rec.Body.String() != "" {
+		t.Errorf("CSPNonce() = %q; want empty, the scope policy has no nonce", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page", nil))
+	if got := rec.Header().Get("X-Frame-Options"); got != grove.DefaultFrameOptions {
+		t.Errorf("X-Frame-Options = %q; want %q", got, grove.DefaultFrameOptions)
+	}
+}
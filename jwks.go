@@ -0,0 +1,88 @@
+package grove
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// The path JWKS documents are conventionally served from.
+// It can be passed directly to `App.WithRoute` together with `Authenticator.JWKSHandler`.
+const JWKSPath = "/.well-known/jwks.json"
+
+// The max-age used for the Cache-Control header of the JWKS document when
+// AuthenticatorConfig.JWKSCacheMaxAge is not set.
+const DefaultJWKSCacheMaxAge = 5 * time.Minute
+
+// PublicJWKS returns the public keys that can be used to verify the tokens generated by the
+// Authenticator as a JSON Web Key Set.
+// It contains the active signing key as well as every verification key, so keys that were rotated
+// out are still published until they are removed.
+// HMAC keys are never included because they are secret.
+func (a *Authenticator[T]) PublicJWKS() jose.JSONWebKeySet {
+	a.keys.mu.RLock()
+	defer a.keys.mu.RUnlock()
+
+	set := jose.JSONWebKeySet{Keys: make([]jose.JSONWebKey, 0, len(a.keys.verification))}
+	for _, key := range a.keys.verification {
+		if key.publicKey == nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jose.JSONWebKey{
+			Key:       key.publicKey,
+			KeyID:     key.id,
+			Algorithm: key.method.Alg(),
+			Use:       "sig",
+		})
+	}
+	return set
+}
+
+// JWKSHandler returns a handler that serves the result of `PublicJWKS` as a JWKS document.
+// The response can be cached for AuthenticatorConfig.JWKSCacheMaxAge and carries an ETag so
+// clients can revalidate it cheaply.
+// Only GET and HEAD requests are allowed.
+//
+// It is meant to be mounted with `app.WithRoute(grove.JWKSPath, authenticator.JWKSHandler())`.
+func (a *Authenticator[T]) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			WriteErrorToResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		body, err := json.Marshal(a.PublicJWKS())
+		if err != nil {
+			WriteErrorToResponse(w, http.StatusInternalServerError, "failed to encode JWKS")
+			return
+		}
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		maxAge := a.JWKSCacheMaxAge
+		if maxAge <= 0 {
+			maxAge = DefaultJWKSCacheMaxAge
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, _ = w.Write(body)
+	})
+}
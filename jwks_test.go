@@ -0,0 +1,161 @@
+package grove_test
+
+import (
+	"crypto/elliptic"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func asymmetricAuthenticator(t *testing.T, keyID string) *grove.Authenticator[*TestClaims] {
+	t.Helper()
+
+	config := validConfig(t, false)
+	config.Key = ""
+	config.KeyID = keyID
+	config.SigningAlgorithm = "RS256"
+	config.SigningKey = testRSAKey(t)
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+	return auth
+}
+
+func fetchJWKS(t *testing.T, app *grove.App) jose.JSONWebKeySet {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, grove.JWKSPath, nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatalf("failed to decode JWKS: %v", err)
+	}
+	return set
+}
+
+func TestJWKSHandlerServesPublicKeys(t *testing.T) {
+	auth := asymmetricAuthenticator(t, "rsa-1")
+	app := grove.NewApp("test").WithRoute(grove.JWKSPath, auth.JWKSHandler())
+
+	req := httptest.NewRequest(http.MethodGet, grove.JWKSPath, nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); got != "application/jwk-set+json" {
+		t.Fatalf("Content-Type = %q; want application/jwk-set+json", got)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Fatalf("Cache-Control = %q; want public, max-age=300", got)
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Fatalf("ETag header is missing")
+	}
+
+	set := fetchJWKS(t, app)
+	keys := set.Key("rsa-1")
+	if len(keys) != 1 {
+		t.Fatalf("keys with kid rsa-1 = %d; want 1", len(keys))
+	}
+	if !keys[0].IsPublic() {
+		t.Fatalf("published key is not public")
+	}
+	if keys[0].Algorithm != "RS256" || keys[0].Use != "sig" {
+		t.Fatalf("alg = %s, use = %s; want RS256, sig", keys[0].Algorithm, keys[0].Use)
+	}
+
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+	_, err = jwt.Parse(token, func(token *jwt.Token) (any, error) {
+		return keys[0].Key, nil
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	if err != nil {
+		t.Fatalf("token could not be verified with the published key: %v", err)
+	}
+}
+
+func TestJWKSHandlerIncludesRotatedKeys(t *testing.T) {
+	auth := asymmetricAuthenticator(t, "old")
+	app := grove.NewApp("test").WithRoute(grove.JWKSPath, auth.JWKSHandler())
+
+	err := auth.RotateSigningKey(grove.JWTKey{
+		ID:         "new",
+		Algorithm:  "ES256",
+		PrivateKey: testECDSAKey(t, elliptic.P256()),
+	})
+	if err != nil {
+		t.Fatalf("RotateSigningKey() error = %v; want nil", err)
+	}
+
+	set := fetchJWKS(t, app)
+	if len(set.Key("old")) != 1 || len(set.Key("new")) != 1 {
+		t.Fatalf("JWKS = %v; want old and new keys", set.Keys)
+	}
+
+	if err := auth.RemoveVerificationKey("old"); err != nil {
+		t.Fatalf("RemoveVerificationKey() error = %v; want nil", err)
+	}
+
+	set = fetchJWKS(t, app)
+	if len(set.Key("old")) != 0 || len(set.Key("new")) != 1 {
+		t.Fatalf("JWKS = %v; want only the new key", set.Keys)
+	}
+}
+
+func TestJWKSHandlerDoesNotPublishHMACKeys(t *testing.T) {
+	config := validConfig(t, false)
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	set := fetchJWKS(t, grove.NewApp("test").WithRoute(grove.JWKSPath, auth.JWKSHandler()))
+	if len(set.Keys) != 0 {
+		t.Fatalf("JWKS has %d keys; want 0", len(set.Keys))
+	}
+}
+
+func TestJWKSHandlerReturnsNotModifiedForMatchingETag(t *testing.T) {
+	auth := asymmetricAuthenticator(t, "rsa-1")
+	handler := auth.JWKSHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, grove.JWKSPath, nil))
+
+	req := httptest.NewRequest(http.MethodGet, grove.JWKSPath, nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusNotModified)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("body = %q; want empty", rec.Body.String())
+	}
+}
+
+func TestJWKSHandlerRejectsOtherMethods(t *testing.T) {
+	auth := asymmetricAuthenticator(t, "rsa-1")
+
+	rec := httptest.NewRecorder()
+	auth.JWKSHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, grove.JWKSPath, nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,476 @@
+package grove
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTKey is a key used to sign or verify JWTs.
+// The ID is written to the `kid` header of the tokens it signs and is used to select the key
+// when verifying a token.
+//
+// HMAC algorithms use Secret. Asymmetric algorithms use PrivateKey to sign and its public key
+// to verify. A key that only has a PublicKey can verify tokens but cannot be used to sign them.
+type JWTKey struct {
+	// Value of the `kid` header. It can be empty when only one key is in use.
+	ID string
+	// The algorithm the key is used with. If it is empty HS256 is used.
+	Algorithm string
+	// The secret used for HMAC algorithms.
+	Secret string
+	// The private key used to sign tokens with an asymmetric algorithm.
+	PrivateKey crypto.Signer
+	// The public key used to verify tokens with an asymmetric algorithm.
+	// It is ignored when PrivateKey is set.
+	PublicKey crypto.PublicKey
+}
+
+// JWEKey is a key used to encrypt or decrypt JWEs.
+// The ID is written to the `kid` header of the JWE and is used to select the key when decrypting.
+type JWEKey struct {
+	// Value of the `kid` header. It can be empty when only one key is in use.
+	ID string
+	// The key management algorithm the key is used with.
+	// If it is empty AuthenticatorConfig.JWEKeyAlgorithm is used.
+	Algorithm jose.KeyAlgorithm
+	// The key used to decrypt the JWE. Its type depends on the algorithm:
+	//   - *rsa.PrivateKey for RSA-OAEP and RSA-OAEP-256
+	//   - *ecdsa.PrivateKey for ECDH-ES and ECDH-ES+A128KW, ECDH-ES+A192KW, ECDH-ES+A256KW
+	//   - []byte for dir, A128KW, A192KW and A256KW
+	// Asymmetric keys encrypt with their public key.
+	Key any
+}
+
+// A JWTKey that has been validated and converted to the values the jwt package expects.
+type resolvedJWTKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	publicKey crypto.PublicKey
+}
+
+func (k JWTKey) resolve() (resolvedJWTKey, error) {
+	method, err := signingMethodFor(k.Algorithm)
+	if err != nil {
+		return resolvedJWTKey{}, err
+	}
+
+	if isHMACSigningMethod(method) {
+		if k.Secret == "" {
+			return resolvedJWTKey{}, fmt.Errorf("key %q: secret is required for %s", k.ID, method.Alg())
+		}
+		return resolvedJWTKey{
+			id:        k.ID,
+			method:    method,
+			signKey:   []byte(k.Secret),
+			verifyKey: []byte(k.Secret),
+		}, nil
+	}
+
+	if k.PrivateKey != nil {
+		if err := validateSigningKey(method, k.PrivateKey); err != nil {
+			return resolvedJWTKey{}, fmt.Errorf("key %q: %v", k.ID, err)
+		}
+		return resolvedJWTKey{
+			id:        k.ID,
+			method:    method,
+			signKey:   k.PrivateKey,
+			verifyKey: k.PrivateKey.Public(),
+			publicKey: k.PrivateKey.Public(),
+		}, nil
+	}
+
+	if err := validateVerificationKey(method, k.PublicKey); err != nil {
+		return resolvedJWTKey{}, fmt.Errorf("key %q: %v", k.ID, err)
+	}
+	return resolvedJWTKey{
+		id:        k.ID,
+		method:    method,
+		verifyKey: k.PublicKey,
+		publicKey: k.PublicKey,
+	}, nil
+}
+
+// Checks that the public key is usable with the provided asymmetric signing method.
+func validateVerificationKey(method jwt.SigningMethod, key crypto.PublicKey) error {
+	if key == nil {
+		return fmt.Errorf("private or public key is required for %s", method.Alg())
+	}
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			return fmt.Errorf("%s requires an RSA public key, got %T", method.Alg(), key)
+		}
+	case *jwt.SigningMethodECDSA:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s requires an ECDSA public key, got %T", method.Alg(), key)
+		}
+		if ecKey.Curve.Params().BitSize != m.CurveBits {
+			return fmt.Errorf("%s requires a %d bit curve, got %s", method.Alg(), m.CurveBits, ecKey.Curve.Params().Name)
+		}
+	case *jwt.SigningMethodEd25519:
+		if _, ok := key.(ed25519.PublicKey); !ok {
+			return fmt.Errorf("%s requires an Ed25519 public key, got %T", method.Alg(), key)
+		}
+	default:
+		return fmt.Errorf("unsupported signing algorithm: %s", method.Alg())
+	}
+	return nil
+}
+
+// Checks that the key can be used with its algorithm and the content encryption.
+func (k JWEKey) validate(contentEncryption jose.ContentEncryption) error {
+	if k.Key == nil {
+		return fmt.Errorf("JWE key %q: key is required", k.ID)
+	}
+
+	switch k.Algorithm {
+	case jose.RSA_OAEP, jose.RSA_OAEP_256, jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW:
+		if !jweKeyFitsAlgorithm(k.Key, k.Algorithm) {
+			return fmt.Errorf("JWE key %q: %s cannot be used with a %T key", k.ID, k.Algorithm, k.Key)
+		}
+	case jose.DIRECT, jose.A128KW, jose.A192KW, jose.A256KW:
+		secret, ok := k.Key.([]byte)
+		if !ok {
+			return fmt.Errorf("JWE key %q: %s requires a []byte key, got %T", k.ID, k.Algorithm, k.Key)
+		}
+		size := jweSymmetricKeySize(k.Algorithm, contentEncryption)
+		if len(secret) != size {
+			return fmt.Errorf("JWE key %q: %s with %s requires a %d byte key, got %d", k.ID, k.Algorithm, contentEncryption, size, len(secret))
+		}
+	default:
+		return fmt.Errorf("JWE key %q: unsupported key algorithm: %s", k.ID, k.Algorithm)
+	}
+	return nil
+}
+
+// Reports whether the key is the kind of key the algorithm expects.
+// It lets a key be used with every algorithm of its family, e.g. an RSA key with both RSA-OAEP
+// and RSA-OAEP-256, while the allow-lists decide which algorithms are accepted.
+func jweKeyFitsAlgorithm(key any, algorithm jose.KeyAlgorithm) bool {
+	switch algorithm {
+	case jose.RSA_OAEP, jose.RSA_OAEP_256:
+		_, ok := key.(*rsa.PrivateKey)
+		return ok
+	case jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW:
+		_, ok := key.(*ecdsa.PrivateKey)
+		return ok
+	case jose.DIRECT, jose.A128KW, jose.A192KW, jose.A256KW:
+		_, ok := key.([]byte)
+		return ok
+	}
+	return false
+}
+
+// Returns the key that is used to encrypt a JWE for this key.
+func (k JWEKey) encryptionKey() any {
+	switch key := k.Key.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey
+	default:
+		return k.Key
+	}
+}
+
+// Returns the size in bytes that a symmetric JWE key must have.
+func jweSymmetricKeySize(algorithm jose.KeyAlgorithm, contentEncryption jose.ContentEncryption) int {
+	switch algorithm {
+	case jose.A128KW:
+		return 16
+	case jose.A192KW:
+		return 24
+	case jose.A256KW:
+		return 32
+	}
+
+	switch contentEncryption {
+	case jose.A128GCM:
+		return 16
+	case jose.A192GCM:
+		return 24
+	case jose.A256GCM, jose.A128CBC_HS256:
+		return 32
+	case jose.A192CBC_HS384:
+		return 48
+	case jose.A256CBC_HS512:
+		return 64
+	}
+	return 0
+}
+
+// keyring holds the keys an Authenticator uses at runtime.
+// The active keys are used to sign and encrypt new tokens while every key in the
+// verification and decryption sets is accepted when reading tokens.
+// All access goes through the mutex so keys can be rotated while requests are in flight.
+type keyring struct {
+	mu           sync.RWMutex
+	signing      resolvedJWTKey
+	verification []resolvedJWTKey
+	encryption   JWEKey
+	decryption   []JWEKey
+}
+
+// Builds the keyring from the configuration.
+// The configured signing and JWE keys become the active keys and are also added to the
+// verification and decryption sets.
+func newKeyring(config *AuthenticatorConfig) (*keyring, error) {
+	signing, err := JWTKey{
+		ID:         config.KeyID,
+		Algorithm:  config.SigningAlgorithm,
+		Secret:     config.Key,
+		PrivateKey: config.SigningKey,
+	}.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	k := &keyring{signing: signing}
+	k.verification = append(k.verification, signing)
+	for _, key := range config.VerificationKeys {
+		// Replacing the signing key or another verification key would silently drop it.
+		if err := checkNewKeyID(key.ID, k.hasVerificationKey); err != nil {
+			return nil, err
+		}
+		resolved, err := key.resolve()
+		if err != nil {
+			return nil, err
+		}
+		k.verification = putJWTKey(k.verification, resolved)
+	}
+
+	if config.CanEncrypt {
+		k.encryption = config.jweKey()
+		if err := k.encryption.validate(config.jweContentEncryption()); err != nil {
+			return nil, err
+		}
+		k.decryption = append(k.decryption, k.encryption)
+	}
+	for _, key := range config.JWEDecryptionKeys {
+		key = config.withDefaultJWEAlgorithm(key)
+		if err := key.validate(config.jweContentEncryption()); err != nil {
+			return nil, err
+		}
+		k.decryption = putJWEKey(k.decryption, key)
+	}
+
+	return k, nil
+}
+
+// Adds the key to the set, replacing any key that has the same ID.
+func putJWTKey(keys []resolvedJWTKey, key resolvedJWTKey) []resolvedJWTKey {
+	for i := range keys {
+		if keys[i].id == key.id {
+			keys[i] = key
+			return keys
+		}
+	}
+	return append(keys, key)
+}
+
+// Adds the key to the set, replacing any key that has the same ID.
+func putJWEKey(keys []JWEKey, key JWEKey) []JWEKey {
+	for i := range keys {
+		if keys[i].ID == key.ID {
+			keys[i] = key
+			return keys
+		}
+	}
+	return append(keys, key)
+}
+
+func (k *keyring) signingKey() resolvedJWTKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.signing
+}
+
+func (k *keyring) encryptionKey() JWEKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.encryption
+}
+
+// Reports whether a verification key has the ID. Must be called while holding the lock.
+func (k *keyring) hasVerificationKey(id string) bool {
+	return slices.ContainsFunc(k.verification, func(key resolvedJWTKey) bool { return key.id == id })
+}
+
+// Reports whether a decryption key has the ID. Must be called while holding the lock.
+func (k *keyring) hasDecryptionKey(id string) bool {
+	return slices.ContainsFunc(k.decryption, func(key JWEKey) bool { return key.ID == id })
+}
+
+// Returns the verification key with the provided ID.
+func (k *keyring) verificationKey(id string) (resolvedJWTKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.verification {
+		if key.id == id {
+			return key, true
+		}
+	}
+	return resolvedJWTKey{}, false
+}
+
+// Returns the decryption key with the provided ID.
+func (k *keyring) decryptionKey(id string) (JWEKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.decryption {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return JWEKey{}, false
+}
+
+// Returns the key management algorithms of every decryption key without duplicates.
+func (k *keyring) jweAlgorithms() []jose.KeyAlgorithm {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	algorithms := make([]jose.KeyAlgorithm, 0, len(k.decryption))
+	for _, key := range k.decryption {
+		if !slices.Contains(algorithms, key.Algorithm) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+// Returns the algorithms of every verification key without duplicates.
+func (k *keyring) algorithms() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	algorithms := make([]string, 0, len(k.verification))
+	seen := make(map[string]bool, len(k.verification))
+	for _, key := range k.verification {
+		alg := key.method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			algorithms = append(algorithms, alg)
+		}
+	}
+	return algorithms
+}
+
+// Tokens select their key by the `kid` header, so once there is more than one key every key
+// needs an ID of its own. Adding a key with an ID that is already taken would replace the key
+// and invalidate every token it signed.
+func checkNewKeyID(id string, existing func(id string) bool) error {
+	if id == "" {
+		return fmt.Errorf("key ID is required when there is more than one key")
+	}
+	if existing(id) {
+		return fmt.Errorf("key ID %q is already in use", id)
+	}
+	return nil
+}
+
+// RotateSigningKey makes the provided key the active signing key.
+// The previous signing key is kept as a verification key so tokens it signed stay valid until
+// they expire or it is removed with RemoveVerificationKey.
+// The key must be able to sign, meaning it needs a Secret or a PrivateKey, and it needs an ID
+// that no other key uses.
+// It is safe to call while tokens are being generated and verified.
+func (a *Authenticator[T]) RotateSigningKey(key JWTKey) error {
+	resolved, err := key.resolve()
+	if err != nil {
+		return err
+	}
+	if resolved.signKey == nil {
+		return fmt.Errorf("key %q cannot be used for signing", key.ID)
+	}
+
+	a.keys.mu.Lock()
+	defer a.keys.mu.Unlock()
+	if err := checkNewKeyID(resolved.id, a.keys.hasVerificationKey); err != nil {
+		return err
+	}
+	a.keys.signing = resolved
+	a.keys.verification = putJWTKey(a.keys.verification, resolved)
+	return nil
+}
+
+// AddVerificationKey adds a key that is only used to verify tokens.
+// The key needs an ID. A key with the same ID is replaced, unless it is the active signing key.
+func (a *Authenticator[T]) AddVerificationKey(key JWTKey) error {
+	resolved, err := key.resolve()
+	if err != nil {
+		return err
+	}
+	if resolved.id == "" {
+		return fmt.Errorf("key ID is required when there is more than one key")
+	}
+
+	a.keys.mu.Lock()
+	defer a.keys.mu.Unlock()
+	if resolved.id == a.keys.signing.id {
+		return fmt.Errorf("key %q is the active signing key", key.ID)
+	}
+	a.keys.verification = putJWTKey(a.keys.verification, resolved)
+	return nil
+}
+
+// RemoveVerificationKey removes the key with the provided ID from the verification keys.
+// Tokens signed with it will no longer be accepted.
+// The active signing key cannot be removed.
+func (a *Authenticator[T]) RemoveVerificationKey(id string) error {
+	a.keys.mu.Lock()
+	defer a.keys.mu.Unlock()
+	if id == a.keys.signing.id {
+		return fmt.Errorf("key %q is the active signing key", id)
+	}
+	a.keys.verification = slices.DeleteFunc(a.keys.verification, func(key resolvedJWTKey) bool {
+		return key.id == id
+	})
+	return nil
+}
+
+// RotateEncryptionKey makes the provided key the active JWE key.
+// The previous key is kept as a decryption key so tokens encrypted with it can still be read until
+// it is removed with RemoveDecryptionKey. The key needs an ID that no other JWE key uses.
+// It is safe to call while tokens are being generated and verified.
+func (a *Authenticator[T]) RotateEncryptionKey(key JWEKey) error {
+	key = a.withDefaultJWEAlgorithm(key)
+	if err := key.validate(a.jweContentEncryption()); err != nil {
+		return err
+	}
+
+	a.keys.mu.Lock()
+	defer a.keys.mu.Unlock()
+	if len(a.keys.decryption) > 0 {
+		if err := checkNewKeyID(key.ID, a.keys.hasDecryptionKey); err != nil {
+			return err
+		}
+	}
+	a.keys.encryption = key
+	a.keys.decryption = putJWEKey(a.keys.decryption, key)
+	return nil
+}
+
+// RemoveDecryptionKey removes the JWE key with the provided ID from the decryption keys.
+// The active encryption key cannot be removed.
+func (a *Authenticator[T]) RemoveDecryptionKey(id string) error {
+	a.keys.mu.Lock()
+	defer a.keys.mu.Unlock()
+	if a.keys.encryption.Key != nil && id == a.keys.encryption.ID {
+		return fmt.Errorf("JWE key %q is the active encryption key", id)
+	}
+	a.keys.decryption = slices.DeleteFunc(a.keys.decryption, func(key JWEKey) bool {
+		return key.ID == id
+	})
+	return nil
+}
@@ -0,0 +1,289 @@
+package grove_test
+
+import (
+	"crypto/elliptic"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func TestGenerateTokenWritesKeyIDHeaders(t *testing.T) {
+	config := validConfig(t, true)
+	config.KeyID = "signing-1"
+	config.JWEKeyID = "encryption-1"
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	parsed, err := auth.ParseToken(token, &TestClaims{})
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v; want nil", err)
+	}
+	if parsed.Header["kid"] != "signing-1" {
+		t.Fatalf("kid = %v; want signing-1", parsed.Header["kid"])
+	}
+}
+
+func TestRotateSigningKeyKeepsPreviousKeyForVerification(t *testing.T) {
+	config := validConfig(t, false)
+	config.KeyID = "v1"
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	oldToken, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	err = auth.RotateSigningKey(grove.JWTKey{
+		ID:         "v2",
+		Algorithm:  "ES256",
+		PrivateKey: testECDSAKey(t, elliptic.P256()),
+	})
+	if err != nil {
+		t.Fatalf("RotateSigningKey() error = %v; want nil", err)
+	}
+
+	newToken, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	parsed, err := auth.ParseToken(newToken, &TestClaims{})
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v; want nil", err)
+	}
+	if parsed.Header["kid"] != "v2" || parsed.Method.Alg() != "ES256" {
+		t.Fatalf("header = %v; want kid v2 signed with ES256", parsed.Header)
+	}
+
+	if _, err := auth.VerifyToken(oldToken, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken(old) error = %v; want nil", err)
+	}
+	if _, err := auth.VerifyToken(newToken, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken(new) error = %v; want nil", err)
+	}
+
+	if err := auth.RemoveVerificationKey("v1"); err != nil {
+		t.Fatalf("RemoveVerificationKey() error = %v; want nil", err)
+	}
+	if _, err := auth.VerifyToken(oldToken, &TestClaims{}); err == nil {
+		t.Fatalf("VerifyToken(old) error = nil; want unknown key error")
+	}
+	if _, err := auth.VerifyToken(newToken, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken(new) error = %v; want nil", err)
+	}
+}
+
+func TestRotateSigningKeyWithTakenIDShouldFail(t *testing.T) {
+	tests := []struct {
+		name  string
+		keyID string
+		newID string
+	}{
+		{name: "default empty ID", keyID: "", newID: ""},
+		{name: "same ID", keyID: "v1", newID: "v1"},
+		{name: "empty ID next to other keys", keyID: "v1", newID: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t, false)
+			config.KeyID = tt.keyID
+			auth, err := grove.NewAuthenticator[*TestClaims](&config)
+			if err != nil {
+				t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+			}
+			token, err := auth.GenerateToken(validClaims())
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v; want nil", err)
+			}
+
+			if err := auth.RotateSigningKey(grove.JWTKey{ID: tt.newID, Secret: "new-secret"}); err == nil {
+				t.Fatalf("RotateSigningKey() error = nil; want error")
+			}
+			if _, err := auth.VerifyToken(token, &TestClaims{}); err != nil {
+				t.Fatalf("VerifyToken() after rejected rotation error = %v; want nil", err)
+			}
+		})
+	}
+}
+
+func TestValidateVerificationKeyIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []grove.JWTKey
+	}{
+		{name: "empty ID", keys: []grove.JWTKey{{Secret: "old"}}},
+		{name: "signing key ID", keys: []grove.JWTKey{{ID: "v1", Secret: "old"}}},
+		{name: "duplicate ID", keys: []grove.JWTKey{{ID: "v0", Secret: "old"}, {ID: "v0", Secret: "older"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t, false)
+			config.KeyID = "v1"
+			config.VerificationKeys = tt.keys
+			if err := config.Validate(); err == nil {
+				t.Fatalf("Validate() error = nil; want error")
+			}
+			if _, err := grove.NewAuthenticator[*TestClaims](&config); err == nil {
+				t.Fatalf("NewAuthenticator() error = nil; want error")
+			}
+		})
+	}
+}
+
+func TestRemoveVerificationKeyActiveKeyShouldFail(t *testing.T) {
+	config := validConfig(t, false)
+	config.KeyID = "v1"
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	if err := auth.RemoveVerificationKey("v1"); err == nil {
+		t.Fatalf("RemoveVerificationKey() error = nil; want error")
+	}
+}
+
+func TestRotateSigningKeyWithoutPrivateKeyShouldFail(t *testing.T) {
+	config := validConfig(t, false)
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	err = auth.RotateSigningKey(grove.JWTKey{
+		ID:        "public-only",
+		Algorithm: "RS256",
+		PublicKey: &testRSAKey(t).PublicKey,
+	})
+	if err == nil {
+		t.Fatalf("RotateSigningKey() error = nil; want error")
+	}
+}
+
+func TestVerifyTokenWithConfiguredVerificationKey(t *testing.T) {
+	signingKey := testRSAKey(t)
+
+	issuerConfig := validConfig(t, false)
+	issuerConfig.KeyID = "issuer"
+	issuerConfig.SigningAlgorithm = "RS256"
+	issuerConfig.SigningKey = signingKey
+	issuer, err := grove.NewAuthenticator[*TestClaims](&issuerConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	token, err := issuer.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	verifierConfig := validConfig(t, false)
+	verifierConfig.KeyID = "local"
+	verifierConfig.VerificationKeys = []grove.JWTKey{
+		{ID: "issuer", Algorithm: "RS256", PublicKey: &signingKey.PublicKey},
+	}
+	if err := verifierConfig.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v; want nil", err)
+	}
+	verifier, err := grove.NewAuthenticator[*TestClaims](&verifierConfig)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	if _, err := verifier.VerifyToken(token, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+}
+
+func TestRotateEncryptionKeyKeepsPreviousKeyForDecryption(t *testing.T) {
+	config := validConfig(t, true)
+	config.JWEKeyID = "enc-1"
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	oldToken, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	if err := auth.RotateEncryptionKey(grove.JWEKey{ID: "enc-2", Key: testRSAKey(t)}); err != nil {
+		t.Fatalf("RotateEncryptionKey() error = %v; want nil", err)
+	}
+
+	newToken, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	if _, err := auth.VerifyToken(oldToken, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken(old) error = %v; want nil", err)
+	}
+	if _, err := auth.VerifyToken(newToken, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken(new) error = %v; want nil", err)
+	}
+
+	if err := auth.RemoveDecryptionKey("enc-2"); err == nil {
+		t.Fatalf("RemoveDecryptionKey(active) error = nil; want error")
+	}
+	if err := auth.RemoveDecryptionKey("enc-1"); err != nil {
+		t.Fatalf("RemoveDecryptionKey() error = %v; want nil", err)
+	}
+	if _, err := auth.VerifyToken(oldToken, &TestClaims{}); err == nil {
+		t.Fatalf("VerifyToken(old) error = nil; want unknown key error")
+	}
+}
+
+func TestRotateSigningKeyWhileVerifying(t *testing.T) {
+	config := validConfig(t, true)
+	config.KeyID = "v0"
+
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				token, err := auth.GenerateToken(validClaims())
+				if err != nil {
+					t.Errorf("GenerateToken() error = %v; want nil", err)
+					return
+				}
+				if _, err := auth.VerifyToken(token, &TestClaims{}); err != nil {
+					t.Errorf("VerifyToken() error = %v; want nil", err)
+					return
+				}
+			}
+		}()
+
+		if err := auth.RotateSigningKey(grove.JWTKey{ID: "v" + strconv.Itoa(i+1), Secret: "secret"}); err != nil {
+			t.Fatalf("RotateSigningKey() error = %v; want nil", err)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,374 @@
+package grove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrTooManyAttempts  = errors.New("too many failed login attempts")
+	errLoginUnavailable = errors.New("login is not configured")
+)
+
+// ICredentialStore gives `LoginHandler` access to the password hashes of the users.
+type ICredentialStore interface {
+	// GetPasswordHash returns the encoded password hash of the user or ErrUserNotFound.
+	GetPasswordHash(ctx context.Context, username string) (string, error)
+	// UpdatePasswordHash replaces the password hash of the user.
+	// It is called after a successful login when the hash needs to be upgraded.
+	UpdatePasswordHash(ctx context.Context, username string, encoded string) error
+}
+
+// ILoginThrottle limits the number of failed login attempts per account.
+type ILoginThrottle interface {
+	// Allow reports whether a login attempt for the key may be made. If not, it returns how long
+	// the caller has to wait. An allowed attempt should be counted until it is resolved with
+	// Failure or Success, so concurrent attempts cannot exceed the limit.
+	Allow(ctx context.Context, key string) (bool, time.Duration)
+	// Failure records a failed login attempt for the key.
+	Failure(ctx context.Context, key string)
+	// Success resets the failed attempts of the key.
+	Success(ctx context.Context, key string)
+}
+
+// Defaults of `MemoryLoginThrottle`, used when a value is zero or negative.
+const (
+	DefaultLoginMaxAttempts = 5
+	DefaultLoginWindow      = 15 * time.Minute
+	DefaultLoginLockout     = 15 * time.Minute
+)
+
+// How long callers are asked to wait when the limit is only reached by attempts that are still
+// being verified.
+const loginPendingRetryAfter = time.Second
+
+type loginAttempts struct {
+	failures    int
+	pending     int
+	firstFailed time.Time
+	lockedUntil time.Time
+}
+
+// MemoryLoginThrottle is an in-memory `ILoginThrottle`.
+// An account is locked for Lockout once MaxAttempts logins failed within Window.
+// It is safe for concurrent use but its state is not shared between instances.
+type MemoryLoginThrottle struct {
+	// The number of failed attempts that locks the account. Defaults to DefaultLoginMaxAttempts.
+	MaxAttempts int
+	// The period failed attempts are counted in. Defaults to DefaultLoginWindow.
+	Window time.Duration
+	// How long the account is locked. Defaults to DefaultLoginLockout.
+	Lockout time.Duration
+
+	mu       sync.Mutex
+	attempts map[string]*loginAttempts
+}
+
+// Initializes a MemoryLoginThrottle. A struct literal works as well.
+func NewMemoryLoginThrottle(maxAttempts int, window time.Duration, lockout time.Duration) *MemoryLoginThrottle {
+	return &MemoryLoginThrottle{
+		MaxAttempts: maxAttempts,
+		Window:      window,
+		Lockout:     lockout,
+		attempts:    make(map[string]*loginAttempts),
+	}
+}
+
+func (t *MemoryLoginThrottle) maxAttempts() int {
+	if t.MaxAttempts <= 0 {
+		return DefaultLoginMaxAttempts
+	}
+	return t.MaxAttempts
+}
+
+func (t *MemoryLoginThrottle) window() time.Duration {
+	if t.Window <= 0 {
+		return DefaultLoginWindow
+	}
+	return t.Window
+}
+
+func (t *MemoryLoginThrottle) lockout() time.Duration {
+	if t.Lockout <= 0 {
+		return DefaultLoginLockout
+	}
+	return t.Lockout
+}
+
+// Allow reports whether the account is not locked and reserves the attempt. Attempts that were
+// allowed but not yet resolved with Failure or Success count as failures, they are dropped when
+// the Window passes.
+func (t *MemoryLoginThrottle) Allow(ctx context.Context, key string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+
+	attempts, ok := t.attempts[key]
+	if ok {
+		if wait := attempts.lockedUntil.Sub(now); wait > 0 {
+			return false, wait
+		}
+	}
+	if t.attempts == nil {
+		t.attempts = make(map[string]*loginAttempts)
+	}
+	if !ok || now.Sub(attempts.firstFailed) > t.window() {
+		attempts = &loginAttempts{firstFailed: now}
+		t.attempts[key] = attempts
+	}
+	if attempts.failures+attempts.pending >= t.maxAttempts() {
+		return false, loginPendingRetryAfter
+	}
+	attempts.pending++
+	return true, 0
+}
+
+// Failure records a failed attempt and locks the account when MaxAttempts is reached.
+func (t *MemoryLoginThrottle) Failure(ctx context.Context, key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+
+	// The map is created on the first write so the throttle also works as a struct literal.
+	if t.attempts == nil {
+		t.attempts = make(map[string]*loginAttempts)
+	}
+	attempts, ok := t.attempts[key]
+	if !ok || now.Sub(attempts.firstFailed) > t.window() {
+		attempts = &loginAttempts{firstFailed: now}
+		t.attempts[key] = attempts
+	}
+	if attempts.pending > 0 {
+		attempts.pending--
+	}
+	attempts.failures++
+	if attempts.failures >= t.maxAttempts() {
+		attempts.lockedUntil = now.Add(t.lockout())
+		attempts.failures = 0
+		attempts.firstFailed = now
+	}
+}
+
+// Success resets the failed attempts of the account.
+func (t *MemoryLoginThrottle) Success(ctx context.Context, key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+}
+
+// Must be called while holding the mutex.
+func (t *MemoryLoginThrottle) prune(now time.Time) {
+	for key, attempts := range t.attempts {
+		if now.Sub(attempts.firstFailed) > t.window() && now.After(attempts.lockedUntil) {
+			delete(t.attempts, key)
+		}
+	}
+}
+
+// Config used by `Authenticator.LoginHandler`.
+type LoginConfig[T jwt.Claims] struct {
+	// Loads and updates the password hashes. Required.
+	Store ICredentialStore
+	// Verifies the passwords and hashes them again when their parameters changed.
+	// Defaults to NewArgon2idHasher().
+	Hasher IPasswordHasher
+	// Limits failed attempts per account. Defaults to 5 failures within 15 minutes locking the
+	// account for 15 minutes.
+	Throttle ILoginThrottle
+	// Builds the claims of the access token for the user. The subject defaults to the username
+	// when it is not set. Required.
+	ClaimsFactory func(r *http.Request, username string) (T, error)
+	// Also writes the access token to the session cookie.
+	SetSessionCookie bool
+	// When it is set, users that enrolled a second factor get an `MFAChallengeResponse` instead
+	// of a token and have to complete the login with `Authenticator.MFAHandler`. Optional.
+	MFAStore IMFAStore
+	// Receives errors that do not fail the login, such as a failed rehash. Optional.
+	Logger ILogger
+}
+
+// Reads the username and password from a JSON body or a form.
+func readCredentials(w http.ResponseWriter, r *http.Request) (string, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, err := ParseJsonBodyFromRequest[struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}](r)
+		if err != nil {
+			return "", "", err
+		}
+		return body.Username, body.Password, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return "", "", err
+	}
+	return r.PostForm.Get("username"), r.PostForm.Get("password"), nil
+}
+
+// Verifies the password of the user and upgrades its hash when needed.
+// Unknown users are checked against a dummy hash so they take as long as known users.
+func (a *Authenticator[T]) verifyLogin(ctx context.Context, config *LoginConfig[T], dummyHash func() string, username string, password string) error {
+	encoded, err := config.Store.GetPasswordHash(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		_, _ = config.Hasher.VerifyPassword(password, dummyHash())
+		return ErrCredentialsInvalid
+	}
+	if err != nil {
+		return fmt.Errorf("an error occurred while loading password hash: %v", err)
+	}
+
+	needsRehash, err := config.Hasher.VerifyPassword(password, encoded)
+	if errors.Is(err, ErrPasswordMismatch) {
+		return ErrCredentialsInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if needsRehash {
+		rehashed, err := config.Hasher.HashPassword(password)
+		if err == nil {
+			err = config.Store.UpdatePasswordHash(ctx, username, rehashed)
+		}
+		if err != nil && config.Logger != nil {
+			config.Logger.Errorf("Failed to rehash password of %q: %v", username, err)
+		}
+	}
+	return nil
+}
+
+// LoginHandler returns a reference handler that exchanges a username and password for a token.
+// The credentials are read from the `username` and `password` fields of a JSON or form encoded
+// POST body and the password is verified with the configured hasher. Hashes created with other
+// parameters or another algorithm are replaced after a successful login.
+//
+// Failed attempts are throttled per account and locked accounts get 429 Too Many Requests with a
+// Retry-After header. Wrong usernames and wrong passwords get the same 401 response.
+// On success the response is a `RefreshTokenResponse`, which includes a refresh token when a
+// RefreshTokenStore is configured, or an `MFAChallengeResponse` when the user has a second factor.
+func (a *Authenticator[T]) LoginHandler(config LoginConfig[T]) http.Handler {
+	if config.Hasher == nil {
+		config.Hasher = NewArgon2idHasher()
+	}
+	if config.Throttle == nil {
+		config.Throttle = NewMemoryLoginThrottle(DefaultLoginMaxAttempts, DefaultLoginWindow, DefaultLoginLockout)
+	}
+	var dummyOnce sync.Once
+	var dummy string
+	dummyHash := func() string {
+		dummyOnce.Do(func() {
+			dummy, _ = config.Hasher.HashPassword("grove-dummy-password")
+		})
+		return dummy
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteErrorToResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if config.Store == nil || config.ClaimsFactory == nil {
+			WriteErrorToResponse(w, http.StatusInternalServerError, errLoginUnavailable.Error())
+			return
+		}
+
+		username, password, err := readCredentials(w, r)
+		if err != nil || username == "" || password == "" {
+			WriteErrorToResponse(w, http.StatusBadRequest, "username and password are required")
+			return
+		}
+
+		throttleKey := strings.ToLower(strings.TrimSpace(username))
+		if ok, wait := config.Throttle.Allow(r.Context(), throttleKey); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			WriteErrorToResponse(w, http.StatusTooManyRequests, ErrTooManyAttempts.Error())
+			return
+		}
+
+		if err := a.verifyLogin(r.Context(), &config, dummyHash, username, password); err != nil {
+			if !errors.Is(err, ErrCredentialsInvalid) {
+				if config.Logger != nil {
+					config.Logger.Errorf("Failed to verify login of %q: %v", username, err)
+				}
+				WriteErrorToResponse(w, http.StatusInternalServerError, "failed to verify credentials")
+				return
+			}
+			config.Throttle.Failure(r.Context(), throttleKey)
+			WriteErrorToResponse(w, http.StatusUnauthorized, "invalid username or password")
+			return
+		}
+		config.Throttle.Success(r.Context(), throttleKey)
+
+		if config.MFAStore != nil {
+			challenged, err := a.writeMFAChallenge(w, r.Context(), config.MFAStore, username)
+			if err != nil {
+				if config.Logger != nil {
+					config.Logger.Errorf("Failed to start multi-factor authentication of %q: %v", username, err)
+				}
+				WriteErrorToResponse(w, http.StatusInternalServerError, "failed to verify credentials")
+				return
+			}
+			if challenged {
+				return
+			}
+		}
+
+		a.writeTokenResponse(w, r, username, config.ClaimsFactory, config.SetSessionCookie)
+	})
+}
+
+// Generates the access token, and a refresh token when a RefreshTokenStore is configured, for
+// the subject and writes them as a `RefreshTokenResponse`.
+func (a *Authenticator[T]) writeTokenResponse(w http.ResponseWriter, r *http.Request, subject string, claimsFactory func(r *http.Request, subject string) (T, error), setCookie bool) {
+	claims, err := claimsFactory(r, subject)
+	if err != nil {
+		WriteErrorToResponse(w, http.StatusUnauthorized, "user cannot sign in")
+		return
+	}
+	if registered := registeredClaimsOf(claims); registered != nil && registered.Subject == "" {
+		registered.Subject = subject
+	}
+
+	accessToken, err := a.GenerateToken(claims)
+	if err != nil {
+		WriteErrorToResponse(w, http.StatusInternalServerError, "failed to generate access token")
+		return
+	}
+
+	var refreshToken string
+	if a.RefreshTokenStore != nil {
+		if refreshToken, err = a.IssueRefreshToken(r.Context(), subject); err != nil {
+			WriteErrorToResponse(w, http.StatusInternalServerError, "failed to generate refresh token")
+			return
+		}
+	}
+	if setCookie {
+		a.SetSessionCookie(w, accessToken)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = WriteJsonBodyToResponse(w, RefreshTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(a.Lifetime.Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
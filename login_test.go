@@ -0,0 +1,241 @@
+package grove_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type testCredentialStore struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+func (s *testCredentialStore) GetPasswordHash(ctx context.Context, username string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash, ok := s.hashes[username]
+	if !ok {
+		return "", grove.ErrUserNotFound
+	}
+	return hash, nil
+}
+
+func (s *testCredentialStore) UpdatePasswordHash(ctx context.Context, username string, encoded string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hashes[username] = encoded
+	return nil
+}
+
+func TestLoginHandler(t *testing.T) {
+	auth := refreshAuthenticator(t, nil)
+	hasher := testArgon2idHasher()
+	bcryptHash, _ := grove.NewBcryptHasher(bcrypt.MinCost).HashPassword("correct horse")
+	store := &testCredentialStore{hashes: map[string]string{"alice": bcryptHash}}
+
+	handler := auth.LoginHandler(grove.LoginConfig[*TestClaims]{
+		Store:    store,
+		Hasher:   hasher,
+		Throttle: grove.NewMemoryLoginThrottle(3, time.Minute, time.Minute),
+		ClaimsFactory: func(r *http.Request, username string) (*TestClaims, error) {
+			return &TestClaims{Email: username + "@example.com", RegisteredClaims: &jwt.RegisteredClaims{}}, nil
+		},
+		SetSessionCookie: true,
+		Logger:           &testLogger{},
+	})
+
+	post := func(contentType string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("application/json", `{"username":"alice","password":"correct horse"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+
+	var response grove.RefreshTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.TokenType != "Bearer" || response.RefreshToken == "" {
+		t.Fatalf("response = %+v; want a bearer token and a refresh token", response)
+	}
+	claims, err := auth.VerifyToken(response.AccessToken, &TestClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" {
+		t.Fatalf("claims = %+v; want subject and email of alice", claims)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != response.AccessToken {
+		t.Fatalf("cookies = %v; want the session cookie with the access token", cookies)
+	}
+
+	rehashed, _ := store.GetPasswordHash(context.Background(), "alice")
+	if !strings.HasPrefix(rehashed, "$argon2id$") {
+		t.Fatalf("stored hash = %q; want bcrypt hash replaced with argon2id", rehashed)
+	}
+
+	form := url.Values{"username": {"alice"}, "password": {"correct horse"}}.Encode()
+	if rec := post("application/x-www-form-urlencoded", form); rec.Code != http.StatusOK {
+		t.Fatalf("form status = %d; want %d", rec.Code, http.StatusOK)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "missing password", body: `{"username":"alice"}`, want: http.StatusBadRequest},
+		{name: "wrong password", body: `{"username":"alice","password":"wrong"}`, want: http.StatusUnauthorized},
+		{name: "unknown user", body: `{"username":"bob","password":"correct horse"}`, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post("application/json", tt.body); rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/login", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status = %d; want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestLoginHandlerThrottlesFailedAttempts(t *testing.T) {
+	auth := testAuthenticator(t)
+	hasher := testArgon2idHasher()
+	hash, _ := hasher.HashPassword("correct horse")
+	store := &testCredentialStore{hashes: map[string]string{"alice": hash}}
+
+	handler := auth.LoginHandler(grove.LoginConfig[*TestClaims]{
+		Store:    store,
+		Hasher:   hasher,
+		Throttle: grove.NewMemoryLoginThrottle(2, time.Minute, time.Minute),
+		ClaimsFactory: func(r *http.Request, username string) (*TestClaims, error) {
+			return &TestClaims{RegisteredClaims: &jwt.RegisteredClaims{}}, nil
+		},
+	})
+
+	post := func(username string, password string) *httptest.ResponseRecorder {
+		body := url.Values{"username": {username}, "password": {password}}.Encode()
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := post("alice", "wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d status = %d; want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	rec := post("Alice", "correct horse")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked status = %d; want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("Retry-After is empty; want the lockout duration")
+	}
+
+	if rec := post("carol", "whatever"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("other account status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestMemoryLoginThrottle(t *testing.T) {
+	throttle := grove.NewMemoryLoginThrottle(2, time.Minute, 50*time.Millisecond)
+	ctx := context.Background()
+
+	throttle.Failure(ctx, "alice")
+	if ok, _ := throttle.Allow(ctx, "alice"); !ok {
+		t.Fatalf("Allow() after one failure = false; want true")
+	}
+	throttle.Success(ctx, "alice")
+	throttle.Failure(ctx, "alice")
+	if ok, _ := throttle.Allow(ctx, "alice"); !ok {
+		t.Fatalf("Allow() after success reset = false; want true")
+	}
+
+	throttle.Failure(ctx, "alice")
+	if ok, wait := throttle.Allow(ctx, "alice"); ok || wait <= 0 {
+		t.Fatalf("Allow() after two failures = %v, %v; want false with a wait", ok, wait)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := throttle.Allow(ctx, "alice"); !ok {
+		t.Fatalf("Allow() after lockout = false; want true")
+	}
+}
+
+func TestMemoryLoginThrottleAsStructLiteral(t *testing.T) {
+	throttle := &grove.MemoryLoginThrottle{MaxAttempts: 2, Window: time.Minute, Lockout: time.Minute}
+	ctx := context.Background()
+
+	throttle.Failure(ctx, "alice")
+	throttle.Failure(ctx, "alice")
+	if ok, _ := throttle.Allow(ctx, "alice"); ok {
+		t.Fatalf("Allow() after two failures = true; want false")
+	}
+}
+
+func TestMemoryLoginThrottleDefaults(t *testing.T) {
+	throttle := grove.NewMemoryLoginThrottle(0, 0, -time.Minute)
+	ctx := context.Background()
+
+	for i := 1; i < grove.DefaultLoginMaxAttempts; i++ {
+		throttle.Failure(ctx, "alice")
+		if ok, _ := throttle.Allow(ctx, "alice"); !ok {
+			t.Fatalf("Allow() after %d failures = false; want true", i)
+		}
+	}
+	throttle.Failure(ctx, "alice")
+	if ok, wait := throttle.Allow(ctx, "alice"); ok || wait <= grove.DefaultLoginLockout-time.Minute {
+		t.Fatalf("Allow() after %d failures = %v, %v; want false with the default lockout", grove.DefaultLoginMaxAttempts, ok, wait)
+	}
+}
+
+func TestMemoryLoginThrottleCountsPendingAttempts(t *testing.T) {
+	throttle := grove.NewMemoryLoginThrottle(3, time.Minute, time.Minute)
+	ctx := context.Background()
+
+	// Concurrent guesses are all allowed before any of them fails.
+	allowed := 0
+	for range 5 {
+		if ok, _ := throttle.Allow(ctx, "alice"); ok {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("Allow() allowed %d concurrent attempts; want 3", allowed)
+	}
+
+	throttle.Success(ctx, "alice")
+	if ok, _ := throttle.Allow(ctx, "alice"); !ok {
+		t.Fatalf("Allow() after success = false; want true")
+	}
+}
@@ -0,0 +1,216 @@
+package grove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The `typ` header of the tokens created by `GenerateMFAPendingToken`.
+const MFAPendingTokenType = "mfa-pending+jwt"
+
+// How long an MFA pending token can be used when MFAPendingTokenLifetime is not set.
+const DefaultMFAPendingTokenLifetime = 5 * time.Minute
+
+// Reports whether the token is an MFA pending token.
+func isMFAPendingToken(token *jwt.Token) bool {
+	return strings.EqualFold(tokenTypeOf(token), MFAPendingTokenType)
+}
+
+// The audience of MFA pending tokens. It differs from the configured Audience so services that
+// accept the access tokens do not accept pending tokens, even if they ignore the `typ` header.
+func (config *AuthenticatorConfig) mfaPendingAudience() string {
+	return config.Issuer + "#mfa"
+}
+
+func (config *AuthenticatorConfig) mfaPendingTokenLifetime() time.Duration {
+	if config.MFAPendingTokenLifetime <= 0 {
+		return DefaultMFAPendingTokenLifetime
+	}
+	return config.MFAPendingTokenLifetime
+}
+
+// GenerateMFAPendingToken creates the short lived token handed out after the password of the
+// subject was verified but before the second factor was. It only carries registered claims, its
+// audience is the Issuer followed by `#mfa` and its `typ` header is MFAPendingTokenType, so
+// `VerifyToken`, and with it `DefaultAuthMiddleware`, rejects it with ErrTokenMFAPending. Only
+// `VerifyMFAPendingToken` accepts it.
+func (a *Authenticator[T]) GenerateMFAPendingToken(subject string) (string, error) {
+	now := a.now()
+	claims := &jwt.RegisteredClaims{
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{a.mfaPendingAudience()},
+		ExpiresAt: jwt.NewNumericDate(now.Add(a.mfaPendingTokenLifetime())),
+	}
+	return a.generateToken(claims, MFAPendingTokenType)
+}
+
+// VerifyMFAPendingToken verifies a token created by `GenerateMFAPendingToken` and returns its
+// subject. Regular access tokens are rejected with ErrTokenInvalidClaims.
+func (a *Authenticator[T]) VerifyMFAPendingToken(token string) (string, error) {
+	return a.verifyMFAPendingToken(context.Background(), token)
+}
+
+func (a *Authenticator[T]) verifyMFAPendingToken(ctx context.Context, token string) (string, error) {
+	parsedToken, err := a.verifyToken(ctx, token, &jwt.RegisteredClaims{}, []string{a.mfaPendingAudience()})
+	if parsedToken != nil && !isMFAPendingToken(parsedToken) {
+		return "", fmt.Errorf("%w: token is not an MFA pending token", ErrTokenInvalidClaims)
+	}
+	if err != nil {
+		return "", err
+	}
+	subject, err := parsedToken.Claims.GetSubject()
+	if err != nil || subject == "" {
+		return "", fmt.Errorf("%w: token is missing the sub claim", ErrTokenInvalidClaims)
+	}
+	return subject, nil
+}
+
+// The response written by `Authenticator.LoginHandler` when the user has to provide a second
+// factor. The MFAToken is sent to `Authenticator.MFAHandler` together with the code.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Writes the MFA challenge for the subject if it enrolled a second factor.
+// It returns false if the login can continue without one.
+func (a *Authenticator[T]) writeMFAChallenge(w http.ResponseWriter, ctx context.Context, store IMFAStore, subject string) (bool, error) {
+	if _, err := store.GetTOTPSecret(ctx, subject); errors.Is(err, ErrMFANotEnrolled) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("an error occurred while loading TOTP secret: %v", err)
+	}
+
+	token, err := a.GenerateMFAPendingToken(subject)
+	if err != nil {
+		return false, err
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	_ = WriteJsonBodyToResponse(w, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(a.mfaPendingTokenLifetime().Seconds()),
+	})
+	return true, nil
+}
+
+// Config used by `Authenticator.MFAHandler`.
+type MFAConfig[T jwt.Claims] struct {
+	// Holds the TOTP secrets and recovery codes. Required.
+	Store IMFAStore
+	// Limits failed attempts per subject. Defaults to 5 failures within 15 minutes locking the
+	// subject for 15 minutes.
+	Throttle ILoginThrottle
+	// The number of periods of clock drift that are tolerated. If it is zero DefaultTOTPSkew is
+	// used, a negative value only accepts the current period.
+	Skew int
+	// Builds the claims of the access token for the subject. The subject is set when it is
+	// empty. Required.
+	ClaimsFactory func(r *http.Request, subject string) (T, error)
+	// Also writes the access token to the session cookie.
+	SetSessionCookie bool
+	// Receives errors that are not caused by the client. Optional.
+	Logger ILogger
+}
+
+type mfaVerification struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// Reads the MFA token and the code from a JSON body or a form.
+func readMFAVerification(w http.ResponseWriter, r *http.Request) (mfaVerification, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return ParseJsonBodyFromRequest[mfaVerification](r)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return mfaVerification{}, err
+	}
+	return mfaVerification{
+		MFAToken:     r.PostForm.Get("mfa_token"),
+		Code:         r.PostForm.Get("code"),
+		RecoveryCode: r.PostForm.Get("recovery_code"),
+	}, nil
+}
+
+// MFAHandler returns the verification endpoint of the second factor.
+// It reads the `mfa_token` returned by `LoginHandler` and either a TOTP `code` or a
+// `recovery_code` from a JSON or form encoded POST body. When the code is valid it responds with
+// a `RefreshTokenResponse` like `LoginHandler` does for users without a second factor.
+//
+// TOTP codes are verified with `VerifyTOTP`, so each code is only accepted once, and recovery
+// codes are consumed. Failed attempts are throttled per subject and throttled subjects get 429
+// Too Many Requests with a Retry-After header.
+func (a *Authenticator[T]) MFAHandler(config MFAConfig[T]) http.Handler {
+	if config.Throttle == nil {
+		config.Throttle = NewMemoryLoginThrottle(DefaultLoginMaxAttempts, DefaultLoginWindow, DefaultLoginLockout)
+	}
+	if config.Skew == 0 {
+		config.Skew = DefaultTOTPSkew
+	} else if config.Skew < 0 {
+		config.Skew = 0
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteErrorToResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if config.Store == nil || config.ClaimsFactory == nil {
+			WriteErrorToResponse(w, http.StatusInternalServerError, "multi-factor authentication is not configured")
+			return
+		}
+
+		body, err := readMFAVerification(w, r)
+		if err != nil || body.MFAToken == "" || (body.Code == "" && body.RecoveryCode == "") {
+			WriteErrorToResponse(w, http.StatusBadRequest, "mfa_token and code or recovery_code are required")
+			return
+		}
+
+		subject, err := a.verifyMFAPendingToken(r.Context(), body.MFAToken)
+		if err != nil {
+			WriteErrorToResponse(w, http.StatusUnauthorized, "invalid mfa_token")
+			return
+		}
+
+		if ok, wait := config.Throttle.Allow(r.Context(), subject); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			WriteErrorToResponse(w, http.StatusTooManyRequests, ErrTooManyAttempts.Error())
+			return
+		}
+
+		if body.Code != "" {
+			err = VerifyTOTP(r.Context(), config.Store, subject, body.Code, a.now(), config.Skew)
+		} else {
+			err = VerifyRecoveryCode(r.Context(), config.Store, subject, body.RecoveryCode)
+		}
+		if err != nil {
+			if !errors.Is(err, ErrTOTPInvalid) && !errors.Is(err, ErrTOTPReplayed) && !errors.Is(err, ErrRecoveryCodeInvalid) {
+				if config.Logger != nil {
+					config.Logger.Errorf("Failed to verify second factor of %q: %v", subject, err)
+				}
+				WriteErrorToResponse(w, http.StatusInternalServerError, "failed to verify code")
+				return
+			}
+			config.Throttle.Failure(r.Context(), subject)
+			WriteErrorToResponse(w, http.StatusUnauthorized, "invalid code")
+			return
+		}
+		config.Throttle.Success(r.Context(), subject)
+
+		a.writeTokenResponse(w, r, subject, config.ClaimsFactory, config.SetSessionCookie)
+	})
+}
@@ -0,0 +1,162 @@
+package grove_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMFAPendingTokenIsOnlyAcceptedByVerifyMFAPendingToken(t *testing.T) {
+	auth := testAuthenticator(t)
+
+	pending, err := auth.GenerateMFAPendingToken("alice")
+	if err != nil {
+		t.Fatalf("GenerateMFAPendingToken() error = %v; want nil", err)
+	}
+
+	if _, err := auth.VerifyToken(pending, &TestClaims{}); !errors.Is(err, grove.ErrTokenMFAPending) {
+		t.Fatalf("VerifyToken() error = %v; want ErrTokenMFAPending", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+pending)
+	rec := httptest.NewRecorder()
+	authenticatedHandler(auth).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("middleware status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	subject, err := auth.VerifyMFAPendingToken(pending)
+	if err != nil || subject != "alice" {
+		t.Fatalf("VerifyMFAPendingToken() = %q, %v; want alice, nil", subject, err)
+	}
+
+	full, _ := auth.GenerateToken(validClaims())
+	if _, err := auth.VerifyMFAPendingToken(full); !errors.Is(err, grove.ErrTokenInvalidClaims) {
+		t.Fatalf("VerifyMFAPendingToken() with access token error = %v; want ErrTokenInvalidClaims", err)
+	}
+}
+
+func TestMFAPendingTokenHasItsOwnAudience(t *testing.T) {
+	auth := testAuthenticator(t)
+
+	pending, err := auth.GenerateMFAPendingToken("alice")
+	if err != nil {
+		t.Fatalf("GenerateMFAPendingToken() error = %v; want nil", err)
+	}
+
+	// A service that shares the key but does not know about the `typ` header.
+	keyFunc := func(*jwt.Token) (any, error) { return []byte("secret"), nil }
+	if _, err := jwt.Parse(pending, keyFunc, jwt.WithIssuer("Testing"), jwt.WithAudience("testing")); !errors.Is(err, jwt.ErrTokenInvalidAudience) {
+		t.Fatalf("Parse() with the access token audience error = %v; want ErrTokenInvalidAudience", err)
+	}
+	if _, err := jwt.Parse(pending, keyFunc, jwt.WithIssuer("Testing"), jwt.WithAudience("Testing#mfa")); err != nil {
+		t.Fatalf("Parse() with the MFA audience error = %v; want nil", err)
+	}
+
+	config := validConfig(t, false)
+	config.Audience = []string{"testing", "Testing#mfa"}
+	if err := config.Validate(); err == nil {
+		t.Fatalf("Validate() with the MFA audience error = nil; want error")
+	}
+}
+
+func TestLoginWithSecondFactor(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	auth := refreshAuthenticator(t, func() time.Time { return now })
+	hasher := testArgon2idHasher()
+	hash, _ := hasher.HashPassword("correct horse")
+	credentials := &testCredentialStore{hashes: map[string]string{"alice": hash}}
+
+	codes, hashes, _ := grove.GenerateRecoveryCodes(2)
+	mfaStore := grove.NewMemoryMFAStore()
+	mfaStore.Enroll("alice", rfc6238Secret, hashes)
+
+	claimsFactory := func(r *http.Request, subject string) (*TestClaims, error) {
+		return &TestClaims{Email: subject + "@example.com", RegisteredClaims: &jwt.RegisteredClaims{}}, nil
+	}
+	login := auth.LoginHandler(grove.LoginConfig[*TestClaims]{
+		Store:         credentials,
+		Hasher:        hasher,
+		ClaimsFactory: claimsFactory,
+		MFAStore:      mfaStore,
+	})
+	verify := auth.MFAHandler(grove.MFAConfig[*TestClaims]{
+		Store:         mfaStore,
+		Throttle:      grove.NewMemoryLoginThrottle(3, time.Minute, time.Minute),
+		ClaimsFactory: claimsFactory,
+	})
+
+	post := func(handler http.Handler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(login, `{"username":"alice","password":"correct horse"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	var challenge grove.MFAChallengeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&challenge); err != nil {
+		t.Fatalf("failed to decode challenge: %v", err)
+	}
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("challenge = %+v; want mfa_required with an mfa_token", challenge)
+	}
+
+	code, _ := grove.GenerateTOTPCode(rfc6238Secret, now)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "missing code", body: `{"mfa_token":"` + challenge.MFAToken + `"}`, want: http.StatusBadRequest},
+		{name: "invalid token", body: `{"mfa_token":"invalid","code":"` + code + `"}`, want: http.StatusUnauthorized},
+		{name: "wrong code", body: `{"mfa_token":"` + challenge.MFAToken + `","code":"000000"}`, want: http.StatusUnauthorized},
+		{name: "valid code", body: `{"mfa_token":"` + challenge.MFAToken + `","code":"` + code + `"}`, want: http.StatusOK},
+		{name: "replayed code", body: `{"mfa_token":"` + challenge.MFAToken + `","code":"` + code + `"}`, want: http.StatusUnauthorized},
+		{name: "recovery code", body: `{"mfa_token":"` + challenge.MFAToken + `","recovery_code":"` + codes[0] + `"}`, want: http.StatusOK},
+		{name: "throttled", body: `{"mfa_token":"` + challenge.MFAToken + `","recovery_code":"` + codes[1] + `"}`, want: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		if tt.name == "throttled" {
+			for range 3 {
+				post(verify, `{"mfa_token":"`+challenge.MFAToken+`","code":"000000"}`)
+			}
+		}
+		rec := post(verify, tt.body)
+		if rec.Code != tt.want {
+			t.Fatalf("%s: status = %d; want %d", tt.name, rec.Code, tt.want)
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+
+		var response grove.RefreshTokenResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.name, err)
+		}
+		claims, err := auth.VerifyToken(response.AccessToken, &TestClaims{})
+		if err != nil || claims.Subject != "alice" {
+			t.Fatalf("%s: VerifyToken() = %+v, %v; want claims of alice", tt.name, claims, err)
+		}
+	}
+
+	mfaStore.Unenroll("alice")
+	rec = post(login, `{"username":"alice","password":"correct horse"}`)
+	var response grove.RefreshTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.AccessToken == "" {
+		t.Fatalf("login without second factor = %s; want an access token", rec.Body.String())
+	}
+}
@@ -3,7 +3,6 @@ package grove
 import (
 	"context"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -24,41 +23,149 @@ type authTokenKeyType struct{}
 // Key that should be used to pull auth token from the request context.
 var AuthTokenKey = authTokenKeyType{}
 
+// Implemented by verifiers that know the name of the session cookie, such as `Authenticator`.
+type sessionCookieNamer interface {
+	SessionCookieName() string
+}
+
+// ITokenVerifier verifies a token and parses its claims into the provided claims value.
+// `Authenticator` verifies tokens it generated itself while `RemoteJWKSVerifier` verifies
+// tokens issued by a third party. Either can be passed to `DefaultAuthMiddleware`.
+type ITokenVerifier[T jwt.Claims] interface {
+	VerifyToken(token string, claims T) (T, error)
+}
+
+// Implemented by verifiers that accept the context of the request, such as `Authenticator`.
+// `DefaultAuthMiddleware` prefers it over ITokenVerifier so that revocation lookups are canceled
+// together with the request.
+type contextTokenVerifier[T jwt.Claims] interface {
+	VerifyTokenContext(ctx context.Context, token string, claims T) (T, error)
+}
+
+// Option that changes the behavior of `DefaultAuthMiddleware`.
+type AuthMiddlewareOption func(options *authMiddlewareOptions)
+
+type authMiddlewareOptions struct {
+	extractors     []TokenExtractor
+	allowAnonymous bool
+	realm          string
+	unauthorized   func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// WithTokenExtractors replaces the places `DefaultAuthMiddleware` reads the token from.
+// The extractors are tried in order and the first token found is verified, later extractors
+// are not consulted even if that token is invalid.
+func WithTokenExtractors(extractors ...TokenExtractor) AuthMiddlewareOption {
+	return func(options *authMiddlewareOptions) {
+		options.extractors = extractors
+	}
+}
+
+// WithAnonymousAccess lets requests without a token through to the next handler.
+// No claims are stored under AuthTokenKey for them, so handlers must check whether they are
+// present. Requests with an invalid token are still rejected.
+func WithAnonymousAccess() AuthMiddlewareOption {
+	return func(options *authMiddlewareOptions) {
+		options.allowAnonymous = true
+	}
+}
+
+// WithRealm sets the realm of the `WWW-Authenticate` challenge sent with 401 responses.
+func WithRealm(realm string) AuthMiddlewareOption {
+	return func(options *authMiddlewareOptions) {
+		options.realm = realm
+	}
+}
+
+// WithUnauthorizedHandler replaces the response written when the token is missing or invalid.
+// The error describes why the request was rejected, it is ErrTokenMissing when the request has
+// no token and otherwise the error returned by the verifier.
+func WithUnauthorizedHandler(handler func(w http.ResponseWriter, r *http.Request, err error)) AuthMiddlewareOption {
+	return func(options *authMiddlewareOptions) {
+		options.unauthorized = handler
+	}
+}
+
+// Applies the options on top of the defaults of a middleware.
+// The challenge writes the response of the default unauthorized handler.
+func newAuthMiddlewareOptions(extractors []TokenExtractor, opts []AuthMiddlewareOption, challenge func(w http.ResponseWriter, realm string, err error)) *authMiddlewareOptions {
+	options := &authMiddlewareOptions{extractors: extractors}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(options)
+		}
+	}
+	if options.unauthorized == nil {
+		options.unauthorized = func(w http.ResponseWriter, r *http.Request, err error) {
+			challenge(w, options.realm, err)
+		}
+	}
+	return options
+}
+
+// Returns the first token found by the extractors.
+func extractToken(r *http.Request, extractors []TokenExtractor) string {
+	for _, extractor := range extractors {
+		if token := extractor(r); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
 // DefaultAuthMiddleware is a middleware that provides default authentication logic.
-// It checks for a valid token in the request header and denies access if the token is missing
-func DefaultAuthMiddleware[T jwt.Claims](authenticator *Authenticator[T], logger ILogger, claimsFactory func() T) Middleware {
+// It checks for a valid token in the request and denies access if the token is missing or invalid.
+// The token is verified using the provided verifier, usually an `Authenticator`, and its claims
+// are stored in the request context under AuthTokenKey, together with a `*Principal` under PrincipalKey.
+// Tokens revoked through the RevocationStore of the verifier are rejected as well.
+//
+// By default the token is read from an `Authorization: Bearer` header and then from the session
+// cookie configured on the `Authenticator`, or DefaultSessionCookieName for other verifiers.
+// Use WithTokenExtractors to read it from elsewhere and the other options to change the outcome.
+//
+// Rejected requests get a 401 response with a JSON body in the shape of `WriteErrorToResponse`
+// and a `WWW-Authenticate` header as described in RFC 6750. When the token was invalid the
+// header has the `invalid_token` error code and a description such as "token is expired".
+func DefaultAuthMiddleware[T jwt.Claims](verifier ITokenVerifier[T], logger ILogger, claimsFactory func() T, opts ...AuthMiddlewareOption) Middleware {
+	cookieName := DefaultSessionCookieName
+	if namer, ok := verifier.(sessionCookieNamer); ok {
+		cookieName = namer.SessionCookieName()
+	}
+
+	extractors := []TokenExtractor{BearerTokenExtractor(), CookieTokenExtractor(cookieName)}
+	options := newAuthMiddlewareOptions(extractors, opts, func(w http.ResponseWriter, realm string, err error) {
+		writeUnauthorized(w, "Bearer", realm, err)
+	})
+
+	verify := func(ctx context.Context, token string, claims T) (T, error) {
+		return verifier.VerifyToken(token, claims)
+	}
+	if contextVerifier, ok := verifier.(contextTokenVerifier[T]); ok {
+		verify = contextVerifier.VerifyTokenContext
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Implement default authentication logic here
-			// For example, check for a valid token in the request header
-			token := ""
-
-			authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
-			if authHeader != "" {
-				parts := strings.SplitN(authHeader, " ", 2)
-				if len(parts) == 2 || strings.EqualFold(parts[0], "Bearer") {
-					token = parts[1]
-				}
-			}
+			token := extractToken(r, options.extractors)
 			if token == "" {
-				sessionCookie, err := r.Cookie("session_token")
-				if err != nil || sessionCookie == nil || sessionCookie.Value == "" {
-					// If no token is found, return unauthorized
-					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				if options.allowAnonymous {
+					next.ServeHTTP(w, r)
 					return
 				}
-				token = sessionCookie.Value
+				options.unauthorized(w, r, ErrTokenMissing)
+				return
 			}
 
 			claims := claimsFactory()
-			// Validate the token using the authenticator
-			parsedClaims, err := authenticator.VerifyToken(token, claims)
+			// Validate the token using the verifier
+			parsedClaims, err := verify(r.Context(), token, claims)
 			if err != nil {
 				logger.Errorf("Invalid token: %v", err)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				options.unauthorized(w, r, err)
 				return
 			}
 			authContext := context.WithValue(r.Context(), AuthTokenKey, parsedClaims)
+			authContext = context.WithValue(authContext, PrincipalKey, principalFromClaims(parsedClaims))
 			// If token is valid, proceed to the next handler
 			next.ServeHTTP(w, r.WithContext(authContext))
 		})
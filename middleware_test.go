@@ -0,0 +1,218 @@
+package grove_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testAuthenticator(t *testing.T) *grove.Authenticator[*TestClaims] {
+	t.Helper()
+
+	config := validConfig(t, false)
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+	return auth
+}
+
+// Returns a handler behind DefaultAuthMiddleware that responds with the email of the claims or
+// "anonymous" when there are none.
+func authenticatedHandler(auth *grove.Authenticator[*TestClaims], opts ...grove.AuthMiddlewareOption) http.Handler {
+	middleware := grove.DefaultAuthMiddleware(auth, &testLogger{}, func() *TestClaims { return &TestClaims{} }, opts...)
+	return middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(grove.AuthTokenKey).(*TestClaims)
+		if !ok {
+			_, _ = w.Write([]byte("anonymous"))
+			return
+		}
+		_, _ = w.Write([]byte(claims.Email))
+	}))
+}
+
+func TestDefaultAuthMiddlewareBearerScheme(t *testing.T) {
+	auth := testAuthenticator(t)
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+	handler := authenticatedHandler(auth)
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "bearer", header: "Bearer " + token, want: http.StatusOK},
+		{name: "lowercase scheme", header: "bearer " + token, want: http.StatusOK},
+		{name: "other scheme", header: "Basic " + token, want: http.StatusUnauthorized},
+		{name: "missing token", header: "Bearer", want: http.StatusUnauthorized},
+		{name: "extra parts", header: "Bearer " + token + " extra", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultAuthMiddlewareWithTokenExtractors(t *testing.T) {
+	auth := testAuthenticator(t)
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+	handler := authenticatedHandler(auth, grove.WithTokenExtractors(
+		grove.HeaderTokenExtractor("X-Auth-Token"),
+		grove.QueryTokenExtractor("access_token"),
+	))
+
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		want   int
+	}{
+		{name: "custom header", modify: func(r *http.Request) { r.Header.Set("X-Auth-Token", token) }, want: http.StatusOK},
+		{name: "query parameter", modify: func(r *http.Request) { r.URL.RawQuery = "access_token=" + token }, want: http.StatusOK},
+		{name: "bearer header is not used", modify: func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }, want: http.StatusUnauthorized},
+		{
+			name:   "session cookie is not used",
+			modify: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: grove.DefaultSessionCookieName, Value: token}) },
+			want:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			tt.modify(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultAuthMiddlewareWithAnonymousAccess(t *testing.T) {
+	auth := testAuthenticator(t)
+	handler := authenticatedHandler(auth, grove.WithAnonymousAccess())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "anonymous" {
+		t.Fatalf("status = %d, body = %q; want %d anonymous", rec.Code, rec.Body.String(), http.StatusOK)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status with invalid token = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestDefaultAuthMiddlewareWithUnauthorizedHandler(t *testing.T) {
+	auth := testAuthenticator(t)
+	handler := authenticatedHandler(auth, grove.WithUnauthorizedHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("status = %d, Location = %q; want %d /login", rec.Code, rec.Header().Get("Location"), http.StatusFound)
+	}
+}
+
+func TestDefaultAuthMiddlewareWritesBearerChallenge(t *testing.T) {
+	auth := testAuthenticator(t)
+	handler := authenticatedHandler(auth, grove.WithRealm("grove"))
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name          string
+		token         string
+		wantChallenge string
+		wantError     string
+	}{
+		{
+			name:          "missing token",
+			wantChallenge: `Bearer realm="grove"`,
+			wantError:     "token is missing",
+		},
+		{
+			name:          "expired token",
+			token:         signTestToken(t, expired),
+			wantChallenge: `Bearer realm="grove", error="invalid_token", error_description="token is expired"`,
+			wantError:     "token is expired",
+		},
+		{
+			name:          "malformed token",
+			token:         "not-a-token",
+			wantChallenge: `Bearer realm="grove", error="invalid_token", error_description="token is malformed"`,
+			wantError:     "token is malformed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Fatalf("WWW-Authenticate = %q; want %q", got, tt.wantChallenge)
+			}
+			var body map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode body: %v", err)
+			}
+			if body["error"] != tt.wantError {
+				t.Fatalf("error = %q; want %q", body["error"], tt.wantError)
+			}
+		})
+	}
+}
+
+func TestRequireScopesWritesInsufficientScopeChallenge(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), grove.AuthTokenKey, &RoleClaims{Scope: "orders:read"}))
+	rec := httptest.NewRecorder()
+
+	grove.RequireScopes("orders:read", "orders:write")(http.NotFoundHandler()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusForbidden)
+	}
+	want := `Bearer error="insufficient_scope", scope="orders:read orders:write"`
+	if got := rec.Header().Get("WWW-Authenticate"); got != want {
+		t.Fatalf("WWW-Authenticate = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package grove
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+var (
+	ErrClientCertificateMissing  = errors.New("client certificate is missing")
+	ErrClientCertificateRejected = errors.New("client certificate is not allowed")
+)
+
+// CertificatePrincipalMapper maps a verified client certificate to a principal.
+// Returning an error rejects the request, which is how certificates that were issued by a
+// trusted CA but are not allowed to call the service are turned away.
+type CertificatePrincipalMapper func(cert *x509.Certificate) (*Principal, error)
+
+// CertificateCommonNameMapper uses the common name of the certificate subject as the principal.
+// If allowed is not empty only those common names are accepted.
+func CertificateCommonNameMapper(allowed ...string) CertificatePrincipalMapper {
+	return func(cert *x509.Certificate) (*Principal, error) {
+		name := cert.Subject.CommonName
+		if name == "" || (len(allowed) > 0 && !slices.Contains(allowed, name)) {
+			return nil, fmt.Errorf("%w: %q", ErrClientCertificateRejected, name)
+		}
+		return &Principal{Subject: name, Method: AuthMethodMTLS}, nil
+	}
+}
+
+// CertificateSANMapper uses a subject alternative name of the certificate as the principal.
+// URI SANs, such as SPIFFE IDs, are preferred over DNS names, which are preferred over email
+// addresses. If allowed is not empty the first SAN that is allowed is used and certificates
+// without one are rejected.
+func CertificateSANMapper(allowed ...string) CertificatePrincipalMapper {
+	return func(cert *x509.Certificate) (*Principal, error) {
+		names := make([]string, 0, len(cert.URIs)+len(cert.DNSNames)+len(cert.EmailAddresses))
+		for _, uri := range cert.URIs {
+			names = append(names, uri.String())
+		}
+		names = append(names, cert.DNSNames...)
+		names = append(names, cert.EmailAddresses...)
+
+		for _, name := range names {
+			if len(allowed) == 0 || slices.Contains(allowed, name) {
+				return &Principal{Subject: name, Method: AuthMethodMTLS}, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: no allowed subject alternative name", ErrClientCertificateRejected)
+	}
+}
+
+// Writes the 401 response of `MTLSMiddleware`.
+// There is no HTTP authentication scheme for client certificates, so no challenge is sent.
+func writeMTLSUnauthorized(w http.ResponseWriter, realm string, err error) {
+	WriteErrorToResponse(w, http.StatusUnauthorized, authErrorDescription(err))
+}
+
+// MTLSMiddleware is a middleware that authenticates requests using the client certificate of a
+// mutual TLS connection. The mapper turns the certificate into the principal stored in the
+// request context under PrincipalKey. If the principal has no Method it is set to AuthMethodMTLS.
+//
+// Only certificates verified during the handshake are used, so the server must be configured
+// with a tls.Config whose ClientCAs holds the trusted CAs and whose ClientAuth is
+// tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert. Requests that did not arrive
+// over TLS, such as those forwarded by a proxy that terminates TLS, are rejected.
+//
+// It accepts WithAnonymousAccess and WithUnauthorizedHandler.
+func MTLSMiddleware(mapper CertificatePrincipalMapper, logger ILogger, opts ...AuthMiddlewareOption) Middleware {
+	options := newAuthMiddlewareOptions(nil, opts, writeMTLSUnauthorized)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				if options.allowAnonymous {
+					next.ServeHTTP(w, r)
+					return
+				}
+				options.unauthorized(w, r, ErrClientCertificateMissing)
+				return
+			}
+
+			cert := r.TLS.VerifiedChains[0][0]
+			principal, err := mapper(cert)
+			if err != nil || principal == nil {
+				logger.Errorf("Rejected client certificate %q: %v", cert.Subject.String(), err)
+				options.unauthorized(w, r, ErrClientCertificateRejected)
+				return
+			}
+			if principal.Method == "" {
+				principal.Method = AuthMethodMTLS
+			}
+
+			ctx := context.WithValue(r.Context(), PrincipalKey, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
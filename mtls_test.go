@@ -0,0 +1,118 @@
+package grove_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func clientCertificate(commonName string, uri string, dnsNames ...string) *x509.Certificate {
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}
+	if uri != "" {
+		parsed, _ := url.Parse(uri)
+		cert.URIs = []*url.URL{parsed}
+	}
+	return cert
+}
+
+func serveMTLS(handler http.Handler, cert *x509.Certificate) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "https://service.internal/", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMTLSMiddleware(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := grove.PrincipalFromContext(r.Context())
+		_, _ = w.Write([]byte(principal.Subject + " " + string(principal.Method)))
+	})
+
+	tests := []struct {
+		name     string
+		mapper   grove.CertificatePrincipalMapper
+		cert     *x509.Certificate
+		want     int
+		wantBody string
+	}{
+		{
+			name:     "common name",
+			mapper:   grove.CertificateCommonNameMapper(),
+			cert:     clientCertificate("billing", ""),
+			want:     http.StatusOK,
+			wantBody: "billing mtls",
+		},
+		{
+			name:   "common name not allowed",
+			mapper: grove.CertificateCommonNameMapper("orders"),
+			cert:   clientCertificate("billing", ""),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:     "SPIFFE ID is preferred",
+			mapper:   grove.CertificateSANMapper(),
+			cert:     clientCertificate("billing", "spiffe://cluster.local/ns/default/sa/billing", "billing.internal"),
+			want:     http.StatusOK,
+			wantBody: "spiffe://cluster.local/ns/default/sa/billing mtls",
+		},
+		{
+			name:     "allowed DNS name",
+			mapper:   grove.CertificateSANMapper("billing.internal"),
+			cert:     clientCertificate("billing", "spiffe://cluster.local/ns/default/sa/billing", "billing.internal"),
+			want:     http.StatusOK,
+			wantBody: "billing.internal mtls",
+		},
+		{
+			name:   "no allowed SAN",
+			mapper: grove.CertificateSANMapper("orders.internal"),
+			cert:   clientCertificate("billing", "", "billing.internal"),
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "no client certificate",
+			mapper: grove.CertificateCommonNameMapper(),
+			want:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := grove.MTLSMiddleware(tt.mapper, &testLogger{})(echo)
+			rec := serveMTLS(handler, tt.cert)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Fatalf("body = %q; want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMTLSMiddlewareIgnoresUnverifiedCertificates(t *testing.T) {
+	handler := grove.MTLSMiddleware(grove.CertificateCommonNameMapper(), &testLogger{})(http.NotFoundHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "https://service.internal/", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCertificate("billing", "")}}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,374 @@
+package grove
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const oauthClientSecretSize = 32
+
+var (
+	ErrOAuthClientNotFound = errors.New("OAuth client not found")
+	ErrOAuthClientInvalid  = errors.New("OAuth client authentication failed")
+)
+
+// OAuthClient is a client registered with the token endpoint.
+// Only the SHA-256 hash of the secret is stored. Secrets are generated by
+// `GenerateOAuthClientSecret`, so like API keys they do not need a slow hash.
+type OAuthClient struct {
+	// The client_id the client authenticates with.
+	ID string `json:"id"`
+	// Hex encoded SHA-256 hash of the client secret.
+	SecretHash string `json:"secret_hash"`
+	// The scopes the client may request. A token request without a scope gets all of them.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// IOAuthClientStore looks up the registered OAuth clients.
+type IOAuthClientStore interface {
+	// GetOAuthClient returns the client with the provided ID or ErrOAuthClientNotFound.
+	GetOAuthClient(ctx context.Context, id string) (OAuthClient, error)
+}
+
+// MemoryOAuthClientStore is an in-memory `IOAuthClientStore`.
+// It is safe for concurrent use and is useful for tests and for clients loaded from configuration.
+type MemoryOAuthClientStore struct {
+	mu      sync.RWMutex
+	clients map[string]OAuthClient
+}
+
+// Initializes the MemoryOAuthClientStore with the provided clients.
+func NewMemoryOAuthClientStore(clients ...OAuthClient) *MemoryOAuthClientStore {
+	store := &MemoryOAuthClientStore{clients: make(map[string]OAuthClient, len(clients))}
+	for _, client := range clients {
+		store.clients[client.ID] = client
+	}
+	return store
+}
+
+// GetOAuthClient returns the client with the provided ID.
+func (s *MemoryOAuthClientStore) GetOAuthClient(ctx context.Context, id string) (OAuthClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.clients[id]
+	if !ok {
+		return OAuthClient{}, ErrOAuthClientNotFound
+	}
+	return client, nil
+}
+
+// SaveOAuthClient adds the client or replaces the client with the same ID.
+func (s *MemoryOAuthClientStore) SaveOAuthClient(client OAuthClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clients[client.ID] = client
+}
+
+// DeleteOAuthClient removes the client with the provided ID.
+func (s *MemoryOAuthClientStore) DeleteOAuthClient(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.clients, id)
+}
+
+// GenerateOAuthClientSecret creates a random client secret.
+// It returns the secret, which must be handed to the client and is not stored anywhere, and the
+// hash to store in the SecretHash of the `OAuthClient`.
+func GenerateOAuthClientSecret() (string, string, error) {
+	random := make([]byte, oauthClientSecretSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", fmt.Errorf("an error occurred while generating client secret: %v", err)
+	}
+	secret := hex.EncodeToString(random)
+	return secret, hashOAuthClientSecret(secret), nil
+}
+
+func hashOAuthClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticates the client of a token or introspection request using client_secret_basic or
+// client_secret_post. The boolean reports whether the client used HTTP Basic auth.
+func authenticateOAuthClient(ctx context.Context, store IOAuthClientStore, r *http.Request) (OAuthClient, bool, error) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form encodes the credentials before Basic encoding them.
+		var err error
+		if id, err = url.QueryUnescape(id); err != nil {
+			return OAuthClient{}, true, ErrOAuthClientInvalid
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return OAuthClient{}, true, ErrOAuthClientInvalid
+		}
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id == "" || secret == "" {
+		return OAuthClient{}, basic, ErrOAuthClientInvalid
+	}
+
+	client, err := store.GetOAuthClient(ctx, id)
+	if errors.Is(err, ErrOAuthClientNotFound) {
+		return OAuthClient{}, basic, ErrOAuthClientInvalid
+	}
+	if err != nil {
+		return OAuthClient{}, basic, fmt.Errorf("an error occurred while loading OAuth client: %v", err)
+	}
+
+	want, err := hex.DecodeString(client.SecretHash)
+	if err != nil {
+		return OAuthClient{}, basic, ErrOAuthClientInvalid
+	}
+	got := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(got[:], want) != 1 {
+		return OAuthClient{}, basic, ErrOAuthClientInvalid
+	}
+	return client, basic, nil
+}
+
+// The error response of RFC 6749 section 5.2.
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Writes an OAuth 2.0 error response. Failed client authentication is answered with 401 and a
+// Basic challenge when the client used Basic auth, as required by RFC 6749 section 5.2.
+func writeOAuthError(w http.ResponseWriter, statusCode int, code string, description string, basicChallenge bool) {
+	if basicChallenge {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token", charset="UTF-8"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = WriteJsonBodyToResponse(w, oauthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// The response written by `Authenticator.ClientCredentialsHandler`, see RFC 6749 section 5.1.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// Config used by `Authenticator.ClientCredentialsHandler`.
+type ClientCredentialsConfig[T jwt.Claims] struct {
+	// The registered clients. Required.
+	Clients IOAuthClientStore
+	// Builds the claims of the access token for the client and the granted scopes. The subject
+	// defaults to the client ID and the issuer, audience and lifetime come from the
+	// AuthenticatorConfig. For jwt.MapClaims the `scope` and `client_id` claims are filled in
+	// when they are missing; other claim types have to carry the scopes themselves, for example
+	// by implementing `IScopesClaims`. Required.
+	ClaimsFactory func(r *http.Request, client OAuthClient, scopes []string) (T, error)
+	// Receives errors that are not caused by the client. Optional.
+	Logger ILogger
+}
+
+// Resolves the requested scopes against the scopes of the client.
+// No requested scope grants every scope of the client.
+func grantedScopes(client OAuthClient, requested string) ([]string, bool) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return slices.Clone(client.Scopes), true
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, false
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(scopes))), true
+}
+
+// ClientCredentialsHandler returns an OAuth 2.0 token endpoint for the client credentials grant
+// of RFC 6749 section 4.4, letting Grove issue tokens for service-to-service calls.
+//
+// Clients authenticate with client_secret_basic or client_secret_post and may request a subset
+// of their scopes with the `scope` parameter. Tokens are created with `GenerateToken`, so they
+// are verified like every other token of the Authenticator, and no refresh token is issued.
+// Errors use the response format of RFC 6749 section 5.2.
+func (a *Authenticator[T]) ClientCredentialsHandler(config ClientCredentialsConfig[T]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteErrorToResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if config.Clients == nil || config.ClaimsFactory == nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "token endpoint is not configured", false)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, 4096)
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "request body must be form encoded", false)
+			return
+		}
+
+		client, basic, err := authenticateOAuthClient(r.Context(), config.Clients, r)
+		if err != nil {
+			if !errors.Is(err, ErrOAuthClientInvalid) {
+				if config.Logger != nil {
+					config.Logger.Errorf("Failed to authenticate OAuth client: %v", err)
+				}
+				writeOAuthError(w, http.StatusInternalServerError, "server_error", "", false)
+				return
+			}
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed", basic)
+			return
+		}
+
+		if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+			if grantType == "" {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_request", "grant_type is required", false)
+				return
+			}
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "", false)
+			return
+		}
+
+		scopes, ok := grantedScopes(client, r.PostForm.Get("scope"))
+		if !ok {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "the requested scope is not granted to the client", false)
+			return
+		}
+
+		claims, err := config.ClaimsFactory(r, client, scopes)
+		if err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "", false)
+			return
+		}
+		if mapClaims, ok := any(claims).(jwt.MapClaims); ok {
+			if _, ok := mapClaims["scope"]; !ok && len(scopes) > 0 {
+				mapClaims["scope"] = strings.Join(scopes, " ")
+			}
+			if _, ok := mapClaims["client_id"]; !ok {
+				mapClaims["client_id"] = client.ID
+			}
+			if _, ok := mapClaims["sub"]; !ok {
+				mapClaims["sub"] = client.ID
+			}
+		} else if registered := registeredClaimsOf(claims); registered != nil && registered.Subject == "" {
+			registered.Subject = client.ID
+		}
+
+		accessToken, err := a.GenerateToken(claims)
+		if err != nil {
+			if config.Logger != nil {
+				config.Logger.Errorf("Failed to generate token for OAuth client %q: %v", client.ID, err)
+			}
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "", false)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		_ = WriteJsonBodyToResponse(w, OAuthTokenResponse{
+			AccessToken: accessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(a.Lifetime.Seconds()),
+			Scope:       strings.Join(scopes, " "),
+		})
+	})
+}
+
+// The response written by `Authenticator.IntrospectionHandler`, see RFC 7662 section 2.2.
+// Only Active is set for tokens that are not active.
+type IntrospectionResponse struct {
+	Active    bool             `json:"active"`
+	Scope     string           `json:"scope,omitempty"`
+	ClientID  string           `json:"client_id,omitempty"`
+	TokenType string           `json:"token_type,omitempty"`
+	ExpiresAt int64            `json:"exp,omitempty"`
+	IssuedAt  int64            `json:"iat,omitempty"`
+	NotBefore int64            `json:"nbf,omitempty"`
+	Subject   string           `json:"sub,omitempty"`
+	Audience  jwt.ClaimStrings `json:"aud,omitempty"`
+	Issuer    string           `json:"iss,omitempty"`
+	ID        string           `json:"jti,omitempty"`
+}
+
+// Converts an optional numeric date claim to seconds since the epoch.
+func unixOf(date *jwt.NumericDate, err error) int64 {
+	if err != nil || date == nil {
+		return 0
+	}
+	return date.Unix()
+}
+
+// IntrospectionHandler returns an OAuth 2.0 token introspection endpoint as described in
+// RFC 7662. Callers authenticate as one of the registered clients and send the token in the
+// `token` form parameter. The token is checked with `VerifyToken`, so expired, revoked or
+// foreign tokens are reported as `{"active": false}`.
+// newClaims returns the empty claims the token is parsed into.
+func (a *Authenticator[T]) IntrospectionHandler(clients IOAuthClientStore, newClaims func() T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteErrorToResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if clients == nil || newClaims == nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "introspection endpoint is not configured", false)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, 16384)
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "request body must be form encoded", false)
+			return
+		}
+		if _, basic, err := authenticateOAuthClient(r.Context(), clients, r); err != nil {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed", basic)
+			return
+		}
+
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required", false)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		claims, err := a.VerifyTokenContext(r.Context(), token, newClaims())
+		if err != nil {
+			_ = WriteJsonBodyToResponse(w, IntrospectionResponse{Active: false})
+			return
+		}
+
+		response := IntrospectionResponse{
+			Active:    true,
+			Scope:     strings.Join(scopesOf(claims), " "),
+			TokenType: "Bearer",
+			ExpiresAt: unixOf(claims.GetExpirationTime()),
+			IssuedAt:  unixOf(claims.GetIssuedAt()),
+			NotBefore: unixOf(claims.GetNotBefore()),
+			ID:        tokenIDOf(claims),
+		}
+		response.Subject, _ = claims.GetSubject()
+		response.Issuer, _ = claims.GetIssuer()
+		response.Audience, _ = claims.GetAudience()
+		if mapClaims, ok := any(claims).(jwt.MapClaims); ok {
+			response.ClientID, _ = mapClaims["client_id"].(string)
+		}
+		_ = WriteJsonBodyToResponse(w, response)
+	})
+}
@@ -0,0 +1,151 @@
+package grove_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func oauthTestSetup(t *testing.T) (*grove.Authenticator[jwt.MapClaims], *grove.MemoryOAuthClientStore, string) {
+	t.Helper()
+
+	config := validConfig(t, false)
+	auth, err := grove.NewAuthenticator[jwt.MapClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	secret, hash, err := grove.GenerateOAuthClientSecret()
+	if err != nil {
+		t.Fatalf("GenerateOAuthClientSecret() error = %v; want nil", err)
+	}
+	clients := grove.NewMemoryOAuthClientStore(grove.OAuthClient{ID: "billing", SecretHash: hash, Scopes: []string{"invoices:read", "invoices:write"}})
+	return auth, clients, secret
+}
+
+func postForm(handler http.Handler, form url.Values, configure func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if configure != nil {
+		configure(req)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestClientCredentialsHandler(t *testing.T) {
+	auth, clients, secret := oauthTestSetup(t)
+	handler := auth.ClientCredentialsHandler(grove.ClientCredentialsConfig[jwt.MapClaims]{
+		Clients: clients,
+		ClaimsFactory: func(r *http.Request, client grove.OAuthClient, scopes []string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{}, nil
+		},
+	})
+	basicAuth := func(id string, secret string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(id, secret) }
+	}
+
+	rec := postForm(handler, url.Values{"grant_type": {"client_credentials"}, "scope": {"invoices:read"}}, basicAuth("billing", secret))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("Cache-Control = %q; want no-store", rec.Header().Get("Cache-Control"))
+	}
+
+	var response grove.OAuthTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.TokenType != "Bearer" || response.Scope != "invoices:read" || response.ExpiresIn <= 0 {
+		t.Fatalf("response = %+v; want a bearer token with the requested scope", response)
+	}
+	claims, err := auth.VerifyToken(response.AccessToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if claims["sub"] != "billing" || claims["client_id"] != "billing" || claims["scope"] != "invoices:read" {
+		t.Fatalf("claims = %v; want subject, client_id and scope of the client", claims)
+	}
+
+	rec = postForm(handler, url.Values{"grant_type": {"client_credentials"}, "client_id": {"billing"}, "client_secret": {secret}}, nil)
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.Scope != "invoices:read invoices:write" {
+		t.Fatalf("client_secret_post response = %+v, %v; want all scopes of the client", response, err)
+	}
+
+	tests := []struct {
+		name      string
+		form      url.Values
+		configure func(*http.Request)
+		want      int
+		wantError string
+	}{
+		{name: "wrong secret", form: url.Values{"grant_type": {"client_credentials"}}, configure: basicAuth("billing", "wrong"), want: http.StatusUnauthorized, wantError: "invalid_client"},
+		{name: "unknown client", form: url.Values{"grant_type": {"client_credentials"}, "client_id": {"other"}, "client_secret": {secret}}, want: http.StatusUnauthorized, wantError: "invalid_client"},
+		{name: "missing grant type", form: url.Values{}, configure: basicAuth("billing", secret), want: http.StatusBadRequest, wantError: "invalid_request"},
+		{name: "unsupported grant type", form: url.Values{"grant_type": {"password"}}, configure: basicAuth("billing", secret), want: http.StatusBadRequest, wantError: "unsupported_grant_type"},
+		{name: "scope not granted", form: url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, configure: basicAuth("billing", secret), want: http.StatusBadRequest, wantError: "invalid_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postForm(handler, tt.form, tt.configure)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+			var body map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["error"] != tt.wantError {
+				t.Fatalf("error = %v, %v; want %s", body, err, tt.wantError)
+			}
+		})
+	}
+
+	rec = postForm(handler, url.Values{"grant_type": {"client_credentials"}}, basicAuth("billing", "wrong"))
+	if !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic") {
+		t.Fatalf("WWW-Authenticate = %q; want Basic challenge", rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestIntrospectionHandler(t *testing.T) {
+	auth, clients, secret := oauthTestSetup(t)
+	handler := auth.IntrospectionHandler(clients, func() jwt.MapClaims { return jwt.MapClaims{} })
+	basicAuth := func(r *http.Request) { r.SetBasicAuth("billing", secret) }
+
+	token, err := auth.GenerateToken(jwt.MapClaims{"sub": "billing", "client_id": "billing", "scope": "invoices:read"})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	rec := postForm(handler, url.Values{"token": {token}}, basicAuth)
+	var response grove.IntrospectionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !response.Active || response.Subject != "billing" || response.ClientID != "billing" || response.Scope != "invoices:read" || response.ExpiresAt == 0 || response.Issuer != "Testing" {
+		t.Fatalf("response = %+v; want the active token", response)
+	}
+
+	rec = postForm(handler, url.Values{"token": {"not-a-token"}}, basicAuth)
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"active":false}` {
+		t.Fatalf("body = %s; want {\"active\":false}", body)
+	}
+
+	if rec := postForm(handler, url.Values{"token": {token}}, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := postForm(handler, url.Values{}, basicAuth); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing token status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	unconfigured := auth.IntrospectionHandler(nil, func() jwt.MapClaims { return jwt.MapClaims{} })
+	if rec := postForm(unconfigured, url.Values{"token": {token}}, basicAuth); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("without client store status = %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,529 @@
+package grove
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The name of the cookie that holds the state of a login in progress when none is configured.
+const DefaultOIDCStateCookieName = "grove_oidc_state"
+
+// How long a user has to complete the login at the identity provider.
+const oidcStateLifetime = 10 * time.Minute
+
+// The `typ` header of the signed state stored in the state cookie.
+const oidcStateTokenType = "oidc-state+jwt"
+
+// The audience of the signed state. It differs from the configured Audience so services that
+// accept the access tokens do not accept the state, even if they ignore the `typ` header.
+func (config *AuthenticatorConfig) oidcStateAudience() string {
+	return config.Issuer + "#oidc-state"
+}
+
+var (
+	ErrOIDCStateInvalid = errors.New("OIDC state is invalid")
+	ErrOIDCNonceInvalid = errors.New("OIDC nonce is invalid")
+)
+
+// OIDCProviderMetadata is the part of the OpenID Connect discovery document Grove uses.
+type OIDCProviderMetadata struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	ScopesSupported                  []string `json:"scopes_supported,omitempty"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+// DiscoverOIDCProvider fetches the discovery document of the issuer from
+// `<issuer>/.well-known/openid-configuration`.
+// The issuer in the document must match the requested one, as required by OpenID Connect
+// Discovery section 4.3. If the client is nil a client with a 10 second timeout is used.
+func DiscoverOIDCProvider(ctx context.Context, client *http.Client, issuer string) (*OIDCProviderMetadata, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while creating discovery request: %v", err)
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while fetching discovery document: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code while fetching discovery document: %d", response.StatusCode)
+	}
+
+	var metadata OIDCProviderMetadata
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("an error occurred while parsing discovery document: %v", err)
+	}
+	if metadata.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", metadata.Issuer, issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document is missing the authorization, token or jwks endpoint")
+	}
+	return &metadata, nil
+}
+
+// OIDCIDTokenClaims are the claims of an OpenID Connect ID token.
+// The standard claims Grove knows are exposed as fields and every claim, including custom ones
+// such as groups, is available in Raw.
+type OIDCIDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce,omitempty"`
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	// All claims of the token.
+	Raw map[string]any `json:"-"`
+}
+
+// UnmarshalJSON fills in the known claims and keeps all of them in Raw.
+func (c *OIDCIDTokenClaims) UnmarshalJSON(data []byte) error {
+	type plain OIDCIDTokenClaims
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &c.Raw)
+}
+
+// Config used for the `OIDCRelyingParty`.
+// These values are registered with the identity provider when the client is created.
+type OIDCConfig[T jwt.Claims] struct {
+	// The issuer of the identity provider, for example https://idp.example.com. Required.
+	Issuer string
+	// The client ID registered with the identity provider. Required.
+	ClientID string
+	// The client secret. It is sent using HTTP Basic auth. Public clients leave it empty and
+	// rely on PKCE alone.
+	ClientSecret string
+	// The absolute URL of the callback handler registered with the identity provider. Required.
+	RedirectURL string
+	// The scopes requested in addition to `openid`. Defaults to `profile` and `email`.
+	Scopes []string
+	// Maps the verified ID token to the claims of the token Grove issues. The subject is set to
+	// the `sub` claim of the ID token when it is empty. Returning an error rejects the login.
+	// Required.
+	ClaimsMapper func(r *http.Request, idToken *OIDCIDTokenClaims) (T, error)
+	// Where the user is sent after logging in when the login did not ask for a page. Defaults to "/".
+	PostLoginRedirect string
+	// The name of the cookie that holds the state of a login in progress.
+	// If it is empty DefaultOIDCStateCookieName is used.
+	StateCookieName string
+	// The client used to talk to the identity provider. If nil a client with a 10 second
+	// timeout is used.
+	HTTPClient *http.Client
+	// The discovery document of the identity provider. When it is nil it is fetched from the
+	// issuer by `NewOIDCRelyingParty`.
+	Provider *OIDCProviderMetadata
+}
+
+// Function that validates the OIDCConfig.
+// If any values are missing it will return an error.
+// If it is valid it will return nil.
+func (config *OIDCConfig[T]) Validate() error {
+	if config.Issuer == "" {
+		return fmt.Errorf("issuer is required")
+	}
+	if config.ClientID == "" {
+		return fmt.Errorf("client ID is required")
+	}
+	redirect, err := url.Parse(config.RedirectURL)
+	if err != nil || !redirect.IsAbs() {
+		return fmt.Errorf("redirect URL must be an absolute URL")
+	}
+	if config.ClaimsMapper == nil {
+		return fmt.Errorf("claims mapper is required")
+	}
+	if config.PostLoginRedirect != "" && !isLocalRedirect(config.PostLoginRedirect) {
+		return fmt.Errorf("post login redirect must be a local path")
+	}
+	return nil
+}
+
+func (config *OIDCConfig[T]) scopes() string {
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+	return strings.Join(append([]string{"openid"}, slices.DeleteFunc(slices.Clone(scopes), func(scope string) bool {
+		return scope == "openid"
+	})...), " ")
+}
+
+func (config *OIDCConfig[T]) stateCookieName() string {
+	if config.StateCookieName == "" {
+		return DefaultOIDCStateCookieName
+	}
+	return config.StateCookieName
+}
+
+// OIDCRelyingParty logs users in through an OpenID Connect identity provider using the
+// authorization code flow with PKCE, then issues a token of its `Authenticator` and stores it in
+// the session cookie.
+//
+// The state, nonce and PKCE code verifier of a login in progress are kept in a short lived cookie
+// that is signed, and encrypted when the Authenticator encrypts, with the keys of the
+// Authenticator, so no server side storage is needed.
+type OIDCRelyingParty[T jwt.Claims] struct {
+	authenticator *Authenticator[T]
+	config        *OIDCConfig[T]
+	provider      *OIDCProviderMetadata
+	client        *http.Client
+	verifier      *RemoteJWKSVerifier[*OIDCIDTokenClaims]
+}
+
+// Initializes the OIDCRelyingParty.
+// The configuration is validated and the discovery document is fetched unless it was provided.
+// ID tokens are verified using the JWKS of the provider, must be issued by Issuer and must have
+// the ClientID as audience.
+func NewOIDCRelyingParty[T jwt.Claims](ctx context.Context, authenticator *Authenticator[T], config *OIDCConfig[T]) (*OIDCRelyingParty[T], error) {
+	if authenticator == nil {
+		return nil, fmt.Errorf("Tried to initialize OIDCRelyingParty with nil authenticator.")
+	}
+	if config == nil {
+		return nil, fmt.Errorf("Tried to initialize OIDCRelyingParty with nil configuration.")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	provider := config.Provider
+	if provider == nil {
+		discovered, err := DiscoverOIDCProvider(ctx, client, config.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		provider = discovered
+	}
+
+	verifier, err := NewRemoteJWKSVerifier[*OIDCIDTokenClaims](&RemoteJWKSConfig{
+		URL:        provider.JWKSURI,
+		Issuer:     config.Issuer,
+		Audience:   []string{config.ClientID},
+		Algorithms: provider.IDTokenSigningAlgValuesSupported,
+		HTTPClient: client,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while creating ID token verifier: %v", err)
+	}
+
+	return &OIDCRelyingParty[T]{
+		authenticator: authenticator,
+		config:        config,
+		provider:      provider,
+		client:        client,
+		verifier:      verifier,
+	}, nil
+}
+
+// The claims of the signed state stored in the state cookie.
+type oidcStateClaims struct {
+	jwt.RegisteredClaims
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	ReturnTo     string `json:"return_to,omitempty"`
+}
+
+// Returns a random base64url encoded value with 256 bits of entropy.
+func randomURLSafe() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// Reports whether the redirect stays on the same origin, rejecting absolute and
+// protocol-relative URLs.
+func isLocalRedirect(target string) bool {
+	return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") && !strings.HasPrefix(target, "/\\")
+}
+
+func (rp *OIDCRelyingParty[T]) stateCookie(value string, maxAge int, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     rp.config.stateCookieName(),
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Expires:  expires,
+		Secure:   !rp.authenticator.SessionCookie.Insecure,
+		HttpOnly: true,
+		// The callback is a top-level cross-site navigation, which Lax cookies are sent with.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// AuthCodeURL starts a login and returns the URL of the identity provider to send the user to.
+// It writes the state cookie, which must reach the browser together with the redirect.
+// returnTo is the local path the user is sent to after the login, it is ignored when it is not
+// a local path.
+func (rp *OIDCRelyingParty[T]) AuthCodeURL(w http.ResponseWriter, returnTo string) (string, error) {
+	state, err := randomURLSafe()
+	if err != nil {
+		return "", fmt.Errorf("an error occurred while generating state: %v", err)
+	}
+	nonce, err := randomURLSafe()
+	if err != nil {
+		return "", fmt.Errorf("an error occurred while generating nonce: %v", err)
+	}
+	codeVerifier, err := randomURLSafe()
+	if err != nil {
+		return "", fmt.Errorf("an error occurred while generating code verifier: %v", err)
+	}
+	if !isLocalRedirect(returnTo) {
+		returnTo = ""
+	}
+
+	expires := rp.authenticator.now().Add(oidcStateLifetime)
+	signedState, err := rp.authenticator.generateToken(&oidcStateClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{rp.authenticator.oidcStateAudience()},
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ReturnTo:     returnTo,
+	}, oidcStateTokenType)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, rp.stateCookie(signedState, int(oidcStateLifetime.Seconds()), expires))
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.config.ClientID},
+		"redirect_uri":          {rp.config.RedirectURL},
+		"scope":                 {rp.config.scopes()},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(rp.provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return rp.provider.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// LoginHandler returns a handler that redirects the user to the identity provider.
+// The optional `return_to` query parameter is the local path the user lands on after the login.
+func (rp *OIDCRelyingParty[T]) LoginHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, err := rp.AuthCodeURL(w, r.URL.Query().Get("return_to"))
+		if err != nil {
+			WriteErrorToResponse(w, http.StatusInternalServerError, "failed to start login")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+}
+
+// Reads and verifies the state cookie and compares it with the state returned by the provider.
+func (rp *OIDCRelyingParty[T]) readState(r *http.Request) (*oidcStateClaims, error) {
+	cookie, err := r.Cookie(rp.config.stateCookieName())
+	if err != nil || cookie.Value == "" {
+		return nil, fmt.Errorf("%w: state cookie is missing", ErrOIDCStateInvalid)
+	}
+
+	claims := &oidcStateClaims{}
+	parsedToken, err := rp.authenticator.verifyToken(r.Context(), cookie.Value, claims, []string{rp.authenticator.oidcStateAudience()})
+	if parsedToken != nil && !strings.EqualFold(tokenTypeOf(parsedToken), oidcStateTokenType) {
+		return nil, fmt.Errorf("%w: state cookie is not an OIDC state", ErrOIDCStateInvalid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCStateInvalid, err)
+	}
+
+	state := r.URL.Query().Get("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(claims.State)) != 1 {
+		return nil, fmt.Errorf("%w: state does not match", ErrOIDCStateInvalid)
+	}
+	return claims, nil
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+}
+
+// Exchange redeems the authorization code at the token endpoint, sending the PKCE code verifier.
+// It returns the raw ID token.
+func (rp *OIDCRelyingParty[T]) Exchange(ctx context.Context, code string, codeVerifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {rp.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if rp.config.ClientSecret == "" {
+		form.Set("client_id", rp.config.ClientID)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, rp.provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("an error occurred while creating token request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if rp.config.ClientSecret != "" {
+		// RFC 6749 section 2.3.1 requires the credentials to be form encoded first.
+		request.SetBasicAuth(url.QueryEscape(rp.config.ClientID), url.QueryEscape(rp.config.ClientSecret))
+	}
+
+	response, err := rp.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("an error occurred while exchanging code: %v", err)
+	}
+	defer response.Body.Close()
+
+	var body oidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("an error occurred while parsing token response: %v", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s", response.StatusCode, body.Error)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("token response does not contain an ID token")
+	}
+	return body.IDToken, nil
+}
+
+// VerifyIDToken verifies the signature, issuer, audience and expiration of the ID token and
+// checks that it carries the nonce of the login.
+func (rp *OIDCRelyingParty[T]) VerifyIDToken(idToken string, nonce string) (*OIDCIDTokenClaims, error) {
+	claims, err := rp.verifier.VerifyToken(idToken, &OIDCIDTokenClaims{})
+	if err != nil {
+		return nil, err
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrOIDCNonceInvalid
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != rp.config.ClientID {
+		return nil, fmt.Errorf("%w: azp does not match the client ID", ErrTokenInvalidAudience)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: ID token is missing the sub claim", ErrTokenInvalidClaims)
+	}
+	return claims, nil
+}
+
+// CallbackHandler returns the handler of the RedirectURL.
+// It checks the state, exchanges the code, verifies the ID token and its nonce and maps it to
+// the claims of the Authenticator with the ClaimsMapper. The resulting token is written to the
+// session cookie and the user is redirected to the page the login was started for or
+// PostLoginRedirect.
+//
+// Errors returned by the identity provider and failed checks get a 400 or 401 response with a
+// JSON body in the shape of `WriteErrorToResponse`. Their cause is logged to the logger, which
+// can be nil to not log them.
+func (rp *OIDCRelyingParty[T]) CallbackHandler(logger ILogger) http.Handler {
+	logError := func(format string, v ...any) {
+		if logger != nil {
+			logger.Errorf(format, v...)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The state is single use, whatever the outcome.
+		http.SetCookie(w, rp.stateCookie("", -1, time.Unix(0, 0)))
+		w.Header().Set("Cache-Control", "no-store")
+
+		query := r.URL.Query()
+		if providerError := query.Get("error"); providerError != "" {
+			logError("Identity provider rejected the login: %s %s", providerError, query.Get("error_description"))
+			WriteErrorToResponse(w, http.StatusBadRequest, "login was rejected by the identity provider")
+			return
+		}
+
+		state, err := rp.readState(r)
+		if err != nil {
+			logError("Invalid OIDC callback: %v", err)
+			WriteErrorToResponse(w, http.StatusBadRequest, ErrOIDCStateInvalid.Error())
+			return
+		}
+		code := query.Get("code")
+		if code == "" {
+			WriteErrorToResponse(w, http.StatusBadRequest, "code is required")
+			return
+		}
+
+		idToken, err := rp.Exchange(r.Context(), code, state.CodeVerifier)
+		if err != nil {
+			logError("Failed to exchange OIDC code: %v", err)
+			WriteErrorToResponse(w, http.StatusUnauthorized, "failed to exchange code")
+			return
+		}
+		idClaims, err := rp.VerifyIDToken(idToken, state.Nonce)
+		if err != nil {
+			logError("Invalid ID token: %v", err)
+			WriteErrorToResponse(w, http.StatusUnauthorized, "invalid ID token")
+			return
+		}
+
+		claims, err := rp.config.ClaimsMapper(r, idClaims)
+		if err != nil {
+			logError("Rejected OIDC login of %q: %v", idClaims.Subject, err)
+			WriteErrorToResponse(w, http.StatusUnauthorized, "user cannot sign in")
+			return
+		}
+		if registered := registeredClaimsOf(claims); registered != nil && registered.Subject == "" {
+			registered.Subject = idClaims.Subject
+		}
+
+		token, err := rp.authenticator.GenerateToken(claims)
+		if err != nil {
+			logError("Failed to generate token: %v", err)
+			WriteErrorToResponse(w, http.StatusInternalServerError, "failed to generate access token")
+			return
+		}
+		rp.authenticator.SetSessionCookie(w, token)
+
+		target := state.ReturnTo
+		if target == "" {
+			target = rp.config.PostLoginRedirect
+		}
+		if target == "" {
+			target = "/"
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+}
@@ -0,0 +1,293 @@
+package grove_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a minimal OpenID Connect provider. It hands out one code per authorization request
+// and checks the PKCE code verifier when the code is redeemed.
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]mockAuthorization
+	nonce  string // overrides the nonce of issued ID tokens when set
+	issuer string // overrides the issuer of issued ID tokens when set
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+	subject   string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	idp := &mockIdP{key: testRSAKey(t), codes: make(map[string]mockAuthorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = grove.WriteJsonBodyToResponse(w, grove.OIDCProviderMetadata{
+			Issuer:                           idp.URL,
+			AuthorizationEndpoint:            idp.URL + "/authorize",
+			TokenEndpoint:                    idp.URL + "/token",
+			JWKSURI:                          idp.URL + "/jwks",
+			IDTokenSigningAlgValuesSupported: []string{"RS256"},
+			CodeChallengeMethodsSupported:    []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = grove.WriteJsonBodyToResponse(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &idp.key.PublicKey, KeyID: "idp", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "grove" || clientSecret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = grove.WriteJsonBodyToResponse(w, map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		idp.mu.Lock()
+		authorization, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		nonce, issuer := idp.nonce, idp.issuer
+		idp.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != authorization.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = grove.WriteJsonBodyToResponse(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		if nonce == "" {
+			nonce = authorization.nonce
+		}
+		if issuer == "" {
+			issuer = idp.URL
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            issuer,
+			"sub":            authorization.subject,
+			"aud":            "grove",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          nonce,
+			"email":          authorization.subject + "@example.com",
+			"email_verified": true,
+			"groups":         []string{"engineering"},
+		})
+		token.Header["kid"] = "idp"
+		idToken, _ := token.SignedString(idp.key)
+		_ = grove.WriteJsonBodyToResponse(w, map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// Simulates the user approving the authorization request and returns the callback URL the
+// provider redirects back to.
+func (idp *mockIdP) authorize(t *testing.T, authURL string, subject string) string {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("failed to parse authorization URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || !strings.HasPrefix(query.Get("scope"), "openid") {
+		t.Fatalf("authorization URL = %s; want code flow with PKCE and the openid scope", authURL)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := "code-" + subject
+	idp.codes[code] = mockAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), subject: subject}
+	return query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+}
+
+func newRelyingParty(t *testing.T, idp *mockIdP, auth *grove.Authenticator[*TestClaims]) *grove.OIDCRelyingParty[*TestClaims] {
+	t.Helper()
+
+	rp, err := grove.NewOIDCRelyingParty(context.Background(), auth, &grove.OIDCConfig[*TestClaims]{
+		Issuer:       idp.URL,
+		ClientID:     "grove",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://app.example.com/callback",
+		ClaimsMapper: func(r *http.Request, idToken *grove.OIDCIDTokenClaims) (*TestClaims, error) {
+			if groups, _ := idToken.Raw["groups"].([]any); len(groups) != 1 || groups[0] != "engineering" {
+				t.Errorf("Raw groups = %v; want [engineering]", idToken.Raw["groups"])
+			}
+			return &TestClaims{Email: idToken.Email, RegisteredClaims: &jwt.RegisteredClaims{}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCRelyingParty() error = %v; want nil", err)
+	}
+	return rp
+}
+
+// Runs the login and the callback with the cookies of the login response and returns the
+// callback response.
+func runOIDCLogin(t *testing.T, idp *mockIdP, rp *grove.OIDCRelyingParty[*TestClaims], returnTo string, tamper func(callback string) string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	rp.LoginHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login?return_to="+url.QueryEscape(returnTo), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d; want %d", rec.Code, http.StatusFound)
+	}
+
+	callback := idp.authorize(t, rec.Header().Get("Location"), "alice")
+	if tamper != nil {
+		callback = tamper(callback)
+	}
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	rp.CallbackHandler(&testLogger{}).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOIDCRelyingPartyLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	auth := testAuthenticator(t)
+	rp := newRelyingParty(t, idp, auth)
+
+	rec := runOIDCLogin(t, idp, rp, "/dashboard", nil)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/dashboard" {
+		t.Fatalf("callback = %d %q; want redirect to /dashboard", rec.Code, rec.Header().Get("Location"))
+	}
+
+	var session *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == auth.SessionCookieName() {
+			session = cookie
+		}
+	}
+	if session == nil {
+		t.Fatalf("callback did not set the session cookie")
+	}
+	claims, err := auth.VerifyToken(session.Value, &TestClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" {
+		t.Fatalf("claims = %+v; want subject and email from the ID token", claims)
+	}
+
+	if rec := runOIDCLogin(t, idp, rp, "https://evil.example.com", nil); rec.Header().Get("Location") != "/" {
+		t.Fatalf("Location = %q; want / for a foreign return_to", rec.Header().Get("Location"))
+	}
+}
+
+func TestOIDCRelyingPartyRejectsInvalidCallbacks(t *testing.T) {
+	idp := newMockIdP(t)
+	auth := testAuthenticator(t)
+	rp := newRelyingParty(t, idp, auth)
+
+	replaceQuery := func(key string, value string) func(string) string {
+		return func(callback string) string {
+			parsed, _ := url.Parse(callback)
+			query := parsed.Query()
+			query.Set(key, value)
+			parsed.RawQuery = query.Encode()
+			return parsed.String()
+		}
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(string) string
+		setup  func()
+		want   int
+	}{
+		{name: "wrong state", tamper: replaceQuery("state", "forged"), want: http.StatusBadRequest},
+		{name: "provider error", tamper: replaceQuery("error", "access_denied"), want: http.StatusBadRequest},
+		{name: "unknown code", tamper: replaceQuery("code", "stolen"), want: http.StatusUnauthorized},
+		{name: "wrong nonce", setup: func() { idp.nonce = "replayed" }, want: http.StatusUnauthorized},
+		{name: "wrong issuer", setup: func() { idp.nonce, idp.issuer = "", "https://other.example.com" }, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				idp.mu.Lock()
+				tt.setup()
+				idp.mu.Unlock()
+			}
+			if rec := runOIDCLogin(t, idp, rp, "", tt.tamper); rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/callback?code=code-alice&state=missing-cookie", nil)
+	rec := httptest.NewRecorder()
+	rp.CallbackHandler(&testLogger{}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("callback without state cookie status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	rp.CallbackHandler(nil).ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("callback without logger status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOIDCStateCookieIsNotAnAccessToken(t *testing.T) {
+	idp := newMockIdP(t)
+	auth := testAuthenticator(t)
+	rp := newRelyingParty(t, idp, auth)
+
+	rec := httptest.NewRecorder()
+	if _, err := rp.AuthCodeURL(rec, "/"); err != nil {
+		t.Fatalf("AuthCodeURL() error = %v; want nil", err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %v; want one HttpOnly state cookie", cookies)
+	}
+	if _, err := auth.VerifyToken(cookies[0].Value, &TestClaims{}); err == nil {
+		t.Fatalf("VerifyToken() with state cookie error = nil; want error")
+	}
+
+	// A service that shares the key but does not know about the `typ` header.
+	keyFunc := func(*jwt.Token) (any, error) { return []byte("secret"), nil }
+	if _, err := jwt.Parse(cookies[0].Value, keyFunc, jwt.WithIssuer("Testing"), jwt.WithAudience("testing")); !errors.Is(err, jwt.ErrTokenInvalidAudience) {
+		t.Fatalf("Parse() with the access token audience error = %v; want ErrTokenInvalidAudience", err)
+	}
+}
+
+func TestDiscoverOIDCProviderRejectsIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+
+	if _, err := grove.DiscoverOIDCProvider(context.Background(), nil, idp.URL); err != nil {
+		t.Fatalf("DiscoverOIDCProvider() error = %v; want nil", err)
+	}
+	if _, err := grove.DiscoverOIDCProvider(context.Background(), nil, idp.URL+"/"); err == nil {
+		t.Fatalf("DiscoverOIDCProvider() with different issuer error = nil; want error")
+	}
+}
@@ -0,0 +1,208 @@
+package grove
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch        = errors.New("password does not match")
+	ErrUnsupportedPasswordHash = errors.New("unsupported password hash")
+)
+
+// IPasswordHasher hashes passwords for storage and verifies them on login.
+type IPasswordHasher interface {
+	// HashPassword returns the encoded hash of the password, including its algorithm, salt and
+	// parameters.
+	HashPassword(password string) (string, error)
+	// VerifyPassword checks the password against an encoded hash in constant time.
+	// It returns ErrPasswordMismatch if the password is wrong. needsRehash is true when the hash
+	// was created with another algorithm or other parameters than the hasher uses, in which case
+	// the password should be hashed again and the stored hash replaced.
+	VerifyPassword(password string, encoded string) (needsRehash bool, err error)
+}
+
+// Argon2idHasher hashes passwords with argon2id, the algorithm recommended by OWASP.
+// Hashes are encoded in the PHC string format, e.g. `$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>`.
+// It can also verify bcrypt hashes, which are reported as needing a rehash, so applications
+// can migrate from bcrypt as users log in.
+type Argon2idHasher struct {
+	// Memory used in KiB.
+	Memory uint32
+	// Number of passes over the memory.
+	Iterations uint32
+	// Number of threads used.
+	Parallelism uint8
+	// Length of the random salt in bytes.
+	SaltLength uint32
+	// Length of the derived key in bytes.
+	KeyLength uint32
+}
+
+// Initializes an Argon2idHasher with the minimum parameters recommended by OWASP:
+// 19 MiB of memory, 2 iterations and a parallelism of 1.
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// HashPassword hashes the password with a random salt.
+func (h *Argon2idHasher) HashPassword(password string) (string, error) {
+	if h.Memory == 0 || h.Iterations == 0 || h.Parallelism == 0 || h.SaltLength == 0 || h.KeyLength == 0 {
+		return "", fmt.Errorf("argon2id parameters must be greater than zero")
+	}
+
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("an error occurred while generating salt: %v", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Iterations,
+		h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword checks the password against an argon2id or bcrypt hash.
+func (h *Argon2idHasher) VerifyPassword(password string, encoded string) (bool, error) {
+	if isBcryptHash(encoded) {
+		if err := verifyBcrypt(password, encoded); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	derived := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return false, ErrPasswordMismatch
+	}
+
+	needsRehash := params.Memory != h.Memory ||
+		params.Iterations != h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		uint32(len(salt)) != h.SaltLength ||
+		uint32(len(key)) != h.KeyLength
+	return needsRehash, nil
+}
+
+// Parses a PHC encoded argon2id hash.
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	// The leading $ produces an empty first part.
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return Argon2idHasher{}, nil, nil, ErrUnsupportedPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: argon2 version %q", ErrUnsupportedPasswordHash, parts[2])
+	}
+
+	var params Argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: invalid argon2id parameters", ErrUnsupportedPasswordHash)
+	}
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: invalid argon2id parameters", ErrUnsupportedPasswordHash)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: invalid argon2id salt", ErrUnsupportedPasswordHash)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: invalid argon2id hash", ErrUnsupportedPasswordHash)
+	}
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt.
+// bcrypt only uses the first 72 bytes of a password, so longer passwords are rejected instead of
+// being silently truncated. It can also verify argon2id hashes, which are reported as needing a
+// rehash.
+type BcryptHasher struct {
+	// The cost of the hash. If it is zero bcrypt.DefaultCost is used.
+	Cost int
+}
+
+// Initializes a BcryptHasher with the provided cost.
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+func (h *BcryptHasher) cost() int {
+	if h.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.Cost
+}
+
+// HashPassword hashes the password with a random salt.
+func (h *BcryptHasher) HashPassword(password string) (string, error) {
+	if len(password) > 72 {
+		return "", fmt.Errorf("password is longer than the 72 bytes bcrypt supports")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
+	if err != nil {
+		return "", fmt.Errorf("an error occurred while hashing password: %v", err)
+	}
+	return string(hash), nil
+}
+
+// VerifyPassword checks the password against a bcrypt or argon2id hash.
+func (h *BcryptHasher) VerifyPassword(password string, encoded string) (bool, error) {
+	if !isBcryptHash(encoded) {
+		if _, err := NewArgon2idHasher().VerifyPassword(password, encoded); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if err := verifyBcrypt(password, encoded); err != nil {
+		return false, err
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnsupportedPasswordHash, err)
+	}
+	return cost != h.cost(), nil
+}
+
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Compares the password with a bcrypt hash. bcrypt compares in constant time.
+func verifyBcrypt(password string, encoded string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupportedPasswordHash, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package grove_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap argon2id parameters so the tests stay fast.
+func testArgon2idHasher() *grove.Argon2idHasher {
+	return &grove.Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := testArgon2idHasher()
+
+	encoded, err := hasher.HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v; want nil", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("HashPassword() = %q; want PHC encoded argon2id hash", encoded)
+	}
+	if again, _ := hasher.HashPassword("correct horse"); again == encoded {
+		t.Fatalf("HashPassword() returned the same hash twice; want a random salt")
+	}
+
+	needsRehash, err := hasher.VerifyPassword("correct horse", encoded)
+	if err != nil || needsRehash {
+		t.Fatalf("VerifyPassword() = %v, %v; want false, nil", needsRehash, err)
+	}
+	if _, err := hasher.VerifyPassword("wrong horse", encoded); !errors.Is(err, grove.ErrPasswordMismatch) {
+		t.Fatalf("VerifyPassword() with wrong password error = %v; want ErrPasswordMismatch", err)
+	}
+
+	stronger := testArgon2idHasher()
+	stronger.Iterations = 2
+	needsRehash, err = stronger.VerifyPassword("correct horse", encoded)
+	if err != nil || !needsRehash {
+		t.Fatalf("VerifyPassword() with changed parameters = %v, %v; want true, nil", needsRehash, err)
+	}
+}
+
+func TestArgon2idHasherWithInvalidHashShouldFail(t *testing.T) {
+	hasher := testArgon2idHasher()
+
+	tests := []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+	}
+
+	for _, encoded := range tests {
+		if _, err := hasher.VerifyPassword("password", encoded); !errors.Is(err, grove.ErrUnsupportedPasswordHash) {
+			t.Errorf("VerifyPassword(%q) error = %v; want ErrUnsupportedPasswordHash", encoded, err)
+		}
+	}
+}
+
+func TestBcryptHasher(t *testing.T) {
+	hasher := grove.NewBcryptHasher(bcrypt.MinCost)
+
+	encoded, err := hasher.HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v; want nil", err)
+	}
+
+	needsRehash, err := hasher.VerifyPassword("correct horse", encoded)
+	if err != nil || needsRehash {
+		t.Fatalf("VerifyPassword() = %v, %v; want false, nil", needsRehash, err)
+	}
+	if _, err := hasher.VerifyPassword("wrong horse", encoded); !errors.Is(err, grove.ErrPasswordMismatch) {
+		t.Fatalf("VerifyPassword() with wrong password error = %v; want ErrPasswordMismatch", err)
+	}
+	if needsRehash, _ := grove.NewBcryptHasher(bcrypt.MinCost+1).VerifyPassword("correct horse", encoded); !needsRehash {
+		t.Fatalf("VerifyPassword() with changed cost needsRehash = false; want true")
+	}
+
+	if _, err := hasher.HashPassword(strings.Repeat("a", 73)); err == nil {
+		t.Fatalf("HashPassword() with 73 byte password error = nil; want error")
+	}
+}
+
+func TestHashersMigrateBetweenAlgorithms(t *testing.T) {
+	argon := testArgon2idHasher()
+	bcryptHasher := grove.NewBcryptHasher(bcrypt.MinCost)
+
+	bcryptHash, _ := bcryptHasher.HashPassword("correct horse")
+	needsRehash, err := argon.VerifyPassword("correct horse", bcryptHash)
+	if err != nil || !needsRehash {
+		t.Fatalf("argon2id VerifyPassword() of bcrypt hash = %v, %v; want true, nil", needsRehash, err)
+	}
+
+	argonHash, _ := argon.HashPassword("correct horse")
+	needsRehash, err = bcryptHasher.VerifyPassword("correct horse", argonHash)
+	if err != nil || !needsRehash {
+		t.Fatalf("bcrypt VerifyPassword() of argon2id hash = %v, %v; want true, nil", needsRehash, err)
+	}
+}
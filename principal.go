@@ -0,0 +1,65 @@
+package grove
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AuthMethod names the way a `Principal` was authenticated.
+type AuthMethod string
+
+const (
+	AuthMethodJWT    AuthMethod = "jwt"
+	AuthMethodAPIKey AuthMethod = "api_key"
+	AuthMethodBasic  AuthMethod = "basic"
+	AuthMethodMTLS   AuthMethod = "mtls"
+)
+
+type principalKeyType struct{}
+
+// Key that should be used to pull the `*Principal` from the request context.
+// Every authentication middleware provided by Grove stores one, so handlers and the authorization
+// middleware can work with the caller regardless of how it authenticated.
+var PrincipalKey = principalKeyType{}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Identifies the caller, such as the `sub` claim of a JWT, the owner of an API key, the
+	// username of Basic auth or the identity in a client certificate.
+	Subject string
+	// How the caller authenticated.
+	Method AuthMethod
+	// The roles granted to the caller.
+	Roles []string
+	// The scopes granted to the caller.
+	Scopes []string
+}
+
+// GetRoles returns the roles of the principal so it can be used with `RequireRoles`.
+func (p *Principal) GetRoles() []string {
+	return p.Roles
+}
+
+// GetScopes returns the scopes of the principal so it can be used with `RequireScopes`.
+func (p *Principal) GetScopes() []string {
+	return p.Scopes
+}
+
+// PrincipalFromContext returns the principal stored under PrincipalKey.
+// The boolean is false if the request was not authenticated.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(PrincipalKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// Builds the principal of a request authenticated with a JWT.
+func principalFromClaims(claims jwt.Claims) *Principal {
+	subject, _ := claims.GetSubject()
+	return &Principal{
+		Subject: subject,
+		Method:  AuthMethodJWT,
+		Roles:   rolesOf(claims),
+		Scopes:  scopesOf(claims),
+	}
+}
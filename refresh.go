@@ -0,0 +1,353 @@
+package grove
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The refresh token lifetime used when AuthenticatorConfig.RefreshTokenLifetime is not set.
+const DefaultRefreshTokenLifetime = 14 * 24 * time.Hour
+
+// The number of random bytes in a refresh token.
+const refreshTokenSize = 32
+
+var (
+	ErrRefreshTokenNotFound  = errors.New("refresh token not found")
+	ErrRefreshTokenExpired   = errors.New("refresh token expired")
+	ErrRefreshTokenReused    = errors.New("refresh token was already used")
+	ErrRefreshTokenRevoked   = errors.New("refresh token was revoked")
+	ErrRefreshTokenMalformed = errors.New("refresh token is malformed")
+	ErrRefreshTokensDisabled = errors.New("no refresh token store is configured")
+)
+
+// RefreshToken is the record a store keeps for an issued refresh token.
+// The token itself is opaque and only its SHA-256 hash is stored, so a leaked store cannot be
+// used to refresh sessions.
+//
+// Every token created by rotating a refresh token belongs to the same family as the token
+// it replaced. When a token that was already used is presented again the whole family is
+// revoked, because either the legitimate client or an attacker holds a stolen copy.
+type RefreshToken struct {
+	// Hex encoded SHA-256 hash of the token.
+	Hash string
+	// Identifies every token that descends from the same login.
+	FamilyID string
+	// The subject the token was issued for.
+	Subject   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// The time the token was exchanged for a new one. It is zero while the token is unused.
+	UsedAt time.Time
+}
+
+// IRefreshTokenStore persists refresh tokens.
+// Implementations must make Consume atomic so a token can only be exchanged once, even when it
+// is presented by concurrent requests.
+type IRefreshTokenStore interface {
+	// Save stores a newly issued refresh token.
+	Save(ctx context.Context, token RefreshToken) error
+	// Consume marks the token with the provided hash as used and returns it.
+	// It returns ErrRefreshTokenNotFound if the token does not exist, ErrRefreshTokenRevoked if its
+	// family was revoked, and ErrRefreshTokenReused, together with the token, if it was already used.
+	// A token that expired before usedAt is not marked as used and ErrRefreshTokenExpired is
+	// returned together with it, so retrying it is not mistaken for reuse.
+	Consume(ctx context.Context, hash string, usedAt time.Time) (RefreshToken, error)
+	// RevokeFamily revokes every token of the family, used or not.
+	RevokeFamily(ctx context.Context, familyID string) error
+	// RevokeSubject revokes every token issued for the subject.
+	RevokeSubject(ctx context.Context, subject string) error
+}
+
+// MemoryRefreshTokenStore is an in-memory `IRefreshTokenStore`.
+// It is safe for concurrent use but its tokens are lost on restart and are not shared
+// between instances, so it is best suited to tests and single instance applications.
+// Expired tokens are removed whenever a token is saved.
+type MemoryRefreshTokenStore struct {
+	mu      sync.Mutex
+	tokens  map[string]RefreshToken
+	revoked map[string]time.Time
+}
+
+// Initializes the MemoryRefreshTokenStore.
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		tokens:  make(map[string]RefreshToken),
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Save stores the token and removes the tokens that expired before it was issued.
+func (s *MemoryRefreshTokenStore) Save(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := token.IssuedAt
+	for hash, existing := range s.tokens {
+		if now.After(existing.ExpiresAt) {
+			delete(s.tokens, hash)
+		}
+	}
+	for family, expiresAt := range s.revoked {
+		if now.After(expiresAt) {
+			delete(s.revoked, family)
+		}
+	}
+
+	s.tokens[token.Hash] = token
+	return nil
+}
+
+// Consume marks the token as used and returns it.
+func (s *MemoryRefreshTokenStore) Consume(ctx context.Context, hash string, usedAt time.Time) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if _, revoked := s.revoked[token.FamilyID]; revoked {
+		return token, ErrRefreshTokenRevoked
+	}
+	if !token.UsedAt.IsZero() {
+		return token, ErrRefreshTokenReused
+	}
+	if usedAt.After(token.ExpiresAt) {
+		return token, ErrRefreshTokenExpired
+	}
+
+	token.UsedAt = usedAt
+	s.tokens[hash] = token
+	return token, nil
+}
+
+// RevokeFamily revokes every token of the family.
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeFamily(familyID)
+	return nil
+}
+
+// RevokeSubject revokes every token issued for the subject.
+func (s *MemoryRefreshTokenStore) RevokeSubject(ctx context.Context, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.tokens {
+		if token.Subject == subject {
+			s.revokeFamily(token.FamilyID)
+		}
+	}
+	return nil
+}
+
+// Must be called while holding the mutex.
+// The family is remembered until its last token expires.
+func (s *MemoryRefreshTokenStore) revokeFamily(familyID string) {
+	var expiresAt time.Time
+	for _, token := range s.tokens {
+		if token.FamilyID == familyID && token.ExpiresAt.After(expiresAt) {
+			expiresAt = token.ExpiresAt
+		}
+	}
+	s.revoked[familyID] = expiresAt
+}
+
+// Returns the hex encoded SHA-256 hash a refresh token is stored under.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (config *AuthenticatorConfig) refreshTokenLifetime() time.Duration {
+	if config.RefreshTokenLifetime <= 0 {
+		return DefaultRefreshTokenLifetime
+	}
+	return config.RefreshTokenLifetime
+}
+
+// Creates, stores and returns a refresh token for the subject in the provided family.
+func (a *Authenticator[T]) newRefreshToken(ctx context.Context, subject string, familyID string) (string, error) {
+	if a.RefreshTokenStore == nil {
+		return "", ErrRefreshTokensDisabled
+	}
+
+	random := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("an error occurred while generating refresh token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+
+	now := a.now()
+	err := a.RefreshTokenStore.Save(ctx, RefreshToken{
+		Hash:      hashRefreshToken(token),
+		FamilyID:  familyID,
+		Subject:   subject,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(a.refreshTokenLifetime()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("an error occurred while saving refresh token: %v", err)
+	}
+	return token, nil
+}
+
+// IssueRefreshToken creates a long-lived opaque refresh token for the subject.
+// It starts a new token family and should be called when the user logs in.
+// It requires AuthenticatorConfig.RefreshTokenStore to be set.
+func (a *Authenticator[T]) IssueRefreshToken(ctx context.Context, subject string) (string, error) {
+	if subject == "" {
+		return "", fmt.Errorf("subject is required to issue a refresh token")
+	}
+	return a.newRefreshToken(ctx, subject, uuid.NewString())
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one of the same family.
+// Every refresh token can only be used once. Presenting a token that was already used revokes
+// its whole family and returns ErrRefreshTokenReused.
+// It returns the new token together with the record of the token that was consumed, whose
+// Subject identifies the user the new access token should be issued for.
+func (a *Authenticator[T]) RotateRefreshToken(ctx context.Context, token string) (string, RefreshToken, error) {
+	if a.RefreshTokenStore == nil {
+		return "", RefreshToken{}, ErrRefreshTokensDisabled
+	}
+	if decoded, err := base64.RawURLEncoding.DecodeString(token); err != nil || len(decoded) != refreshTokenSize {
+		return "", RefreshToken{}, ErrRefreshTokenMalformed
+	}
+
+	now := a.now()
+	consumed, err := a.RefreshTokenStore.Consume(ctx, hashRefreshToken(token), now)
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if revokeErr := a.RefreshTokenStore.RevokeFamily(ctx, consumed.FamilyID); revokeErr != nil {
+			return "", RefreshToken{}, fmt.Errorf("an error occurred while revoking reused refresh token family: %v", revokeErr)
+		}
+		return "", RefreshToken{}, err
+	}
+	if err != nil {
+		return "", RefreshToken{}, err
+	}
+	if now.After(consumed.ExpiresAt) {
+		return "", RefreshToken{}, ErrRefreshTokenExpired
+	}
+
+	next, err := a.newRefreshToken(ctx, consumed.Subject, consumed.FamilyID)
+	if err != nil {
+		return "", RefreshToken{}, err
+	}
+	return next, consumed, nil
+}
+
+// RevokeRefreshToken revokes the family of the provided refresh token.
+// Revoking a token that does not exist is not an error.
+func (a *Authenticator[T]) RevokeRefreshToken(ctx context.Context, token string) error {
+	if a.RefreshTokenStore == nil {
+		return ErrRefreshTokensDisabled
+	}
+
+	consumed, err := a.RefreshTokenStore.Consume(ctx, hashRefreshToken(token), a.now())
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, ErrRefreshTokenReused) && !errors.Is(err, ErrRefreshTokenRevoked) && !errors.Is(err, ErrRefreshTokenExpired) {
+		return err
+	}
+	return a.RefreshTokenStore.RevokeFamily(ctx, consumed.FamilyID)
+}
+
+// The response written by `Authenticator.RefreshHandler` and `Authenticator.LoginHandler`.
+// The field names follow the OAuth 2.0 token response. RefreshToken is left out when no refresh
+// token was issued.
+type RefreshTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// Reads the refresh token from a JSON body with a `refresh_token` field or from a form.
+func readRefreshToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, err := ParseJsonBodyFromRequest[struct {
+			RefreshToken string `json:"refresh_token"`
+		}](r)
+		if err != nil {
+			return "", err
+		}
+		return body.RefreshToken, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	return r.PostForm.Get("refresh_token"), nil
+}
+
+// RefreshHandler returns a handler that exchanges a refresh token for a new access token.
+// The refresh token is read from the `refresh_token` field of a JSON or form encoded POST body.
+// It is rotated on every use and the response contains the new refresh token, see
+// `RefreshTokenResponse`.
+//
+// The claimsFactory builds the claims of the new access token for the subject of the refresh
+// token, usually by loading the user. If the claims have no subject it is set to the subject of
+// the refresh token, and the remaining registered claims are filled in by `GenerateToken`.
+// Returning an error, for example because the user was disabled, rejects the request.
+func (a *Authenticator[T]) RefreshHandler(claimsFactory func(r *http.Request, subject string) (T, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteErrorToResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		token, err := readRefreshToken(w, r)
+		if err != nil || token == "" {
+			WriteErrorToResponse(w, http.StatusBadRequest, "refresh_token is required")
+			return
+		}
+
+		next, consumed, err := a.RotateRefreshToken(r.Context(), token)
+		if err != nil {
+			WriteErrorToResponse(w, http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+
+		claims, err := claimsFactory(r, consumed.Subject)
+		if err != nil {
+			_ = a.RefreshTokenStore.RevokeFamily(r.Context(), consumed.FamilyID)
+			WriteErrorToResponse(w, http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+		if registered := registeredClaimsOf(claims); registered != nil && registered.Subject == "" {
+			registered.Subject = consumed.Subject
+		}
+
+		accessToken, err := a.GenerateToken(claims)
+		if err != nil {
+			WriteErrorToResponse(w, http.StatusInternalServerError, "failed to generate access token")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		_ = WriteJsonBodyToResponse(w, RefreshTokenResponse{
+			AccessToken:  accessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(a.Lifetime.Seconds()),
+			RefreshToken: next,
+		})
+	})
+}
@@ -0,0 +1,246 @@
+package grove_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func refreshAuthenticator(t *testing.T, clock func() time.Time) *grove.Authenticator[*TestClaims] {
+	t.Helper()
+
+	config := validConfig(t, false)
+	config.RefreshTokenStore = grove.NewMemoryRefreshTokenStore()
+	config.RefreshTokenLifetime = time.Hour
+	config.Clock = clock
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+	return auth
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	auth := refreshAuthenticator(t, nil)
+	ctx := context.Background()
+
+	token, err := auth.IssueRefreshToken(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken() error = %v; want nil", err)
+	}
+
+	next, consumed, err := auth.RotateRefreshToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken() error = %v; want nil", err)
+	}
+	if consumed.Subject != "user-1" {
+		t.Fatalf("Subject = %s; want user-1", consumed.Subject)
+	}
+	if next == "" || next == token {
+		t.Fatalf("RotateRefreshToken() returned %q; want a new token", next)
+	}
+
+	if _, _, err := auth.RotateRefreshToken(ctx, next); err != nil {
+		t.Fatalf("RotateRefreshToken() with rotated token error = %v; want nil", err)
+	}
+}
+
+func TestRotateRefreshTokenReuseRevokesFamily(t *testing.T) {
+	auth := refreshAuthenticator(t, nil)
+	ctx := context.Background()
+
+	token, err := auth.IssueRefreshToken(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken() error = %v; want nil", err)
+	}
+	next, _, err := auth.RotateRefreshToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken() error = %v; want nil", err)
+	}
+
+	if _, _, err := auth.RotateRefreshToken(ctx, token); !errors.Is(err, grove.ErrRefreshTokenReused) {
+		t.Fatalf("RotateRefreshToken() with used token error = %v; want %v", err, grove.ErrRefreshTokenReused)
+	}
+	if _, _, err := auth.RotateRefreshToken(ctx, next); !errors.Is(err, grove.ErrRefreshTokenRevoked) {
+		t.Fatalf("RotateRefreshToken() after reuse error = %v; want %v", err, grove.ErrRefreshTokenRevoked)
+	}
+}
+
+func TestRotateRefreshTokenWithInvalidTokenShouldFail(t *testing.T) {
+	now := time.Now()
+	current := now
+	auth := refreshAuthenticator(t, func() time.Time { return current })
+	ctx := context.Background()
+
+	expired, err := auth.IssueRefreshToken(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken() error = %v; want nil", err)
+	}
+	current = now.Add(2 * time.Hour)
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{name: "expired", token: expired, want: grove.ErrRefreshTokenExpired},
+		{name: "malformed", token: "not-a-refresh-token", want: grove.ErrRefreshTokenMalformed},
+		{name: "unknown", token: strings.Repeat("A", 43), want: grove.ErrRefreshTokenNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := auth.RotateRefreshToken(ctx, tt.token); !errors.Is(err, tt.want) {
+				t.Fatalf("RotateRefreshToken() error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateExpiredRefreshTokenIsNotReuse(t *testing.T) {
+	now := time.Now()
+	current := now
+	auth := refreshAuthenticator(t, func() time.Time { return current })
+	ctx := context.Background()
+
+	token, err := auth.IssueRefreshToken(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken() error = %v; want nil", err)
+	}
+	current = now.Add(2 * time.Hour)
+
+	// A client retrying the expired token must not get its family revoked.
+	for range 2 {
+		if _, _, err := auth.RotateRefreshToken(ctx, token); !errors.Is(err, grove.ErrRefreshTokenExpired) {
+			t.Fatalf("RotateRefreshToken() error = %v; want %v", err, grove.ErrRefreshTokenExpired)
+		}
+	}
+}
+
+func TestRefreshTokensRequireStore(t *testing.T) {
+	config := validConfig(t, false)
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	if _, err := auth.IssueRefreshToken(context.Background(), "user-1"); !errors.Is(err, grove.ErrRefreshTokensDisabled) {
+		t.Fatalf("IssueRefreshToken() error = %v; want %v", err, grove.ErrRefreshTokensDisabled)
+	}
+}
+
+func TestRevokeRefreshTokens(t *testing.T) {
+	auth := refreshAuthenticator(t, nil)
+	store := auth.RefreshTokenStore
+	ctx := context.Background()
+
+	first, _ := auth.IssueRefreshToken(ctx, "user-1")
+	second, _ := auth.IssueRefreshToken(ctx, "user-1")
+	other, _ := auth.IssueRefreshToken(ctx, "user-2")
+
+	if err := auth.RevokeRefreshToken(ctx, first); err != nil {
+		t.Fatalf("RevokeRefreshToken() error = %v; want nil", err)
+	}
+	if _, _, err := auth.RotateRefreshToken(ctx, first); err == nil {
+		t.Fatalf("RotateRefreshToken() with revoked token error = nil; want error")
+	}
+
+	if err := store.RevokeSubject(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeSubject() error = %v; want nil", err)
+	}
+	if _, _, err := auth.RotateRefreshToken(ctx, second); !errors.Is(err, grove.ErrRefreshTokenRevoked) {
+		t.Fatalf("RotateRefreshToken() after RevokeSubject error = %v; want %v", err, grove.ErrRefreshTokenRevoked)
+	}
+	if _, _, err := auth.RotateRefreshToken(ctx, other); err != nil {
+		t.Fatalf("RotateRefreshToken() for other subject error = %v; want nil", err)
+	}
+}
+
+func TestRefreshHandler(t *testing.T) {
+	auth := refreshAuthenticator(t, nil)
+	handler := auth.RefreshHandler(func(r *http.Request, subject string) (*TestClaims, error) {
+		if subject == "disabled" {
+			return nil, errors.New("user is disabled")
+		}
+		return &TestClaims{Email: subject + "@example.com", RegisteredClaims: &jwt.RegisteredClaims{}}, nil
+	})
+
+	post := func(contentType string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	token, err := auth.IssueRefreshToken(context.Background(), "testing")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken() error = %v; want nil", err)
+	}
+
+	rec := post("application/json", `{"refresh_token":"`+token+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Fatalf("Cache-Control = %q; want no-store", got)
+	}
+
+	var response grove.RefreshTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.TokenType != "Bearer" || response.RefreshToken == "" || response.RefreshToken == token {
+		t.Fatalf("response = %+v; want a bearer token and a rotated refresh token", response)
+	}
+
+	claims, err := auth.VerifyToken(response.AccessToken, &TestClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if claims.Subject != "testing" || claims.Email != "testing@example.com" {
+		t.Fatalf("claims = %+v; want subject and email of the refresh token", claims)
+	}
+
+	form := url.Values{"refresh_token": {response.RefreshToken}}.Encode()
+	if rec := post("application/x-www-form-urlencoded", form); rec.Code != http.StatusOK {
+		t.Fatalf("form status = %d; want %d", rec.Code, http.StatusOK)
+	}
+
+	disabled, _ := auth.IssueRefreshToken(context.Background(), "disabled")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{name: "missing token", contentType: "application/json", body: `{}`, want: http.StatusBadRequest},
+		{name: "reused token", contentType: "application/json", body: `{"refresh_token":"` + token + `"}`, want: http.StatusUnauthorized},
+		{name: "rejected subject", contentType: "application/json", body: `{"refresh_token":"` + disabled + `"}`, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(tt.contentType, tt.body); rec.Code != tt.want {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/refresh", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status = %d; want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
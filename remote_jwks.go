@@ -0,0 +1,285 @@
+package grove
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The signing algorithms accepted by `RemoteJWKSVerifier` when none are configured.
+var DefaultRemoteJWKSAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Config used for the `RemoteJWKSVerifier`.
+// These values describe where the keys of a third-party identity provider are published and what
+// the tokens it issues must contain.
+type RemoteJWKSConfig struct {
+	// URL of the JWKS document, for example https://idp.example.com/.well-known/jwks.json
+	URL string
+	// The required `iss` claim of the tokens.
+	Issuer string
+	// The accepted `aud` claims.
+	Audience []string
+	// Whether a token must contain one or all of the audiences. Defaults to AudienceMatchAny.
+	AudienceMatch AudienceMatch
+	// The signing algorithms that are accepted. If empty DefaultRemoteJWKSAlgorithms is used.
+	// Symmetric algorithms are never accepted.
+	Algorithms []string
+	// The client used to fetch the JWKS. If nil a client with a 10 second timeout is used.
+	HTTPClient *http.Client
+	// How long fetched keys are used before the JWKS is fetched again. Defaults to one hour.
+	CacheTTL time.Duration
+	// The minimum time between two fetches that were caused by a token with an unknown `kid`.
+	// It prevents tokens with random key IDs from flooding the identity provider. Defaults to 30 seconds.
+	MinRefreshInterval time.Duration
+	// Consulted by VerifyToken to reject tokens that were revoked before they expired.
+	// Revocation is disabled when it is nil.
+	RevocationStore IRevocationStore
+}
+
+// Function that validates the RemoteJWKSConfig.
+// If any values are missing it will return an error.
+// If it is valid it will return nil.
+func (config *RemoteJWKSConfig) Validate() error {
+	if config.URL == "" {
+		return fmt.Errorf("URL is required")
+	}
+	if config.Issuer == "" {
+		return fmt.Errorf("issuer is required")
+	}
+	if len(config.Audience) == 0 {
+		return fmt.Errorf("audience must contain at least one value")
+	}
+	for _, alg := range config.Algorithms {
+		method, err := signingMethodFor(alg)
+		if err != nil {
+			return err
+		}
+		if isHMACSigningMethod(method) {
+			return fmt.Errorf("symmetric algorithm %s cannot be used with a JWKS", alg)
+		}
+	}
+	return nil
+}
+
+// RemoteJWKSVerifier verifies tokens signed by a third party that publishes its public keys
+// as a JWKS document.
+// The keys are fetched lazily, cached, and fetched again when a token references a `kid` that
+// is not in the cache, which is how identity providers announce rotated keys.
+// It implements `ITokenVerifier` so it can be used with `DefaultAuthMiddleware`.
+type RemoteJWKSVerifier[T jwt.Claims] struct {
+	config *RemoteJWKSConfig
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        jose.JSONWebKeySet
+	fetchedAt   time.Time
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+}
+
+// Initializes the RemoteJWKSVerifier.
+// The configuration is validated but the JWKS is not fetched until the first token is verified,
+// call `Refresh` to fetch it eagerly.
+func NewRemoteJWKSVerifier[T jwt.Claims](config *RemoteJWKSConfig) (*RemoteJWKSVerifier[T], error) {
+	if config == nil {
+		return nil, fmt.Errorf("Tried to initialize RemoteJWKSVerifier with nil configuration.")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &RemoteJWKSVerifier[T]{
+		config: config,
+		client: client,
+	}, nil
+}
+
+func (v *RemoteJWKSVerifier[T]) algorithms() []string {
+	if len(v.config.Algorithms) == 0 {
+		return DefaultRemoteJWKSAlgorithms
+	}
+	return v.config.Algorithms
+}
+
+func (v *RemoteJWKSVerifier[T]) cacheTTL() time.Duration {
+	if v.config.CacheTTL <= 0 {
+		return time.Hour
+	}
+	return v.config.CacheTTL
+}
+
+func (v *RemoteJWKSVerifier[T]) minRefreshInterval() time.Duration {
+	if v.config.MinRefreshInterval <= 0 {
+		return 30 * time.Second
+	}
+	return v.config.MinRefreshInterval
+}
+
+// Refresh fetches the JWKS document and replaces the cached keys.
+func (v *RemoteJWKSVerifier[T]) Refresh(ctx context.Context) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+	return v.refresh(ctx)
+}
+
+// Must be called while holding refreshMu.
+func (v *RemoteJWKSVerifier[T]) refresh(ctx context.Context) error {
+	v.lastRefresh = time.Now()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, v.config.URL, nil)
+	if err != nil {
+		return fmt.Errorf("an error occurred while creating JWKS request: %v", err)
+	}
+	request.Header.Set("Accept", "application/jwk-set+json, application/json")
+
+	response, err := v.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("an error occurred while fetching JWKS: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("an error occurred while fetching JWKS: unexpected status %d", response.StatusCode)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&keys); err != nil {
+		return fmt.Errorf("an error occurred while decoding JWKS: %v", err)
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+// Looks up a key in the cached JWKS. An empty kid only matches when the JWKS has a single
+// signing key.
+func (v *RemoteJWKSVerifier[T]) cachedKey(kid string) (jose.JSONWebKey, bool, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	fresh := !v.fetchedAt.IsZero() && time.Since(v.fetchedAt) < v.cacheTTL()
+
+	candidates := make([]jose.JSONWebKey, 0, 1)
+	for _, key := range v.keys.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if kid == "" || key.KeyID == kid {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) != 1 {
+		return jose.JSONWebKey{}, false, fresh
+	}
+	return candidates[0], true, fresh
+}
+
+// Returns the key for the provided kid, fetching the JWKS when the cache is stale or the key
+// is unknown.
+func (v *RemoteJWKSVerifier[T]) key(ctx context.Context, kid string) (jose.JSONWebKey, error) {
+	if key, ok, fresh := v.cachedKey(kid); ok && fresh {
+		return key, nil
+	}
+
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	// Another request may have refreshed the keys while this one was waiting.
+	key, ok, fresh := v.cachedKey(kid)
+	if ok && fresh {
+		return key, nil
+	}
+
+	if !fresh || time.Since(v.lastRefresh) >= v.minRefreshInterval() {
+		if err := v.refresh(ctx); err != nil {
+			// Keep using the stale key if the identity provider is unavailable.
+			if ok {
+				return key, nil
+			}
+			return jose.JSONWebKey{}, err
+		}
+		key, ok, _ = v.cachedKey(kid)
+	}
+
+	if !ok {
+		return jose.JSONWebKey{}, fmt.Errorf("unknown signing key: %q", kid)
+	}
+	return key, nil
+}
+
+// Returns the jwt.Keyfunc that looks up the key of a token, refreshing the JWKS within ctx.
+func (v *RemoteJWKSVerifier[T]) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm != "" && key.Algorithm != token.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing algorithm: %v", token.Header["alg"])
+		}
+		if !key.IsPublic() {
+			return nil, fmt.Errorf("signing key %q is not a public key", kid)
+		}
+		return key.Key, nil
+	}
+}
+
+// VerifyToken parses the token, verifies its signature using the remote JWKS, and validates
+// the claims.
+// It checks the audience and issuer against the configured values and requires an expiration.
+// MFA pending tokens issued by a Grove `Authenticator` are rejected with ErrTokenMFAPending.
+// If the token is valid, it returns the claims; otherwise, it returns an error wrapping one of
+// the ErrToken errors.
+func (v *RemoteJWKSVerifier[T]) VerifyToken(token string, claims T) (T, error) {
+	return v.VerifyTokenContext(context.Background(), token, claims)
+}
+
+// VerifyTokenContext is `VerifyToken` with a context that bounds the JWKS refresh and the
+// RevocationStore lookup. `DefaultAuthMiddleware` calls it with the context of the request.
+func (v *RemoteJWKSVerifier[T]) VerifyTokenContext(ctx context.Context, token string, claims T) (T, error) {
+	algorithms := v.algorithms()
+	algorithms = slices.DeleteFunc(slices.Clone(algorithms), func(alg string) bool {
+		method, err := signingMethodFor(alg)
+		return err != nil || isHMACSigningMethod(method)
+	})
+
+	parsedToken, err := jwt.ParseWithClaims(
+		token,
+		claims,
+		v.keyFunc(ctx),
+		v.config.AudienceMatch.parserOption(v.config.Audience),
+		jwt.WithIssuer(v.config.Issuer),
+		jwt.WithValidMethods(algorithms),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return claims, classifyJWTError(err)
+	}
+	if !parsedToken.Valid {
+		return claims, ErrTokenInvalidClaims
+	}
+	if err := checkAccessTokenType(parsedToken); err != nil {
+		return claims, err
+	}
+	if err := checkRevocation(ctx, v.config.RevocationStore, parsedToken.Claims, time.Now()); err != nil {
+		return claims, err
+	}
+	return parsedToken.Claims.(T), nil
+}
@@ -0,0 +1,218 @@
+package grove_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+func jwksServer(t *testing.T, auth *grove.Authenticator[*TestClaims]) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var fetches atomic.Int32
+	handler := auth.JWKSHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &fetches
+}
+
+func remoteVerifier(t *testing.T, url string, minRefreshInterval time.Duration) *grove.RemoteJWKSVerifier[*TestClaims] {
+	t.Helper()
+
+	verifier, err := grove.NewRemoteJWKSVerifier[*TestClaims](&grove.RemoteJWKSConfig{
+		URL:                url,
+		Issuer:             "Testing",
+		Audience:           []string{"testing"},
+		MinRefreshInterval: minRefreshInterval,
+	})
+	if err != nil {
+		t.Fatalf("NewRemoteJWKSVerifier() error = %v; want nil", err)
+	}
+	return verifier
+}
+
+func TestNewRemoteJWKSVerifierWithInvalidConfigShouldFail(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *grove.RemoteJWKSConfig
+	}{
+		{name: "nil config", config: nil},
+		{name: "missing URL", config: &grove.RemoteJWKSConfig{Issuer: "Testing", Audience: []string{"testing"}}},
+		{name: "missing issuer", config: &grove.RemoteJWKSConfig{URL: "http://idp", Audience: []string{"testing"}}},
+		{name: "missing audience", config: &grove.RemoteJWKSConfig{URL: "http://idp", Issuer: "Testing"}},
+		{
+			name:   "symmetric algorithm",
+			config: &grove.RemoteJWKSConfig{URL: "http://idp", Issuer: "Testing", Audience: []string{"testing"}, Algorithms: []string{"HS256"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := grove.NewRemoteJWKSVerifier[*TestClaims](tt.config); err == nil {
+				t.Fatalf("NewRemoteJWKSVerifier() error = nil; want error")
+			}
+		})
+	}
+}
+
+func TestRemoteJWKSVerifierVerifiesToken(t *testing.T) {
+	issuer := asymmetricAuthenticator(t, "idp-1")
+	server, fetches := jwksServer(t, issuer)
+	verifier := remoteVerifier(t, server.URL, time.Minute)
+
+	for range 3 {
+		token, err := issuer.GenerateToken(validClaims())
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v; want nil", err)
+		}
+
+		got, err := verifier.VerifyToken(token, &TestClaims{})
+		if err != nil {
+			t.Fatalf("VerifyToken() error = %v; want nil", err)
+		}
+		if got.Email != "testing@example.com" {
+			t.Fatalf("Email = %s; want testing@example.com", got.Email)
+		}
+	}
+
+	if got := fetches.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times; want 1", got)
+	}
+}
+
+func TestRemoteJWKSVerifierRefreshesOnUnknownKeyID(t *testing.T) {
+	issuer := asymmetricAuthenticator(t, "idp-1")
+	server, fetches := jwksServer(t, issuer)
+	verifier := remoteVerifier(t, server.URL, time.Nanosecond)
+
+	if err := verifier.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v; want nil", err)
+	}
+
+	err := issuer.RotateSigningKey(grove.JWTKey{
+		ID:         "idp-2",
+		Algorithm:  "ES256",
+		PrivateKey: testECDSAKey(t, elliptic.P256()),
+	})
+	if err != nil {
+		t.Fatalf("RotateSigningKey() error = %v; want nil", err)
+	}
+
+	token, err := issuer.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	if _, err := verifier.VerifyToken(token, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Fatalf("JWKS fetched %d times; want 2", got)
+	}
+}
+
+func TestRemoteJWKSVerifierLimitsRefreshes(t *testing.T) {
+	issuer := asymmetricAuthenticator(t, "idp-1")
+	server, fetches := jwksServer(t, issuer)
+	verifier := remoteVerifier(t, server.URL, time.Hour)
+
+	other := asymmetricAuthenticator(t, "unknown")
+	token, err := other.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	for range 3 {
+		if _, err := verifier.VerifyToken(token, &TestClaims{}); err == nil {
+			t.Fatalf("VerifyToken() error = nil; want unknown key error")
+		}
+	}
+
+	if got := fetches.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times; want 1", got)
+	}
+}
+
+func TestRemoteJWKSVerifierEnforcesIssuerAndAudience(t *testing.T) {
+	issuer := asymmetricAuthenticator(t, "idp-1")
+	server, _ := jwksServer(t, issuer)
+	verifier := remoteVerifier(t, server.URL, time.Minute)
+
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "WrongIssuer"
+	wrongAudience := validClaims()
+	wrongAudience.Audience = []string{"wrong-audience"}
+
+	for name, claims := range map[string]*TestClaims{"issuer": wrongIssuer, "audience": wrongAudience} {
+		t.Run(name, func(t *testing.T) {
+			token, err := issuer.GenerateToken(claims)
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v; want nil", err)
+			}
+			if _, err := verifier.VerifyToken(token, &TestClaims{}); err == nil {
+				t.Fatalf("VerifyToken() error = nil; want %s error", name)
+			}
+		})
+	}
+}
+
+func TestRemoteJWKSVerifierRejectsHMACTokens(t *testing.T) {
+	issuer := asymmetricAuthenticator(t, "idp-1")
+	server, _ := jwksServer(t, issuer)
+	verifier := remoteVerifier(t, server.URL, time.Minute)
+
+	config := validConfig(t, false)
+	config.KeyID = "idp-1"
+	hmacAuth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+	token, err := hmacAuth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	if _, err := verifier.VerifyToken(token, &TestClaims{}); err == nil {
+		t.Fatalf("VerifyToken() error = nil; want algorithm error")
+	}
+}
+
+func TestDefaultAuthMiddlewareWithRemoteJWKSVerifier(t *testing.T) {
+	issuer := asymmetricAuthenticator(t, "idp-1")
+	server, _ := jwksServer(t, issuer)
+	verifier := remoteVerifier(t, server.URL, time.Minute)
+
+	scope := grove.NewScope("test").
+		WithMiddleware(grove.DefaultAuthMiddleware(verifier, &testLogger{}, func() *TestClaims { return &TestClaims{} })).
+		WithRoute("GET /me", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := r.Context().Value(grove.AuthTokenKey).(*TestClaims)
+			_, _ = w.Write([]byte(claims.Email))
+		}))
+
+	token, err := issuer.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	scope.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if rec.Body.String() != "testing@example.com" {
+		t.Fatalf("body = %q; want testing@example.com", rec.Body.String())
+	}
+}
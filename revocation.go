@@ -0,0 +1,237 @@
+package grove
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrTokenRevoked       = errors.New("token has been revoked")
+	ErrRevocationDisabled = errors.New("no revocation store is configured")
+)
+
+// IRevocationStore keeps track of access tokens that must no longer be accepted even though
+// they have not expired yet.
+// Single tokens are revoked by their `jti` claim. Revoking a subject revokes every token that
+// was issued for it up to that moment, which is what is needed after a compromised account or
+// a password change.
+type IRevocationStore interface {
+	// RevokeToken revokes the token with the provided `jti` at revokedAt.
+	// The entry only needs to be kept until expiresAt, after which the token is expired anyway.
+	RevokeToken(ctx context.Context, id string, revokedAt time.Time, expiresAt time.Time) error
+	// RevokeSubject revokes every token of the subject issued at or before revokedAt.
+	// The entry only needs to be kept until expiresAt.
+	RevokeSubject(ctx context.Context, subject string, revokedAt time.Time, expiresAt time.Time) error
+	// IsRevoked reports whether the token with the provided `jti`, `sub` and `iat` was revoked.
+	// The id and subject may be empty and issuedAt may be zero when the token lacks the claim.
+	// Entries that expired before now must be ignored.
+	IsRevoked(ctx context.Context, id string, subject string, issuedAt time.Time, now time.Time) (bool, error)
+}
+
+type subjectRevocation struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+// MemoryRevocationStore is an in-memory `IRevocationStore`.
+// Entries are dropped once they expire. Expiration is judged by the times passed in by the
+// `Authenticator`, so it follows AuthenticatorConfig.Clock. It is safe for concurrent use but its entries are lost
+// on restart and are not shared between instances, so it is best suited to tests and single
+// instance applications.
+type MemoryRevocationStore struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	subjects map[string]subjectRevocation
+}
+
+// Initializes the MemoryRevocationStore.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]subjectRevocation),
+	}
+}
+
+// RevokeToken revokes the token with the provided `jti` until expiresAt.
+func (s *MemoryRevocationStore) RevokeToken(ctx context.Context, id string, revokedAt time.Time, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(revokedAt)
+	if existing, ok := s.tokens[id]; !ok || expiresAt.After(existing) {
+		s.tokens[id] = expiresAt
+	}
+	return nil
+}
+
+// RevokeSubject revokes the tokens of the subject issued at or before revokedAt until expiresAt.
+func (s *MemoryRevocationStore) RevokeSubject(ctx context.Context, subject string, revokedAt time.Time, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(revokedAt)
+	existing := s.subjects[subject]
+	if revokedAt.After(existing.revokedAt) {
+		existing.revokedAt = revokedAt
+	}
+	if expiresAt.After(existing.expiresAt) {
+		existing.expiresAt = expiresAt
+	}
+	s.subjects[subject] = existing
+	return nil
+}
+
+// IsRevoked reports whether the token was revoked by its `jti` or its subject.
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, id string, subject string, issuedAt time.Time, now time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if id != "" {
+		if expiresAt, ok := s.tokens[id]; ok && now.Before(expiresAt) {
+			return true, nil
+		}
+	}
+	if subject != "" {
+		if revocation, ok := s.subjects[subject]; ok && now.Before(revocation.expiresAt) {
+			// A token without an iat cannot prove it was issued after the revocation.
+			if issuedAt.IsZero() || !issuedAt.After(revocation.revokedAt) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Must be called while holding the write lock.
+func (s *MemoryRevocationStore) prune(now time.Time) {
+	for id, expiresAt := range s.tokens {
+		if !now.Before(expiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+	for subject, revocation := range s.subjects {
+		if !now.Before(revocation.expiresAt) {
+			delete(s.subjects, subject)
+		}
+	}
+}
+
+// Returns an error wrapping ErrTokenRevoked if the store reports the token as revoked at now.
+// Errors of the store are returned as well so that tokens are rejected when the store is
+// unavailable.
+func checkRevocation(ctx context.Context, store IRevocationStore, claims jwt.Claims, now time.Time) error {
+	if store == nil {
+		return nil
+	}
+
+	subject, _ := claims.GetSubject()
+	var issuedAt time.Time
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+
+	revoked, err := store.IsRevoked(ctx, tokenIDOf(claims), subject, issuedAt, now)
+	if err != nil {
+		return fmt.Errorf("an error occurred while checking token revocation: %v", err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RevokeToken revokes the token the claims were parsed from, usually the claims
+// `DefaultAuthMiddleware` stored under AuthTokenKey.
+// The token must have a `jti` claim, which `GenerateToken` always sets, and it stays revoked
+// until it expires.
+// It requires AuthenticatorConfig.RevocationStore to be set.
+func (a *Authenticator[T]) RevokeToken(ctx context.Context, claims T) error {
+	if a.RevocationStore == nil {
+		return ErrRevocationDisabled
+	}
+
+	id := tokenIDOf(claims)
+	if id == "" {
+		return fmt.Errorf("token cannot be revoked because it has no jti claim")
+	}
+	now := a.now()
+	expiresAt := now.Add(a.Lifetime)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
+
+	if err := a.RevocationStore.RevokeToken(ctx, id, now, expiresAt.Add(a.Leeway)); err != nil {
+		return fmt.Errorf("an error occurred while revoking token: %v", err)
+	}
+	return nil
+}
+
+// RevokeSubject revokes every access token issued for the subject so far and, when refresh
+// tokens are enabled, all of its refresh tokens.
+// Tokens issued within the same second as the revocation are revoked as well because `iat` has
+// a precision of one second. Access tokens with an expiration past Lifetime outlive the revocation.
+// It requires AuthenticatorConfig.RevocationStore to be set.
+func (a *Authenticator[T]) RevokeSubject(ctx context.Context, subject string) error {
+	if a.RevocationStore == nil {
+		return ErrRevocationDisabled
+	}
+	if subject == "" {
+		return fmt.Errorf("subject is required to revoke tokens")
+	}
+
+	now := a.now()
+	if err := a.RevocationStore.RevokeSubject(ctx, subject, now, now.Add(a.Lifetime+a.Leeway)); err != nil {
+		return fmt.Errorf("an error occurred while revoking subject: %v", err)
+	}
+	if a.RefreshTokenStore != nil {
+		if err := a.RefreshTokenStore.RevokeSubject(ctx, subject); err != nil {
+			return fmt.Errorf("an error occurred while revoking refresh tokens: %v", err)
+		}
+	}
+	return nil
+}
+
+// Logout revokes the token of the current request and clears the session cookie.
+// It must be used behind `DefaultAuthMiddleware`, which stores the claims of the token under
+// AuthTokenKey. Requests without verified claims get an error wrapping ErrTokenMissing.
+// When no RevocationStore is configured the cookie is still cleared but the token stays valid
+// until it expires.
+func (a *Authenticator[T]) Logout(w http.ResponseWriter, r *http.Request) error {
+	a.ClearSessionCookie(w)
+
+	claims, ok := r.Context().Value(AuthTokenKey).(T)
+	if !ok {
+		return fmt.Errorf("%w: make sure DefaultAuthMiddleware runs before Logout", ErrTokenMissing)
+	}
+	if a.RevocationStore == nil {
+		return nil
+	}
+	return a.RevokeToken(r.Context(), claims)
+}
+
+// LogoutHandler returns a handler that calls `Logout` and responds with 204 No Content.
+// Only POST requests are accepted so that logging out cannot be triggered by a link. Requests
+// without a verified token get 401 with a Bearer challenge.
+func (a *Authenticator[T]) LogoutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteErrorToResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if err := a.Logout(w, r); errors.Is(err, ErrTokenMissing) {
+			writeUnauthorized(w, "Bearer", "", err)
+			return
+		} else if err != nil {
+			WriteErrorToResponse(w, http.StatusInternalServerError, "failed to log out")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
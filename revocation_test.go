@@ -0,0 +1,230 @@
+package grove_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func revocationAuthenticator(t *testing.T) *grove.Authenticator[*TestClaims] {
+	t.Helper()
+
+	config := validConfig(t, false)
+	config.RevocationStore = grove.NewMemoryRevocationStore()
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+	return auth
+}
+
+func TestVerifyTokenWithRevokedTokenShouldFail(t *testing.T) {
+	auth := revocationAuthenticator(t)
+	ctx := context.Background()
+
+	revoked, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+	other, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	claims, err := auth.VerifyToken(revoked, &TestClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if err := auth.RevokeToken(ctx, claims); err != nil {
+		t.Fatalf("RevokeToken() error = %v; want nil", err)
+	}
+
+	if _, err := auth.VerifyToken(revoked, &TestClaims{}); !errors.Is(err, grove.ErrTokenRevoked) {
+		t.Fatalf("VerifyToken() error = %v; want %v", err, grove.ErrTokenRevoked)
+	}
+	if _, err := auth.VerifyToken(other, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken() with other token error = %v; want nil", err)
+	}
+}
+
+func TestRevokeTokenWithClock(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := validConfig(t, false)
+	config.RevocationStore = grove.NewMemoryRevocationStore()
+	config.Clock = func() time.Time { return now }
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	token, err := auth.GenerateToken(&TestClaims{RegisteredClaims: &jwt.RegisteredClaims{}})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+	claims, err := auth.VerifyToken(token, &TestClaims{})
+	if err != nil {
+		t.Fatalf("VerifyToken() error = %v; want nil", err)
+	}
+	if err := auth.RevokeToken(context.Background(), claims); err != nil {
+		t.Fatalf("RevokeToken() error = %v; want nil", err)
+	}
+
+	if _, err := auth.VerifyToken(token, &TestClaims{}); !errors.Is(err, grove.ErrTokenRevoked) {
+		t.Fatalf("VerifyToken() error = %v; want %v", err, grove.ErrTokenRevoked)
+	}
+}
+
+func TestVerifyTokenWithRevokedSubjectShouldFail(t *testing.T) {
+	auth := revocationAuthenticator(t)
+	ctx := context.Background()
+
+	before := validClaims()
+	before.Subject = "testing"
+	before.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	token, err := auth.GenerateToken(before)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	if err := auth.RevokeSubject(ctx, "testing"); err != nil {
+		t.Fatalf("RevokeSubject() error = %v; want nil", err)
+	}
+	if _, err := auth.VerifyToken(token, &TestClaims{}); !errors.Is(err, grove.ErrTokenRevoked) {
+		t.Fatalf("VerifyToken() error = %v; want %v", err, grove.ErrTokenRevoked)
+	}
+
+	after := validClaims()
+	after.Subject = "testing"
+	after.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Second))
+	token, err = auth.GenerateToken(after)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+	if _, err := auth.VerifyToken(token, &TestClaims{}); err != nil {
+		t.Fatalf("VerifyToken() with token issued after revocation error = %v; want nil", err)
+	}
+}
+
+func TestRevokeTokenRequiresStore(t *testing.T) {
+	config := validConfig(t, false)
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+
+	if err := auth.RevokeToken(context.Background(), validClaims()); !errors.Is(err, grove.ErrRevocationDisabled) {
+		t.Fatalf("RevokeToken() error = %v; want %v", err, grove.ErrRevocationDisabled)
+	}
+}
+
+func TestMemoryRevocationStoreDropsExpiredEntries(t *testing.T) {
+	store := grove.NewMemoryRevocationStore()
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := store.RevokeToken(ctx, "expired", now, now.Add(-time.Second)); err != nil {
+		t.Fatalf("RevokeToken() error = %v; want nil", err)
+	}
+	if err := store.RevokeSubject(ctx, "expired", now, now.Add(-time.Second)); err != nil {
+		t.Fatalf("RevokeSubject() error = %v; want nil", err)
+	}
+
+	revoked, err := store.IsRevoked(ctx, "expired", "expired", now.Add(-time.Minute), now)
+	if err != nil {
+		t.Fatalf("IsRevoked() error = %v; want nil", err)
+	}
+	if revoked {
+		t.Fatalf("IsRevoked() = true; want false for expired entries")
+	}
+}
+
+func TestDefaultAuthMiddlewareWithLogout(t *testing.T) {
+	auth := revocationAuthenticator(t)
+
+	scope := grove.NewScope("test").
+		WithMiddleware(grove.DefaultAuthMiddleware(auth, &testLogger{}, func() *TestClaims { return &TestClaims{} })).
+		WithRoute("GET /me", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).
+		WithRoute("POST /logout", auth.LogoutHandler())
+
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	request := func(method string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: grove.DefaultSessionCookieName, Value: token})
+		rec := httptest.NewRecorder()
+		scope.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request(http.MethodGet, "/me"); rec.Code != http.StatusOK {
+		t.Fatalf("status before logout = %d; want %d", rec.Code, http.StatusOK)
+	}
+
+	rec := request(http.MethodPost, "/logout")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("logout status = %d; want %d", rec.Code, http.StatusNoContent)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != grove.DefaultSessionCookieName || cookies[0].MaxAge >= 0 {
+		t.Fatalf("cookies = %v; want an expired %s cookie", cookies, grove.DefaultSessionCookieName)
+	}
+
+	if rec := request(http.MethodGet, "/me"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status after logout = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// Without DefaultAuthMiddleware there are no claims to revoke.
+	rec = httptest.NewRecorder()
+	auth.LogoutHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/logout", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Fatalf("logout without claims = %d, WWW-Authenticate %q; want %d, Bearer", rec.Code, rec.Header().Get("WWW-Authenticate"), http.StatusUnauthorized)
+	}
+}
+
+type requestContextKey struct{}
+
+// A revocation store that records the context it was consulted with.
+type contextRecordingRevocationStore struct {
+	*grove.MemoryRevocationStore
+	ctx context.Context
+}
+
+func (s *contextRecordingRevocationStore) IsRevoked(ctx context.Context, id string, subject string, issuedAt time.Time, now time.Time) (bool, error) {
+	s.ctx = ctx
+	return s.MemoryRevocationStore.IsRevoked(ctx, id, subject, issuedAt, now)
+}
+
+func TestDefaultAuthMiddlewarePassesRequestContextToRevocationStore(t *testing.T) {
+	store := &contextRecordingRevocationStore{MemoryRevocationStore: grove.NewMemoryRevocationStore()}
+	config := validConfig(t, false)
+	config.RevocationStore = store
+	auth, err := grove.NewAuthenticator[*TestClaims](&config)
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v; want nil", err)
+	}
+	token, err := auth.GenerateToken(validClaims())
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v; want nil", err)
+	}
+
+	handler := grove.DefaultAuthMiddleware(auth, &testLogger{}, func() *TestClaims { return &TestClaims{} })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), requestContextKey{}, "request"))
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if store.ctx == nil || store.ctx.Value(requestContextKey{}) != "request" {
+		t.Fatalf("IsRevoked() was not called with the request context")
+	}
+}
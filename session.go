@@ -0,0 +1,472 @@
+package grove
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The name of the session ID cookie when none is configured.
+const DefaultSessionIDCookieName = "session_id"
+
+// Default timeouts of `Sessions`.
+const (
+	DefaultSessionIdleTimeout     = 30 * time.Minute
+	DefaultSessionAbsoluteTimeout = 24 * time.Hour
+)
+
+const sessionIDSize = 32
+
+// How often the last activity of an unchanged session is written to the store.
+const sessionTouchInterval = time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionData is the state of a session as it is kept by an `ISessionStore`.
+// Values must survive a JSON round trip for stores that serialize them, such as the
+// `FileSessionStore`, where numbers come back as float64.
+type SessionData struct {
+	ID         string         `json:"id"`
+	Values     map[string]any `json:"values"`
+	CreatedAt  time.Time      `json:"created_at"`
+	LastSeenAt time.Time      `json:"last_seen_at"`
+}
+
+// ISessionStore persists server-side sessions.
+type ISessionStore interface {
+	// GetSession returns the session with the provided ID or ErrSessionNotFound.
+	// Sessions that expired at now, the time of the `SessionConfig` Clock, must not be returned.
+	GetSession(ctx context.Context, id string, now time.Time) (SessionData, error)
+	// SaveSession creates or replaces the session. The store may forget it after expiresAt.
+	// LastSeenAt of the session is the current time of the Clock.
+	SaveSession(ctx context.Context, session SessionData, expiresAt time.Time) error
+	// DeleteSession removes the session. Deleting an unknown session is not an error.
+	DeleteSession(ctx context.Context, id string) error
+}
+
+type sessionKeyType struct{}
+
+// Key that should be used to pull the `*Session` from the request context.
+// `Sessions.Middleware` stores one for every request.
+var SessionKey = sessionKeyType{}
+
+// SessionFromContext returns the session stored under SessionKey.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(SessionKey).(*Session)
+	return session, ok && session != nil
+}
+
+// Session is the server-side session of a request.
+// A new session is only saved, and its cookie only written, once a value is set.
+type Session struct {
+	mu          sync.Mutex
+	data        SessionData
+	persisted   bool
+	dirty       bool
+	destroyed   bool
+	previousIDs []string
+}
+
+// ID returns the current ID of the session.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.ID
+}
+
+// IsNew reports whether the session was created by this request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.persisted
+}
+
+// Get returns the value stored under the key.
+func (s *Session) Get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.data.Values[key]
+	return value, ok
+}
+
+// GetString returns the string stored under the key or an empty string.
+func (s *Session) GetString(key string) string {
+	value, _ := s.Get(key)
+	str, _ := value.(string)
+	return str
+}
+
+// Set stores the value under the key.
+func (s *Session) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Values == nil {
+		s.data.Values = make(map[string]any)
+	}
+	s.data.Values[key] = value
+	s.dirty = true
+}
+
+// Delete removes the value stored under the key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.dirty = true
+	}
+}
+
+// Regenerate gives the session a new ID and restarts its absolute timeout while keeping its
+// values. It must be called whenever the privilege level changes, most importantly on login, so
+// an ID planted in the browser before the login cannot be used to hijack the session.
+func (s *Session) Regenerate() error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.persisted {
+		s.previousIDs = append(s.previousIDs, s.data.ID)
+	}
+	s.data.ID = id
+	s.persisted = false
+	s.dirty = true
+	return nil
+}
+
+// Destroy removes the session from the store and expires its cookie, such as on logout.
+// Values set afterwards during the same request are discarded.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.destroyed = true
+	s.data.Values = nil
+}
+
+func newSessionID() (string, error) {
+	random := make([]byte, sessionIDSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("an error occurred while generating session ID: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// Config used for `Sessions`.
+type SessionConfig struct {
+	// Persists the sessions. Required.
+	Store ISessionStore
+	// The key used to sign the session ID cookie with HMAC-SHA256. It must be at least 32 bytes.
+	// Required.
+	Secret []byte
+	// How long a session survives without requests. Defaults to DefaultSessionIdleTimeout.
+	IdleTimeout time.Duration
+	// How long a session survives after it was created or regenerated, regardless of activity.
+	// Defaults to DefaultSessionAbsoluteTimeout.
+	AbsoluteTimeout time.Duration
+	// Settings of the session ID cookie. The name defaults to DefaultSessionIDCookieName.
+	Cookie SessionCookieConfig
+	// Returns the current time. Defaults to time.Now.
+	Clock func() time.Time
+}
+
+// Function that validates the SessionConfig.
+// If any values are missing it will return an error.
+// If it is valid it will return nil.
+func (config *SessionConfig) Validate() error {
+	if config.Store == nil {
+		return fmt.Errorf("session store is required")
+	}
+	if len(config.Secret) < 32 {
+		return fmt.Errorf("session secret must be at least 32 bytes")
+	}
+	if config.IdleTimeout < 0 || config.AbsoluteTimeout < 0 {
+		return fmt.Errorf("session timeouts cannot be negative")
+	}
+	return config.cookie().Validate()
+}
+
+func (config *SessionConfig) cookie() SessionCookieConfig {
+	cookie := config.Cookie
+	if cookie.Name == "" {
+		cookie.Name = DefaultSessionIDCookieName
+	}
+	return cookie
+}
+
+// Sessions manages server-side sessions identified by a signed session ID cookie.
+// Unlike the stateless session token of the `Authenticator`, a session can be invalidated
+// instantly by deleting it from the store and can hold as much state as the store allows.
+type Sessions struct {
+	config *SessionConfig
+	cookie SessionCookieConfig
+}
+
+// Initializes Sessions.
+// If the provided configuration is nil or invalid it will return an error.
+func NewSessions(config *SessionConfig) (*Sessions, error) {
+	if config == nil {
+		return nil, fmt.Errorf("Tried to initialize Sessions with nil configuration.")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Sessions{config: config, cookie: config.cookie()}, nil
+}
+
+func (s *Sessions) now() time.Time {
+	if s.config.Clock == nil {
+		return time.Now()
+	}
+	return s.config.Clock()
+}
+
+func (s *Sessions) idleTimeout() time.Duration {
+	if s.config.IdleTimeout == 0 {
+		return DefaultSessionIdleTimeout
+	}
+	return s.config.IdleTimeout
+}
+
+func (s *Sessions) absoluteTimeout() time.Duration {
+	if s.config.AbsoluteTimeout == 0 {
+		return DefaultSessionAbsoluteTimeout
+	}
+	return s.config.AbsoluteTimeout
+}
+
+// Returns the cookie value for the session ID: the ID followed by its HMAC.
+func (s *Sessions) sign(id string) string {
+	mac := hmac.New(sha256.New, s.config.Secret)
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Returns the session ID of a cookie value if its signature is valid.
+func (s *Sessions) verify(value string) (string, bool) {
+	id, _, ok := strings.Cut(value, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, hmac.Equal([]byte(s.sign(id)), []byte(value))
+}
+
+// Returns when the session expires: after the idle timeout or the absolute timeout, whichever
+// comes first.
+func (s *Sessions) expiresAt(data SessionData) time.Time {
+	idle := data.LastSeenAt.Add(s.idleTimeout())
+	absolute := data.CreatedAt.Add(s.absoluteTimeout())
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// Load returns the session of the request, or a new empty session if the request has no valid
+// session cookie or its session expired.
+func (s *Sessions) Load(r *http.Request) (*Session, error) {
+	now := s.now()
+	if cookie, err := r.Cookie(s.cookie.name()); err == nil {
+		if id, ok := s.verify(cookie.Value); ok {
+			data, err := s.config.Store.GetSession(r.Context(), id, now)
+			switch {
+			case err == nil && now.Before(s.expiresAt(data)):
+				data.ID = id
+				return &Session{data: data, persisted: true}, nil
+			case err == nil:
+				_ = s.config.Store.DeleteSession(r.Context(), id)
+			case !errors.Is(err, ErrSessionNotFound):
+				return nil, fmt.Errorf("an error occurred while loading session: %v", err)
+			}
+		}
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{data: SessionData{ID: id, Values: make(map[string]any), CreatedAt: now, LastSeenAt: now}}, nil
+}
+
+// Save writes the changes of the session to the store and updates the session cookie.
+// It must be called before the response header is written, `Middleware` does this on its own.
+func (s *Sessions) Save(w http.ResponseWriter, r *http.Request, session *Session) error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	for _, id := range session.previousIDs {
+		if err := s.config.Store.DeleteSession(r.Context(), id); err != nil {
+			return fmt.Errorf("an error occurred while deleting session: %v", err)
+		}
+	}
+	session.previousIDs = nil
+
+	if session.destroyed {
+		if session.persisted {
+			if err := s.config.Store.DeleteSession(r.Context(), session.data.ID); err != nil {
+				return fmt.Errorf("an error occurred while deleting session: %v", err)
+			}
+		}
+		session.persisted = false
+		http.SetCookie(w, s.cookie.cookie("", -1, time.Unix(0, 0)))
+		return nil
+	}
+
+	now := s.now()
+	if !session.dirty && (!session.persisted || now.Sub(session.data.LastSeenAt) < sessionTouchInterval) {
+		return nil
+	}
+
+	if !session.persisted {
+		session.data.CreatedAt = now
+	}
+	session.data.LastSeenAt = now
+	expiresAt := s.expiresAt(session.data)
+	if err := s.config.Store.SaveSession(r.Context(), session.data, expiresAt); err != nil {
+		return fmt.Errorf("an error occurred while saving session: %v", err)
+	}
+	session.persisted = true
+	session.dirty = false
+
+	// The cookie lives until the absolute timeout, the idle timeout is enforced by the server.
+	absolute := session.data.CreatedAt.Add(s.absoluteTimeout())
+	http.SetCookie(w, s.cookie.cookie(s.sign(session.data.ID), int(absolute.Sub(now).Seconds()), absolute))
+	return nil
+}
+
+// A response writer that saves the session right before the header is written, so the
+// session cookie can still be set.
+type sessionResponseWriter struct {
+	http.ResponseWriter
+	save  func()
+	saved bool
+}
+
+func (w *sessionResponseWriter) commit() {
+	if !w.saved {
+		w.saved = true
+		w.save()
+	}
+}
+
+func (w *sessionResponseWriter) WriteHeader(statusCode int) {
+	w.commit()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *sessionResponseWriter) Write(b []byte) (int, error) {
+	w.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush saves the session before the header is sent with the first flush of a streamed response.
+func (w *sessionResponseWriter) Flush() {
+	w.commit()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *sessionResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware loads the session of every request and stores it in the request context under
+// SessionKey, see `SessionFromContext`. Changes are saved, and the cookie updated, when the
+// handler starts writing the response. Requests whose session cannot be loaded get 500.
+func (s *Sessions) Middleware(logger ILogger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, err := s.Load(r)
+			if err != nil {
+				logger.Errorf("Failed to load session: %v", err)
+				WriteErrorToResponse(w, http.StatusInternalServerError, "failed to load session")
+				return
+			}
+
+			writer := &sessionResponseWriter{ResponseWriter: w}
+			writer.save = func() {
+				if err := s.Save(w, r, session); err != nil {
+					logger.Errorf("Failed to save session: %v", err)
+				}
+			}
+			next.ServeHTTP(writer, r.WithContext(context.WithValue(r.Context(), SessionKey, session)))
+			writer.commit()
+		})
+	}
+}
+
+type memorySession struct {
+	data      SessionData
+	expiresAt time.Time
+}
+
+// MemorySessionStore is an in-memory `ISessionStore`.
+// It is safe for concurrent use but sessions are lost when the process exits and are not shared
+// between instances. Values are stored as they are, without a JSON round trip.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+// Initializes an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession)}
+}
+
+// GetSession returns a copy of the session with the provided ID.
+func (s *MemorySessionStore) GetSession(ctx context.Context, id string, now time.Time) (SessionData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || !now.Before(session.expiresAt) {
+		return SessionData{}, ErrSessionNotFound
+	}
+	return copySessionData(session.data), nil
+}
+
+// SaveSession stores a copy of the session and prunes the sessions that expired before its
+// LastSeenAt.
+func (s *MemorySessionStore) SaveSession(ctx context.Context, session SessionData, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, stored := range s.sessions {
+		if !session.LastSeenAt.Before(stored.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[session.ID] = memorySession{data: copySessionData(session), expiresAt: expiresAt}
+	return nil
+}
+
+// DeleteSession removes the session.
+func (s *MemorySessionStore) DeleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// Copies the values map so the stored session is not changed by the handlers.
+func copySessionData(data SessionData) SessionData {
+	values := make(map[string]any, len(data.Values))
+	for key, value := range data.Values {
+		values[key] = value
+	}
+	data.Values = values
+	return data
+}
@@ -0,0 +1,140 @@
+package grove
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const sessionFileExtension = ".json"
+
+type fileSession struct {
+	Session   SessionData `json:"session"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// FileSessionStore is an `ISessionStore` keeping every session in a JSON file in a directory.
+// Sessions survive restarts and can be shared between processes on the same host.
+// Values go through a JSON round trip, so numbers come back as float64 and structs as maps.
+type FileSessionStore struct {
+	dir string
+}
+
+// Initializes a FileSessionStore in the directory, creating it if it does not exist.
+// The directory should not be shared with other data.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("session directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("an error occurred while creating session directory: %v", err)
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// Files are named after the hash of the session ID, so the IDs are not readable from the
+// directory listing and cannot escape the directory.
+func (s *FileSessionStore) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+sessionFileExtension)
+}
+
+func readFileSession(path string) (fileSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileSession{}, err
+	}
+	var session fileSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return fileSession{}, err
+	}
+	return session, nil
+}
+
+// GetSession reads the session with the provided ID. Sessions that expired at now are removed.
+func (s *FileSessionStore) GetSession(ctx context.Context, id string, now time.Time) (SessionData, error) {
+	path := s.path(id)
+	session, err := readFileSession(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return SessionData{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return SessionData{}, fmt.Errorf("an error occurred while reading session file: %v", err)
+	}
+	if !now.Before(session.ExpiresAt) || session.Session.ID != id {
+		_ = os.Remove(path)
+		return SessionData{}, ErrSessionNotFound
+	}
+	return session.Session, nil
+}
+
+// SaveSession writes the session to a temporary file and renames it, so readers never see a
+// partially written session.
+func (s *FileSessionStore) SaveSession(ctx context.Context, session SessionData, expiresAt time.Time) error {
+	data, err := json.Marshal(fileSession{Session: session, ExpiresAt: expiresAt})
+	if err != nil {
+		return fmt.Errorf("an error occurred while encoding session: %v", err)
+	}
+
+	file, err := os.CreateTemp(s.dir, ".session-*")
+	if err != nil {
+		return fmt.Errorf("an error occurred while creating session file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("an error occurred while writing session file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("an error occurred while writing session file: %v", err)
+	}
+	if err := os.Rename(file.Name(), s.path(session.ID)); err != nil {
+		return fmt.Errorf("an error occurred while writing session file: %v", err)
+	}
+	return nil
+}
+
+// DeleteSession removes the file of the session.
+func (s *FileSessionStore) DeleteSession(ctx context.Context, id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("an error occurred while deleting session file: %v", err)
+	}
+	return nil
+}
+
+// PruneExpired removes the files of the sessions that expired at now and returns how many were
+// removed. Expired sessions are otherwise only removed when they are read, so it should be called
+// periodically.
+func (s *FileSessionStore) PruneExpired(ctx context.Context, now time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("an error occurred while reading session directory: %v", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !strings.HasSuffix(entry.Name(), sessionFileExtension) {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		session, err := readFileSession(path)
+		if err != nil || now.Before(session.ExpiresAt) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,350 @@
+package grove_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+var sessionSecret = []byte("0123456789abcdef0123456789abcdef")
+
+type sessionTestClock struct {
+	now time.Time
+}
+
+func (c *sessionTestClock) Now() time.Time {
+	return c.now
+}
+
+func newTestSessions(t *testing.T, store grove.ISessionStore, clock *sessionTestClock) *grove.Sessions {
+	t.Helper()
+
+	sessions, err := grove.NewSessions(&grove.SessionConfig{
+		Store:           store,
+		Secret:          sessionSecret,
+		IdleTimeout:     30 * time.Minute,
+		AbsoluteTimeout: 2 * time.Hour,
+		Clock:           clock.Now,
+	})
+	if err != nil {
+		t.Fatalf("NewSessions() error = %v; want nil", err)
+	}
+	return sessions
+}
+
+// Serves a request through the session middleware and returns the response.
+func serveSession(sessions *grove.Sessions, cookie *http.Cookie, handler func(w http.ResponseWriter, session *grove.Session)) *http.Response {
+	h := sessions.Middleware(grove.NewDefaultLogger("test"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := grove.SessionFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		handler(w, session)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func sessionCookie(resp *http.Response) *http.Cookie {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == grove.DefaultSessionIDCookieName {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestNewSessionsValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *grove.SessionConfig
+	}{
+		{name: "nil", config: nil},
+		{name: "missing store", config: &grove.SessionConfig{Secret: sessionSecret}},
+		{name: "short secret", config: &grove.SessionConfig{Store: grove.NewMemorySessionStore(), Secret: []byte("short")}},
+		{name: "negative timeout", config: &grove.SessionConfig{Store: grove.NewMemorySessionStore(), Secret: sessionSecret, IdleTimeout: -time.Minute}},
+		{name: "invalid cookie", config: &grove.SessionConfig{Store: grove.NewMemorySessionStore(), Secret: sessionSecret, Cookie: grove.SessionCookieConfig{Path: "app"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := grove.NewSessions(tt.config); err == nil {
+				t.Fatalf("NewSessions() error = nil; want error")
+			}
+		})
+	}
+}
+
+func TestSessionsMiddlewarePersistsValues(t *testing.T) {
+	clock := &sessionTestClock{now: time.Now()}
+	sessions := newTestSessions(t, grove.NewMemorySessionStore(), clock)
+
+	resp := serveSession(sessions, nil, func(w http.ResponseWriter, session *grove.Session) {
+		if !session.IsNew() {
+			t.Errorf("IsNew() = false; want true")
+		}
+		session.Set("user", "user-1")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	cookie := sessionCookie(resp)
+	if cookie == nil {
+		t.Fatalf("response has no %s cookie", grove.DefaultSessionIDCookieName)
+	}
+	if !cookie.HttpOnly || !cookie.Secure || cookie.MaxAge != int((2*time.Hour).Seconds()) {
+		t.Fatalf("cookie = %+v; want HttpOnly, Secure and MaxAge of the absolute timeout", cookie)
+	}
+
+	clock.now = clock.now.Add(10 * time.Minute)
+	serveSession(sessions, cookie, func(w http.ResponseWriter, session *grove.Session) {
+		if session.IsNew() {
+			t.Errorf("IsNew() = true; want false")
+		}
+		if got := session.GetString("user"); got != "user-1" {
+			t.Errorf("GetString(user) = %q; want user-1", got)
+		}
+	})
+}
+
+func TestSessionsMiddlewareDoesNotSaveUnchangedNewSession(t *testing.T) {
+	sessions := newTestSessions(t, grove.NewMemorySessionStore(), &sessionTestClock{now: time.Now()})
+
+	resp := serveSession(sessions, nil, func(w http.ResponseWriter, session *grove.Session) {
+		w.WriteHeader(http.StatusOK)
+	})
+	if cookie := sessionCookie(resp); cookie != nil {
+		t.Fatalf("cookie = %+v; want none for an unchanged session", cookie)
+	}
+}
+
+func TestSessionsMiddlewareRejectsTamperedCookie(t *testing.T) {
+	clock := &sessionTestClock{now: time.Now()}
+	sessions := newTestSessions(t, grove.NewMemorySessionStore(), clock)
+
+	resp := serveSession(sessions, nil, func(w http.ResponseWriter, session *grove.Session) {
+		session.Set("user", "user-1")
+	})
+	cookie := sessionCookie(resp)
+
+	for _, value := range []string{cookie.Value + "x", "x" + cookie.Value, "unsigned"} {
+		serveSession(sessions, &http.Cookie{Name: cookie.Name, Value: value}, func(w http.ResponseWriter, session *grove.Session) {
+			if !session.IsNew() || session.GetString("user") != "" {
+				t.Errorf("cookie %q loaded the session; want a new session", value)
+			}
+		})
+	}
+}
+
+func TestSessionsTimeouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []time.Duration
+		wantOK bool
+	}{
+		{name: "active", steps: []time.Duration{20 * time.Minute, 20 * time.Minute, 20 * time.Minute}, wantOK: true},
+		{name: "idle", steps: []time.Duration{31 * time.Minute}, wantOK: false},
+		{name: "absolute", steps: []time.Duration{25 * time.Minute, 25 * time.Minute, 25 * time.Minute, 25 * time.Minute, 25 * time.Minute}, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &sessionTestClock{now: time.Now()}
+			sessions := newTestSessions(t, grove.NewMemorySessionStore(), clock)
+
+			cookie := sessionCookie(serveSession(sessions, nil, func(w http.ResponseWriter, session *grove.Session) {
+				session.Set("user", "user-1")
+			}))
+
+			found := true
+			for _, step := range tt.steps {
+				clock.now = clock.now.Add(step)
+				serveSession(sessions, cookie, func(w http.ResponseWriter, session *grove.Session) {
+					found = session.GetString("user") == "user-1"
+				})
+			}
+			if found != tt.wantOK {
+				t.Fatalf("session found = %v; want %v", found, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSessionStoresUseTheSessionClock(t *testing.T) {
+	fileStore, err := grove.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() error = %v; want nil", err)
+	}
+
+	for name, store := range map[string]grove.ISessionStore{"memory": grove.NewMemorySessionStore(), "file": fileStore} {
+		t.Run(name, func(t *testing.T) {
+			// Sessions of this clock expired long ago by the wall clock.
+			clock := &sessionTestClock{now: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)}
+			sessions := newTestSessions(t, store, clock)
+
+			cookie := sessionCookie(serveSession(sessions, nil, func(w http.ResponseWriter, session *grove.Session) {
+				session.Set("user", "user-1")
+			}))
+			clock.now = clock.now.Add(10 * time.Minute)
+			serveSession(sessions, cookie, func(w http.ResponseWriter, session *grove.Session) {
+				if got := session.GetString("user"); got != "user-1" {
+					t.Errorf("GetString(user) = %q; want user-1", got)
+				}
+			})
+
+			clock.now = clock.now.Add(time.Hour)
+			serveSession(sessions, cookie, func(w http.ResponseWriter, session *grove.Session) {
+				if !session.IsNew() {
+					t.Errorf("IsNew() = false; want true after the idle timeout")
+				}
+			})
+		})
+	}
+}
+
+func TestSessionsMiddlewareSavesBeforeFlush(t *testing.T) {
+	sessions := newTestSessions(t, grove.NewMemorySessionStore(), &sessionTestClock{now: time.Now()})
+	handler := sessions.Middleware(grove.NewDefaultLogger("test"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := grove.SessionFromContext(r.Context())
+		session.Set("user", "user-1")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush() error = %v; want nil", err)
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !rec.Flushed {
+		t.Fatalf("Flushed = false; want the underlying writer flushed")
+	}
+	// The recorder keeps the header as it was when it was written by the flush.
+	if sessionCookie(rec.Result()) == nil {
+		t.Fatalf("response has no %s cookie; want it set before the flush", grove.DefaultSessionIDCookieName)
+	}
+}
+
+func TestSessionRegenerateReplacesID(t *testing.T) {
+	clock := &sessionTestClock{now: time.Now()}
+	store := grove.NewMemorySessionStore()
+	sessions := newTestSessions(t, store, clock)
+
+	oldCookie := sessionCookie(serveSession(sessions, nil, func(w http.ResponseWriter, session *grove.Session) {
+		session.Set("cart", "cart-1")
+	}))
+
+	var oldID, newID string
+	newCookie := sessionCookie(serveSession(sessions, oldCookie, func(w http.ResponseWriter, session *grove.Session) {
+		oldID = session.ID()
+		if err := session.Regenerate(); err != nil {
+			t.Fatalf("Regenerate() error = %v; want nil", err)
+		}
+		session.Set("user", "user-1")
+		newID = session.ID()
+	}))
+	if newCookie == nil || newCookie.Value == oldCookie.Value || newID == oldID {
+		t.Fatalf("Regenerate() kept the session ID; want a new one")
+	}
+
+	if _, err := store.GetSession(context.Background(), oldID, clock.now); !errors.Is(err, grove.ErrSessionNotFound) {
+		t.Fatalf("GetSession(old ID) error = %v; want ErrSessionNotFound", err)
+	}
+	serveSession(sessions, newCookie, func(w http.ResponseWriter, session *grove.Session) {
+		if session.GetString("cart") != "cart-1" || session.GetString("user") != "user-1" {
+			t.Errorf("regenerated session lost its values")
+		}
+	})
+}
+
+func TestSessionDestroy(t *testing.T) {
+	clock := &sessionTestClock{now: time.Now()}
+	store := grove.NewMemorySessionStore()
+	sessions := newTestSessions(t, store, clock)
+
+	cookie := sessionCookie(serveSession(sessions, nil, func(w http.ResponseWriter, session *grove.Session) {
+		session.Set("user", "user-1")
+	}))
+
+	var id string
+	resp := serveSession(sessions, cookie, func(w http.ResponseWriter, session *grove.Session) {
+		id = session.ID()
+		session.Destroy()
+	})
+	if expired := sessionCookie(resp); expired == nil || expired.MaxAge >= 0 {
+		t.Fatalf("cookie = %+v; want an expired cookie", expired)
+	}
+	if _, err := store.GetSession(context.Background(), id, clock.now); !errors.Is(err, grove.ErrSessionNotFound) {
+		t.Fatalf("GetSession() error = %v; want ErrSessionNotFound", err)
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store, err := grove.NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() error = %v; want nil", err)
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	session := grove.SessionData{ID: "session-1", Values: map[string]any{"user": "user-1", "count": 2}, CreatedAt: now, LastSeenAt: now}
+	if err := store.SaveSession(ctx, session, now.Add(time.Hour)); err != nil {
+		t.Fatalf("SaveSession() error = %v; want nil", err)
+	}
+	if err := store.SaveSession(ctx, grove.SessionData{ID: "session-2"}, now.Add(-time.Second)); err != nil {
+		t.Fatalf("SaveSession() error = %v; want nil", err)
+	}
+
+	got, err := store.GetSession(ctx, "session-1", now)
+	if err != nil {
+		t.Fatalf("GetSession() error = %v; want nil", err)
+	}
+	if got.Values["user"] != "user-1" || got.Values["count"] != float64(2) {
+		t.Fatalf("Values = %v; want the saved values", got.Values)
+	}
+
+	removed, err := store.PruneExpired(ctx, now)
+	if err != nil || removed != 1 {
+		t.Fatalf("PruneExpired() = %d, %v; want 1, nil", removed, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("session directory has %d entries; want 1", len(entries))
+	}
+
+	if err := store.DeleteSession(ctx, "session-1"); err != nil {
+		t.Fatalf("DeleteSession() error = %v; want nil", err)
+	}
+	if _, err := store.GetSession(ctx, "session-1", now); !errors.Is(err, grove.ErrSessionNotFound) {
+		t.Fatalf("GetSession() error = %v; want ErrSessionNotFound", err)
+	}
+}
+
+func TestSessionsWithFileSessionStore(t *testing.T) {
+	store, err := grove.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore() error = %v; want nil", err)
+	}
+	sessions := newTestSessions(t, store, &sessionTestClock{now: time.Now()})
+
+	cookie := sessionCookie(serveSession(sessions, nil, func(w http.ResponseWriter, session *grove.Session) {
+		session.Set("user", "user-1")
+	}))
+	serveSession(sessions, cookie, func(w http.ResponseWriter, session *grove.Session) {
+		if session.GetString("user") != "user-1" {
+			t.Errorf("GetString(user) = %q; want user-1", session.GetString("user"))
+		}
+	})
+}
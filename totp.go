@@ -0,0 +1,303 @@
+package grove
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The TOTP parameters used by Grove. They are the defaults of RFC 6238 and the only ones
+// supported by every authenticator app: HMAC-SHA1, 6 digits and a 30 second period.
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+)
+
+// The number of periods before and after the current one that are accepted when verifying a code,
+// to tolerate clock drift between the server and the device.
+const DefaultTOTPSkew = 1
+
+// The number of codes returned by `GenerateRecoveryCodes` when zero is requested.
+const DefaultRecoveryCodeCount = 10
+
+const (
+	totpSecretSize   = 20
+	recoveryCodeSize = 10
+)
+
+var (
+	ErrMFANotEnrolled      = errors.New("multi-factor authentication is not enrolled")
+	ErrTOTPInvalid         = errors.New("TOTP code is invalid")
+	ErrTOTPReplayed        = errors.New("TOTP code was already used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPKey is a newly generated TOTP secret.
+type TOTPKey struct {
+	// The base32 encoded secret. It must be stored to verify codes and should be treated like a
+	// password, since anyone who knows it can generate codes.
+	Secret string
+	// The otpauth URI of the key, usually shown to the user as a QR code.
+	URI string
+}
+
+// GenerateTOTPSecret creates a random 160 bit TOTP secret for the account.
+// The issuer and account are used for the label of the otpauth URI that authenticator apps
+// display, e.g. `otpauth://totp/Grove:alice@example.com?secret=...&issuer=Grove`.
+func GenerateTOTPSecret(issuer string, account string) (TOTPKey, error) {
+	if account == "" {
+		return TOTPKey{}, fmt.Errorf("account is required")
+	}
+
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return TOTPKey{}, fmt.Errorf("an error occurred while generating TOTP secret: %v", err)
+	}
+	encoded := totpEncoding.EncodeToString(secret)
+
+	label := url.PathEscape(account)
+	query := url.Values{
+		"secret":    {encoded},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(TOTPDigits)},
+		"period":    {fmt.Sprint(int(TOTPPeriod.Seconds()))},
+	}
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+		query.Set("issuer", issuer)
+	}
+	uri := "otpauth://totp/" + label + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	return TOTPKey{Secret: encoded, URI: uri}, nil
+}
+
+// Decodes a base32 secret, tolerating lowercase letters, spaces and padding.
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := totpEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("TOTP secret is not valid base32")
+	}
+	return key, nil
+}
+
+// Computes the HOTP value of RFC 4226 for the counter.
+func hotp(key []byte, counter uint64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for range TOTPDigits {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulus)
+}
+
+// Returns the TOTP time step of t.
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// GenerateTOTPCode returns the code of the secret for the period containing t.
+func GenerateTOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(totpStep(t))), nil
+}
+
+// VerifyTOTP checks a code of the subject against the secret in the store.
+// Codes of up to skew periods before or after now are accepted. Every candidate is compared in
+// constant time and the matching time step is recorded in the store, so a code, or any code of an
+// earlier period, is only accepted once. It returns ErrTOTPInvalid for wrong codes and
+// ErrTOTPReplayed for codes that were already used.
+func VerifyTOTP(ctx context.Context, store IMFAStore, subject string, code string, now time.Time, skew int) error {
+	secret, err := store.GetTOTPSecret(ctx, subject)
+	if err != nil {
+		return err
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return err
+	}
+
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != TOTPDigits {
+		return ErrTOTPInvalid
+	}
+
+	current := totpStep(now)
+	matched := int64(-1)
+	for offset := -int64(skew); offset <= int64(skew); offset++ {
+		step := current + offset
+		if step < 0 {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step))), []byte(code)) == 1 {
+			matched = step
+		}
+	}
+	if matched < 0 {
+		return ErrTOTPInvalid
+	}
+	return store.UseTOTPStep(ctx, subject, matched)
+}
+
+// GenerateRecoveryCodes creates single use codes that can be used instead of a TOTP code, for
+// example when the device was lost. It returns the codes, which are shown to the user once, and
+// their hashes, which are stored. If count is zero DefaultRecoveryCodeCount codes are generated.
+func GenerateRecoveryCodes(count int) ([]string, []string, error) {
+	if count == 0 {
+		count = DefaultRecoveryCodeCount
+	}
+	if count < 0 {
+		return nil, nil, fmt.Errorf("recovery code count cannot be negative")
+	}
+
+	codes := make([]string, 0, count)
+	hashes := make([]string, 0, count)
+	random := make([]byte, recoveryCodeSize)
+	for range count {
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, fmt.Errorf("an error occurred while generating recovery code: %v", err)
+		}
+		encoded := strings.ToLower(totpEncoding.EncodeToString(random))
+		code := encoded[:len(encoded)/2] + "-" + encoded[len(encoded)/2:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hex encoded SHA-256 hash a recovery code is stored under.
+// The code is normalized first, so it can be entered without dashes or in uppercase.
+// Recovery codes are long random values, so unlike passwords they do not need a slow hash.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyRecoveryCode consumes a recovery code of the subject.
+// It returns ErrRecoveryCodeInvalid if the code is unknown or was already used.
+func VerifyRecoveryCode(ctx context.Context, store IMFAStore, subject string, code string) error {
+	if strings.TrimSpace(code) == "" {
+		return ErrRecoveryCodeInvalid
+	}
+	return store.ConsumeRecoveryCode(ctx, subject, HashRecoveryCode(code))
+}
+
+// IMFAStore stores the second factors of the users.
+type IMFAStore interface {
+	// GetTOTPSecret returns the TOTP secret of the subject or ErrMFANotEnrolled.
+	GetTOTPSecret(ctx context.Context, subject string) (string, error)
+	// UseTOTPStep records that a code of the time step was accepted. It must return
+	// ErrTOTPReplayed if the step is not after the last recorded step of the subject.
+	UseTOTPStep(ctx context.Context, subject string, step int64) error
+	// ConsumeRecoveryCode removes the recovery code with the provided hash. It must return
+	// ErrRecoveryCodeInvalid if the subject has no such code.
+	ConsumeRecoveryCode(ctx context.Context, subject string, hash string) error
+}
+
+type mfaEnrollment struct {
+	secret        string
+	lastStep      int64
+	recoveryCodes map[string]struct{}
+}
+
+// MemoryMFAStore is an in-memory `IMFAStore`.
+// It is safe for concurrent use but its state is lost when the process exits.
+type MemoryMFAStore struct {
+	mu          sync.Mutex
+	enrollments map[string]*mfaEnrollment
+}
+
+// Initializes an empty MemoryMFAStore.
+func NewMemoryMFAStore() *MemoryMFAStore {
+	return &MemoryMFAStore{enrollments: make(map[string]*mfaEnrollment)}
+}
+
+// Enroll stores the TOTP secret and the recovery code hashes of the subject, replacing any
+// previous enrollment.
+func (s *MemoryMFAStore) Enroll(subject string, secret string, recoveryCodeHashes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment := &mfaEnrollment{secret: secret, lastStep: -1, recoveryCodes: make(map[string]struct{}, len(recoveryCodeHashes))}
+	for _, hash := range recoveryCodeHashes {
+		enrollment.recoveryCodes[hash] = struct{}{}
+	}
+	s.enrollments[subject] = enrollment
+}
+
+// Unenroll removes the second factor of the subject.
+func (s *MemoryMFAStore) Unenroll(subject string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.enrollments, subject)
+}
+
+// GetTOTPSecret returns the TOTP secret of the subject.
+func (s *MemoryMFAStore) GetTOTPSecret(ctx context.Context, subject string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[subject]
+	if !ok {
+		return "", ErrMFANotEnrolled
+	}
+	return enrollment.secret, nil
+}
+
+// UseTOTPStep records the time step unless it, or a later one, was already used.
+func (s *MemoryMFAStore) UseTOTPStep(ctx context.Context, subject string, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[subject]
+	if !ok {
+		return ErrMFANotEnrolled
+	}
+	if step <= enrollment.lastStep {
+		return ErrTOTPReplayed
+	}
+	enrollment.lastStep = step
+	return nil
+}
+
+// ConsumeRecoveryCode removes the recovery code with the provided hash.
+func (s *MemoryMFAStore) ConsumeRecoveryCode(ctx context.Context, subject string, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[subject]
+	if !ok {
+		return ErrRecoveryCodeInvalid
+	}
+	if _, ok := enrollment.recoveryCodes[hash]; !ok {
+		return ErrRecoveryCodeInvalid
+	}
+	delete(enrollment.recoveryCodes, hash)
+	return nil
+}
@@ -0,0 +1,130 @@
+package grove_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenAlexanderJohnson/grove"
+)
+
+// The ASCII secret "12345678901234567890" used by the test vectors of RFC 6238.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTOTPCodeMatchesRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := grove.GenerateTOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateTOTPCode() error = %v; want nil", err)
+		}
+		if got != tt.want {
+			t.Errorf("GenerateTOTPCode(%d) = %s; want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := grove.GenerateTOTPCode("not base32!", time.Now()); err == nil {
+		t.Fatalf("GenerateTOTPCode() with invalid secret error = nil; want error")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	key, err := grove.GenerateTOTPSecret("Grove App", "alice@example.com")
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v; want nil", err)
+	}
+	if len(key.Secret) != 32 {
+		t.Fatalf("Secret = %q; want 32 base32 characters", key.Secret)
+	}
+
+	uri, err := url.Parse(key.URI)
+	if err != nil {
+		t.Fatalf("failed to parse URI %q: %v", key.URI, err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Grove App:alice@example.com" {
+		t.Fatalf("URI = %q; want otpauth://totp/ with issuer and account label", key.URI)
+	}
+	if strings.Contains(key.URI, "+") {
+		t.Fatalf("URI = %q; want spaces encoded as %%20", key.URI)
+	}
+	query := uri.Query()
+	if query.Get("secret") != key.Secret || query.Get("issuer") != "Grove App" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Fatalf("URI query = %v; want secret, issuer, digits and period", query)
+	}
+
+	if _, err := grove.GenerateTOTPSecret("Grove", ""); err == nil {
+		t.Fatalf("GenerateTOTPSecret() without account error = nil; want error")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	store := grove.NewMemoryMFAStore()
+	store.Enroll("alice", rfc6238Secret, nil)
+	ctx := context.Background()
+	now := time.Unix(1111111111, 0)
+
+	previous, _ := grove.GenerateTOTPCode(rfc6238Secret, now.Add(-grove.TOTPPeriod))
+	if err := grove.VerifyTOTP(ctx, store, "alice", previous, now, 1); err != nil {
+		t.Fatalf("VerifyTOTP() with previous period error = %v; want nil", err)
+	}
+	if err := grove.VerifyTOTP(ctx, store, "alice", previous, now, 1); !errors.Is(err, grove.ErrTOTPReplayed) {
+		t.Fatalf("VerifyTOTP() with reused code error = %v; want ErrTOTPReplayed", err)
+	}
+
+	current, _ := grove.GenerateTOTPCode(rfc6238Secret, now)
+	if err := grove.VerifyTOTP(ctx, store, "alice", current, now, 1); err != nil {
+		t.Fatalf("VerifyTOTP() with current period error = %v; want nil", err)
+	}
+
+	future, _ := grove.GenerateTOTPCode(rfc6238Secret, now.Add(2*grove.TOTPPeriod))
+	if err := grove.VerifyTOTP(ctx, store, "alice", future, now, 1); !errors.Is(err, grove.ErrTOTPInvalid) {
+		t.Fatalf("VerifyTOTP() outside of the skew error = %v; want ErrTOTPInvalid", err)
+	}
+	if err := grove.VerifyTOTP(ctx, store, "alice", "12345", now, 1); !errors.Is(err, grove.ErrTOTPInvalid) {
+		t.Fatalf("VerifyTOTP() with short code error = %v; want ErrTOTPInvalid", err)
+	}
+	if err := grove.VerifyTOTP(ctx, store, "bob", current, now, 1); !errors.Is(err, grove.ErrMFANotEnrolled) {
+		t.Fatalf("VerifyTOTP() for unknown subject error = %v; want ErrMFANotEnrolled", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := grove.GenerateRecoveryCodes(0)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v; want nil", err)
+	}
+	if len(codes) != grove.DefaultRecoveryCodeCount || len(hashes) != len(codes) {
+		t.Fatalf("GenerateRecoveryCodes() returned %d codes and %d hashes; want %d", len(codes), len(hashes), grove.DefaultRecoveryCodeCount)
+	}
+	if codes[0] == codes[1] || !strings.Contains(codes[0], "-") {
+		t.Fatalf("codes = %v; want distinct dashed codes", codes)
+	}
+
+	store := grove.NewMemoryMFAStore()
+	store.Enroll("alice", rfc6238Secret, hashes)
+	ctx := context.Background()
+
+	entered := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	if err := grove.VerifyRecoveryCode(ctx, store, "alice", entered); err != nil {
+		t.Fatalf("VerifyRecoveryCode() error = %v; want nil", err)
+	}
+	if err := grove.VerifyRecoveryCode(ctx, store, "alice", codes[0]); !errors.Is(err, grove.ErrRecoveryCodeInvalid) {
+		t.Fatalf("VerifyRecoveryCode() with used code error = %v; want ErrRecoveryCodeInvalid", err)
+	}
+	if err := grove.VerifyRecoveryCode(ctx, store, "bob", codes[1]); !errors.Is(err, grove.ErrRecoveryCodeInvalid) {
+		t.Fatalf("VerifyRecoveryCode() for other subject error = %v; want ErrRecoveryCodeInvalid", err)
+	}
+}